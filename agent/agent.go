@@ -0,0 +1,519 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/618lf/lanlink/config"
+	"github.com/618lf/lanlink/dns"
+	"github.com/618lf/lanlink/hosts"
+	"github.com/618lf/lanlink/internal"
+	"github.com/618lf/lanlink/logger"
+	"github.com/618lf/lanlink/network"
+	"github.com/618lf/lanlink/node"
+)
+
+const (
+	// syncResponseJitter 应答成员同步请求的最大随机延迟
+	syncResponseJitter = 500 * time.Millisecond
+	// offlineGrace 发送离线通知后关闭连接前的等待时间
+	offlineGrace = 100 * time.Millisecond
+	// offlineCheckInterval 离线检查和运行状态快照的周期
+	offlineCheckInterval = 5 * time.Second
+	// clusterInfoInterval 打印集群信息的周期
+	clusterInfoInterval = 30 * time.Second
+	// warnTTL 同一告警再次输出前的间隔
+	warnTTL = time.Hour
+	// maxWarned 记录的告警数上限，告警的 key 含对端可以伪造的标识，不能无限增长
+	maxWarned = 1024
+)
+
+// HostsUpdater 节点上下线时更新域名映射，hosts.Manager 实现了该接口
+type HostsUpdater interface {
+	// Set 设置域名对应的全部地址
+	Set(domain string, ips []string) error
+	// AddOrUpdate 设置域名对应的单个地址
+	AddOrUpdate(ip, domain string) error
+	// Remove 删除域名映射
+	Remove(domain string) error
+}
+
+// Agent LanLink 节点代理
+// 通过传输层发现局域网内的其他节点，维护成员状态并同步到 hosts 文件。
+// 守护进程和嵌入方都通过 New（或 NewWithTransport）创建、Run 运行，ctx 取消后退出
+type Agent struct {
+	cfg       *config.Config
+	hosts     HostsUpdater // 为 nil 时不写入域名映射
+	transport network.Transport
+	manager   *node.Manager
+	scheduler *node.HeartbeatScheduler
+	prober    *swimProber
+	self      *localNode
+	mdns      *network.MDNS // 为 nil 时不启用 mDNS
+	dns       *dns.Server   // 为 nil 时不启用内置 DNS
+	sinks     []*hosts.Sink // 节点表导出器（已包含在 hosts 中），另外写入本机条目
+	resolved  *dns.Resolved // 为 nil 时不注册到 systemd-resolved
+	selector  node.Selector // 只把匹配的节点写入 hosts
+	daemon    bool          // 守护进程模式：打印集群信息并写入运行状态快照
+	done      chan struct{} // Run 开始退出时关闭
+
+	warnMu sync.Mutex
+	warned map[string]time.Time // 已输出过的告警 -> 输出时间
+}
+
+// New 根据配置创建节点代理
+// 检查并初始化 hosts 文件、创建组播客户端，但不开始收发消息
+func New(cfg *config.Config) (*Agent, error) {
+	// 域名映射写入方式，none 时只通过内置 DNS 或导出文件解析，不需要 hosts 文件的写权限
+	var updaters multiUpdater
+	switch cfg.HostsBackend {
+	case "", "hosts":
+		// 检查hosts文件权限
+		hostsManager := hosts.NewManager()
+		hostsManager.SetZone(cfg.DomainSuffix)
+		if err := hostsManager.CheckPermission(); err != nil {
+			return nil, err
+		}
+
+		// 初始化hosts文件（添加标记区域）
+		if err := hostsManager.Initialize(); err != nil {
+			return nil, fmt.Errorf("初始化hosts文件失败: %v", err)
+		}
+		logger.Info("Hosts文件初始化完成")
+		updaters = append(updaters, hostsManager)
+	case "none":
+		if cfg.DNSListen == "" && len(cfg.Sinks) == 0 {
+			logger.Warn("hostsBackend 为 none 且未配置 dnsListen 或 sinks，其他节点的域名将无法解析")
+		}
+	default:
+		return nil, fmt.Errorf("不支持的 hostsBackend: %s", cfg.HostsBackend)
+	}
+
+	// 导出节点表供 dnsmasq、unbound、CoreDNS 使用
+	sinks, err := newSinks(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("sinks 配置无效: %v", err)
+	}
+	for _, sink := range sinks {
+		updaters = append(updaters, sink)
+	}
+	var updater HostsUpdater
+	switch len(updaters) {
+	case 0:
+	case 1:
+		updater = updaters[0]
+	default:
+		updater = updaters
+	}
+
+	// 获取本机信息
+	deviceID, err := network.GetMACAddress()
+	if err != nil {
+		return nil, fmt.Errorf("获取MAC地址失败: %v", err)
+	}
+
+	// 本机提供的服务
+	services, err := network.ParseServices(cfg.Services)
+	if err != nil {
+		return nil, fmt.Errorf("服务配置无效: %v", err)
+	}
+	if err := node.ValidateLabels(cfg.Labels); err != nil {
+		return nil, fmt.Errorf("标签配置无效: %v", err)
+	}
+	if err := node.ValidateDomain(generateDomain(cfg.DeviceName, cfg.DomainSuffix), cfg.DomainSuffix); err != nil {
+		return nil, fmt.Errorf("deviceName 或 domainSuffix 配置无效: %v", err)
+	}
+	if _, err := node.ParseSelector(cfg.HostsSelector); err != nil {
+		return nil, fmt.Errorf("hostsSelector 配置无效: %v", err)
+	}
+	if _, err := dns.ParseUpstreams(cfg.DNSUpstreams); err != nil {
+		return nil, fmt.Errorf("dnsUpstreams 配置无效: %v", err)
+	}
+	if cfg.Resolved && cfg.DNSListen == "" {
+		return nil, fmt.Errorf("启用 resolved 时需要配置 dnsListen")
+	}
+	if cfg.Resolved {
+		if _, err := dns.ValidateResolvedListen(cfg.DNSListen); err != nil {
+			return nil, fmt.Errorf("dnsListen 配置无效: %v", err)
+		}
+	}
+
+	// 创建组播客户端
+	policy, err := network.NewInterfacePolicy(cfg.Interfaces, cfg.ExcludeInterfaces, cfg.PreferredSubnets)
+	if err != nil {
+		return nil, fmt.Errorf("网卡配置无效: %v", err)
+	}
+	client, err := network.NewMulticastClient(cfg.MulticastAddr, cfg.MulticastAddr6, cfg.MulticastPort, cfg.IPMode, policy)
+	if err != nil {
+		return nil, fmt.Errorf("创建组播客户端失败: %v", err)
+	}
+	client.SetDeviceID(deviceID)
+
+	// 配置了种子节点时启用单播模式
+	if len(cfg.SeedPeers) > 0 {
+		client.EnableUnicast(cfg.SeedPeers, unicastPeerTimeout(cfg))
+		logger.Info("已启用单播模式，种子节点: %s", strings.Join(cfg.SeedPeers, ", "))
+	}
+
+	// 配置了集群密钥时启用消息签名/加密
+	codec, err := network.NewCodec(cfg.ClusterSecret, cfg.Encryption, cfg.AcceptPlaintext)
+	if err != nil {
+		return nil, fmt.Errorf("初始化消息编解码失败: %v", err)
+	}
+	client.SetCodec(codec)
+	client.SetRateLimit(newRateLimiter(cfg.SourceRateLimit, cfg.SourceBurst, cfg.QuarantineSec),
+		newRateLimiter(cfg.DeviceRateLimit, cfg.DeviceBurst, cfg.QuarantineSec))
+	if codec.Encrypted() {
+		logger.Info("已启用消息加密 (acceptPlaintext=%v)", cfg.AcceptPlaintext)
+	} else if codec.Signed() {
+		logger.Info("已启用消息签名校验")
+	}
+	if len(cfg.SeedPeers) > 0 && codec.AcceptsUnsigned() {
+		// 未签名的对端列表可以伪造，此时不转告对端，只配置了种子节点的节点之间不能互相发现
+		logger.Warn("未配置 clusterSecret 或开启了 acceptPlaintext，单播模式不转告对端：只与种子节点和直接收到消息的对端通信，需要全部节点互通时请配置 clusterSecret 或在每个节点上列出全部种子节点")
+	}
+
+	a := NewWithTransport(cfg, deviceID, client, updater)
+	a.manager.SetAcceptUnsequenced(codec.AcceptsUnsigned())
+	a.daemon = true
+	a.sinks = sinks
+
+	// 启用 mDNS 时应答本机域名，并把 Avahi、Bonjour 设备导入为只读节点
+	if cfg.MDNS {
+		a.mdns = network.NewMDNS(cfg.IPMode, policy)
+		a.mdns.SetHost(generateDomain(cfg.DeviceName, cfg.DomainSuffix), client.GetLocalAddresses)
+		a.mdns.SetServices(services)
+		a.mdns.Browse(cfg.MDNSServices, time.Duration(cfg.MDNSBrowseSec)*time.Second, a.importHost)
+	}
+
+	fmt.Printf("本机域名: %s\n", generateDomain(cfg.DeviceName, cfg.DomainSuffix))
+	fmt.Printf("本机 IP: %s\n", client.GetLocalIP())
+	if ipv6 := client.GetLocalIPv6(); ipv6 != "" && ipv6 != client.GetLocalIP() {
+		fmt.Printf("本机 IPv6: %s\n", ipv6)
+	}
+	fmt.Println()
+	return a, nil
+}
+
+// NewWithTransport 使用指定的传输层创建节点代理，用于测试和嵌入
+// 传输层的编解码、限流等由调用方配置；hosts 为 nil 时只维护成员状态，不写入域名映射
+func NewWithTransport(cfg *config.Config, deviceID string, transport network.Transport, hosts HostsUpdater) *Agent {
+	localIP := transport.GetLocalIP()
+	localIPv6 := transport.GetLocalIPv6()
+	localAddrs := transport.GetLocalAddresses()
+	domain := generateDomain(cfg.DeviceName, cfg.DomainSuffix)
+	services, err := network.ParseServices(cfg.Services)
+	if err != nil {
+		logger.Warn("忽略无效的服务配置: %v", err)
+	}
+	selector, err := node.ParseSelector(cfg.HostsSelector)
+	if err != nil {
+		logger.Warn("忽略无效的 hostsSelector: %v", err)
+	}
+
+	logger.Info("本机信息: DeviceID=%s, IP=%s, IPv6=%s, Domain=%s", deviceID, localIP, localIPv6, domain)
+	for _, addr := range localAddrs {
+		logger.Debug("本机地址: %s/%d (%s)", addr.IP, addr.Prefix, addr.Iface)
+	}
+
+	a := &Agent{
+		cfg:       cfg,
+		hosts:     hosts,
+		transport: transport,
+		selector:  selector,
+		done:      make(chan struct{}),
+		warned:    make(map[string]time.Time),
+	}
+
+	// 本机节点信息，心跳和离线通知均基于此构造
+	a.self = newLocalNode(network.Message{
+		Domain:   domain,
+		IP:       localIP,
+		IPv6:     localIPv6,
+		Addrs:    localAddrs,
+		DeviceID: deviceID,
+		Hostname: cfg.DeviceName,
+		Services: services,
+		Labels:   cfg.Labels,
+	})
+
+	// 创建节点管理器
+	a.manager = node.NewManager(time.Duration(cfg.OfflineTimeoutSec) * time.Second)
+	a.manager.SetClockSkew(time.Duration(cfg.MaxClockSkewSec) * time.Second)
+	a.manager.SetSuspicionTimeout(time.Duration(cfg.SuspicionTimeoutSec) * time.Second)
+	a.manager.SetHeartbeatInterval(time.Duration(cfg.HeartbeatIntervalSec) * time.Second)
+	a.scheduler = node.NewHeartbeatScheduler(a.manager,
+		time.Duration(cfg.HeartbeatIntervalSec)*time.Second,
+		time.Duration(cfg.MaxHeartbeatIntervalSec)*time.Second)
+
+	// 添加本机节点
+	a.manager.AddOrUpdate(&node.Node{
+		DeviceID: deviceID,
+		Domain:   domain,
+		IP:       localIP,
+		IPv6:     localIPv6,
+		Addrs:    localAddrs,
+		Hostname: cfg.DeviceName,
+		Services: services,
+		Labels:   cfg.Labels,
+	})
+	a.manager.SetLocal(deviceID)
+	a.manager.SetChangeCallback(a.onNodeChange)
+	a.manager.SetStateCallback(a.onStateChange)
+
+	// 故障检测：定期探测节点，探测失败先标记疑似离线
+	a.prober = &swimProber{transport: transport, manager: a.manager, scheduler: a.scheduler, self: a.self}
+	a.prober.detector = node.NewDetector(a.manager, a.prober,
+		time.Duration(cfg.ProbeIntervalSec)*time.Second, cfg.IndirectProbes)
+
+	// 内置 DNS 直接根据成员状态应答，与 hosts 使用相同的标签过滤
+	if cfg.DNSListen != "" {
+		a.dns = dns.NewServer(cfg.DNSListen, cfg.DomainSuffix, a.manager)
+		a.dns.SetTTL(time.Duration(cfg.DNSTTLSec) * time.Second)
+		a.dns.SetFilter(func(n *node.Node) bool { return a.selector.Matches(n.Labels) })
+
+		upstreams, err := dns.ParseUpstreams(cfg.DNSUpstreams)
+		if err != nil {
+			logger.Warn("忽略无效的上游 DNS: %v", err)
+		}
+		if len(upstreams) > 0 {
+			a.dns.SetForwarder(dns.NewForwarder(upstreams, cfg.DNSCacheSize))
+		}
+		if cfg.Resolved {
+			a.resolved = dns.NewResolved(cfg.ResolvedLink, cfg.ResolvedBus)
+		}
+	}
+
+	transport.Subscribe(a.handleMessage)
+	return a
+}
+
+// Manager 节点管理器
+func (a *Agent) Manager() *node.Manager {
+	return a.manager
+}
+
+// Transport 传输层
+func (a *Agent) Transport() network.Transport {
+	return a.transport
+}
+
+// Run 运行节点代理，直到 ctx 取消
+// 退出时发送离线通知、关闭连接后返回，只能调用一次
+func (a *Agent) Run(ctx context.Context) error {
+	defer a.transport.Close()
+
+	// 连接的生命周期由 Run 管理，离线通知发送完成后才关闭
+	if err := a.transport.Start(context.Background()); err != nil {
+		return fmt.Errorf("启动组播监听失败: %v", err)
+	}
+	cfg := a.cfg
+	if _, ok := a.transport.(*network.MulticastClient); ok {
+		logger.Info("组播监听已启动: %s:%d (IPv6: %s, 模式: %s)", cfg.MulticastAddr, cfg.MulticastPort, cfg.MulticastAddr6, cfg.IPMode)
+	}
+	if a.dns != nil {
+		// 先注册到 systemd-resolved：LanLink 创建的链路上需要先添加监听地址，注册失败时仍可直接使用内置 DNS
+		if a.resolved != nil {
+			if err := a.resolved.Register(cfg.DNSListen, cfg.DomainSuffix); err != nil {
+				logger.Warn("注册到 systemd-resolved 失败: %v", err)
+			} else {
+				logger.Info("已通过 systemd-resolved 把 ~%s 路由到内置 DNS (链路: %s)", cfg.DomainSuffix, a.resolved.Link())
+				defer a.resolved.Revert()
+			}
+		}
+		if err := a.dns.Start(context.Background()); err != nil {
+			return fmt.Errorf("启动 DNS 服务失败: %v", err)
+		}
+		defer a.dns.Close()
+		logger.Info("DNS 服务已启动: %s (域名后缀: %s)", a.dns.Addr(), cfg.DomainSuffix)
+		if len(cfg.DNSUpstreams) > 0 {
+			logger.Info("其他域名转发到: %s", strings.Join(cfg.DNSUpstreams, ", "))
+		}
+	}
+	// mDNS 端口可能被系统服务独占，启动失败不影响集群功能
+	if a.mdns != nil {
+		if err := a.mdns.Start(context.Background()); err != nil {
+			logger.Warn("启动 mDNS 失败: %v", err)
+		} else {
+			logger.Info("已启用 mDNS (浏览: %s)", strings.Join(cfg.MDNSServices, ", "))
+			defer a.mdns.Close()
+		}
+	}
+
+	if len(a.sinks) > 0 {
+		a.exportLocal()
+		for _, sink := range a.sinks {
+			defer sink.Close()
+		}
+	}
+
+	// 发送首次心跳，并请求成员快照以立即获知现有节点
+	sendHeartbeat(a.transport, a.manager, a.scheduler, a.self)
+	if err := a.transport.Send(a.self.message(network.ActionSyncRequest)); err != nil {
+		logger.Error("发送同步请求失败: %v", err)
+	}
+
+	// 启动故障检测
+	if cfg.ProbeIntervalSec > 0 {
+		a.prober.detector.Start()
+		defer a.prober.detector.Stop()
+	}
+	// 监听本机网络变化，地址变化时立即重新通告（仅组播传输层）
+	if client, ok := a.transport.(*network.MulticastClient); ok && cfg.NetworkPollSec > 0 {
+		watcher := network.NewNetworkWatcher(client, time.Duration(cfg.NetworkPollSec)*time.Second)
+		watcher.SetChangeCallback(func() {
+			handleAddressChange(a.transport, a.manager, a.scheduler, a.self)
+			a.exportLocal()
+			if a.mdns != nil {
+				a.mdns.Refresh()
+			}
+		})
+		if watcher.Start() {
+			logger.Info("已启用网络变化监听")
+		} else {
+			logger.Info("已启用网络变化轮询 (间隔 %d 秒)", cfg.NetworkPollSec)
+		}
+		defer watcher.Stop()
+	}
+
+	// 心跳使用带抖动的自适应间隔，每次发送后重新计算
+	heartbeatTimer := time.NewTimer(a.scheduler.Next())
+	offlineCheckTicker := time.NewTicker(offlineCheckInterval)
+	clusterInfoTicker := time.NewTicker(clusterInfoInterval)
+	defer heartbeatTimer.Stop()
+	defer offlineCheckTicker.Stop()
+	defer clusterInfoTicker.Stop()
+
+	logger.Info("LanLink 运行中")
+
+	for {
+		select {
+		case <-heartbeatTimer.C:
+			// 发送心跳
+			sendHeartbeat(a.transport, a.manager, a.scheduler, a.self)
+			heartbeatTimer.Reset(a.scheduler.Next())
+
+		case <-offlineCheckTicker.C:
+			// 检查离线节点
+			offlineNodes := a.manager.CheckOffline()
+			if len(offlineNodes) > 0 {
+				logger.Debug("检查到 %d 个离线节点", len(offlineNodes))
+			}
+			a.pruneWarnings(time.Now())
+			if a.daemon {
+				writeState(a.transport, a.manager)
+			}
+
+		case <-clusterInfoTicker.C:
+			// 每30秒打印集群节点信息
+			if a.daemon {
+				printClusterInfo(a.manager)
+			}
+			logDropStats(a.transport, a.manager)
+
+		case <-ctx.Done():
+			a.shutdown()
+			return nil
+		}
+	}
+}
+
+// shutdown 优雅退出：发送离线通知，等待发送完成后由 Run 关闭连接
+func (a *Agent) shutdown() {
+	logger.Info("正在退出...")
+	close(a.done)
+
+	if err := a.transport.Send(a.self.message(network.ActionOffline)); err != nil {
+		logger.Error("发送离线通知失败: %v", err)
+	} else {
+		logger.Info("已发送离线通知")
+	}
+
+	// 等待消息发送完成
+	time.Sleep(offlineGrace)
+	if a.daemon {
+		if err := internal.RemoveState(); err != nil {
+			logger.Debug("删除运行状态失败: %v", err)
+		}
+	}
+}
+
+// stopping 是否已开始退出
+func (a *Agent) stopping() bool {
+	select {
+	case <-a.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// onNodeChange 节点上下线时更新hosts文件并打印集群信息
+func (a *Agent) onNodeChange(n *node.Node, isOnline bool) {
+	if n.IsLocal {
+		return
+	}
+
+	if isOnline {
+		logger.Info("节点上线: %s (%s -> %s)", n.Hostname, n.Domain, n.IP)
+	} else {
+		logger.Info("节点离线: %s (%s)", n.Hostname, n.Domain)
+	}
+	if a.hosts != nil {
+		a.updateHosts(n, isOnline)
+	}
+
+	// 状态变化时立即打印集群信息
+	// 回调在节点管理器持有锁时调用，打印需要读取全部节点，放到单独的协程中避免死锁
+	if a.daemon {
+		go printClusterInfo(a.manager)
+	}
+}
+
+// updateHosts 更新节点的域名映射，标签不匹配 hostsSelector 的节点不写入
+func (a *Agent) updateHosts(n *node.Node, isOnline bool) {
+	if !a.selector.Matches(n.Labels) {
+		// 标签变化后不再匹配时删除已有的映射
+		if err := a.hosts.Remove(n.Domain); err != nil {
+			logger.Error("更新hosts失败: %v", err)
+		}
+		return
+	}
+
+	if isOnline {
+		// 上线时使用真实IP，有 IPv6 地址时同时写入 IPv6 条目
+		ips := []string{n.IP}
+		if n.IPv6 != "" && n.IPv6 != n.IP {
+			ips = append(ips, n.IPv6)
+		}
+		if err := a.hosts.Set(n.Domain, ips); err != nil {
+			logger.Error("更新hosts失败: %v", err)
+		} else {
+			logger.Info("已更新hosts: %s -> %s", n.Domain, strings.Join(ips, ", "))
+		}
+		return
+	}
+
+	// 离线时将IP设为127.0.0.1（保留域名映射，同时移除IPv6条目）
+	if err := a.hosts.AddOrUpdate("127.0.0.1", n.Domain); err != nil {
+		logger.Error("更新hosts失败: %v", err)
+	} else {
+		logger.Info("已更新hosts: %s -> 127.0.0.1 (离线)", n.Domain)
+	}
+}
+
+// onStateChange 记录疑似离线和恢复（不修改hosts）
+func (a *Agent) onStateChange(n *node.Node, from node.State) {
+	if n.IsLocal {
+		return
+	}
+	switch {
+	case n.State == node.StateSuspect:
+		logger.Warn("节点疑似离线: %s (%s)", n.Hostname, n.Domain)
+	case n.State == node.StateAlive && from == node.StateSuspect:
+		logger.Info("节点恢复: %s (%s)", n.Hostname, n.Domain)
+	}
+}
@@ -0,0 +1,544 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/618lf/lanlink/config"
+	"github.com/618lf/lanlink/network"
+	"github.com/618lf/lanlink/node"
+)
+
+// testNode 内存总线上运行的节点
+type testNode struct {
+	agent     *Agent
+	transport *network.MemoryTransport
+	cancel    context.CancelFunc
+	done      chan error
+
+	stopOnce sync.Once
+	err      error // Run 的返回值
+}
+
+// testConfig 测试用配置：1 秒心跳，超时尽量短
+func testConfig(name string) *config.Config {
+	cfg := config.Default()
+	cfg.DeviceName = name
+	cfg.HeartbeatIntervalSec = 1
+	cfg.MaxHeartbeatIntervalSec = 1
+	cfg.OfflineTimeoutSec = 1
+	cfg.SuspicionTimeoutSec = 1
+	cfg.ProbeIntervalSec = 0
+	cfg.MaxClockSkewSec = 60
+	return cfg
+}
+
+// startNode 在总线上创建并运行节点，测试结束时退出
+func startNode(t *testing.T, bus *network.MemoryBus, ip, deviceID string, cfg *config.Config, daemon bool) *testNode {
+	t.Helper()
+	transport, err := bus.NewTransport(ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := &testNode{
+		agent:     NewWithTransport(cfg, deviceID, transport, nil),
+		transport: transport,
+		done:      make(chan error, 1),
+	}
+	n.agent.daemon = daemon
+
+	ctx, cancel := context.WithCancel(context.Background())
+	n.cancel = cancel
+	go func() { n.done <- n.agent.Run(ctx) }()
+	t.Cleanup(func() { n.stop() })
+	return n
+}
+
+// stop 退出节点并等待 Run 返回，可重复调用
+func (n *testNode) stop() error {
+	n.stopOnce.Do(func() {
+		n.cancel()
+		select {
+		case n.err = <-n.done:
+		case <-time.After(5 * time.Second):
+			n.err = errors.New("Run 未退出")
+		}
+	})
+	return n.err
+}
+
+// state 本节点看到的 deviceID 的状态，不存在时返回 false
+func (n *testNode) state(deviceID string) (node.State, bool) {
+	peer, ok := n.agent.Manager().Get(deviceID)
+	if !ok {
+		return "", false
+	}
+	return peer.State, true
+}
+
+// domain 本节点看到的 deviceID 的域名
+func (n *testNode) domain(deviceID string) string {
+	peer, ok := n.agent.Manager().Get(deviceID)
+	if !ok {
+		return ""
+	}
+	return peer.Domain
+}
+
+// eventually 在 timeout 内轮询 cond，直到返回 true
+func eventually(t *testing.T, timeout time.Duration, cond func() bool, format string, args ...interface{}) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf(format, args...)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// sees 节点 n 看到 deviceID 处于 state
+func sees(n *testNode, deviceID string, state node.State) func() bool {
+	return func() bool {
+		got, ok := n.state(deviceID)
+		return ok && got == state
+	}
+}
+
+const (
+	idA = "mac-00:11:22:33:44:01"
+	idB = "mac-00:11:22:33:44:02"
+	idC = "mac-00:11:22:33:44:03"
+)
+
+// startCluster 启动 A、B、C 三个节点并等待互相发现
+func startCluster(t *testing.T, bus *network.MemoryBus, tweak func(*config.Config)) map[string]*testNode {
+	t.Helper()
+	nodes := make(map[string]*testNode)
+	for i, id := range []string{idA, idB, idC} {
+		cfg := testConfig("node-" + string(rune('a'+i)))
+		if tweak != nil {
+			tweak(cfg)
+		}
+		nodes[id] = startNode(t, bus, "10.0.0."+string(rune('1'+i)), id, cfg, false)
+	}
+	for self, n := range nodes {
+		for peer := range nodes {
+			if peer != self {
+				eventually(t, 5*time.Second, sees(n, peer, node.StateAlive), "%s 未发现 %s", self, peer)
+			}
+		}
+	}
+	return nodes
+}
+
+func TestDomainConflictRename(t *testing.T) {
+	t.Parallel()
+	bus := network.NewMemoryBus()
+
+	a := startNode(t, bus, "10.0.0.1", idA, testConfig("pc"), false)
+	c := startNode(t, bus, "10.0.0.3", idC, testConfig("other"), false)
+	eventually(t, 5*time.Second, sees(c, idA, node.StateAlive), "C 未发现 A")
+
+	// B 与 A 使用相同的设备名，后加入的 B 被重命名
+	b := startNode(t, bus, "10.0.0.2", idB, testConfig("pc"), false)
+	eventually(t, 5*time.Second, sees(a, idB, node.StateAlive), "A 未发现 B")
+	eventually(t, 5*time.Second, sees(c, idB, node.StateAlive), "C 未发现 B")
+
+	const renamed = "pc-334402.coobee.local"
+	if got := a.domain(idB); got != renamed {
+		t.Fatalf("A 看到 B 的域名 = %q, want %q", got, renamed)
+	}
+	if got := c.domain(idB); got != renamed {
+		t.Fatalf("C 看到 B 的域名 = %q, want %q", got, renamed)
+	}
+	if got := c.domain(idA); got != "pc.coobee.local" {
+		t.Fatalf("C 看到 A 的域名 = %q", got)
+	}
+
+	// 之后的心跳仍携带原域名，重命名必须保持
+	time.Sleep(2500 * time.Millisecond)
+	if got := a.domain(idB); got != renamed {
+		t.Fatalf("心跳后 A 看到 B 的域名 = %q, want %q", got, renamed)
+	}
+	if got := c.domain(idB); got != renamed {
+		t.Fatalf("心跳后 C 看到 B 的域名 = %q, want %q", got, renamed)
+	}
+	if found, ok := c.agent.Manager().FindByDomain(renamed); !ok || found.DeviceID != idB {
+		t.Fatalf("按重命名后的域名找不到 B")
+	}
+
+	// 在 B 看来，先占用 pc.coobee.local 的是它自己，A 被重命名
+	if got := b.domain(idA); got != "pc-334401.coobee.local" {
+		t.Fatalf("B 看到 A 的域名 = %q", got)
+	}
+}
+
+func TestOfflineAfterClose(t *testing.T) {
+	t.Parallel()
+	nodes := startCluster(t, network.NewMemoryBus(), nil)
+
+	// 正常退出时发送离线通知，其他节点立即标记离线（远小于心跳超时 + 检查周期）
+	if err := nodes[idB].stop(); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{idA, idC} {
+		eventually(t, time.Second, sees(nodes[id], idB, node.StateDead), "%s 未收到 B 的离线通知", id)
+	}
+
+	// 传输层直接断开（模拟进程崩溃）时，经心跳超时和疑似离线超时后判定离线
+	nodes[idC].transport.Close()
+	eventually(t, 3*offlineCheckInterval, sees(nodes[idA], idC, node.StateDead), "A 未检测到 C 离线")
+}
+
+func TestSuspicionRefutedUnderLoss(t *testing.T) {
+	t.Parallel()
+	bus := network.NewMemoryBus()
+	nodes := startCluster(t, bus, func(cfg *config.Config) {
+		// 只由故障检测标记疑似离线，疑似离线超时足够长，反驳前不会被判定离线
+		cfg.ProbeIntervalSec = 1
+		cfg.IndirectProbes = 1
+		cfg.OfflineTimeoutSec = 60
+		cfg.SuspicionTimeoutSec = 60
+	})
+
+	// 丢包导致探测失败，被怀疑的节点递增化身号反驳
+	bus.SetLoss(0.5)
+	eventually(t, 20*time.Second, func() bool {
+		for _, n := range nodes {
+			if n.agent.Manager().LocalIncarnation() > 0 {
+				return true
+			}
+		}
+		return false
+	}, "丢包期间没有节点反驳怀疑")
+
+	// 恢复网络后所有节点重新确认彼此存活，期间没有节点被判定离线
+	bus.SetLoss(0)
+	for self, n := range nodes {
+		for peer := range nodes {
+			if peer == self {
+				continue
+			}
+			eventually(t, 5*time.Second, sees(n, peer, node.StateAlive), "%s 未确认 %s 存活", self, peer)
+		}
+	}
+}
+
+func TestPartitionHeal(t *testing.T) {
+	t.Parallel()
+	bus := network.NewMemoryBus()
+	nodes := startCluster(t, bus, nil)
+
+	// C 与 A、B 隔离，双方经心跳超时后互相判定离线，同侧的节点不受影响
+	bus.Partition([]string{"10.0.0.1", "10.0.0.2"}, []string{"10.0.0.3"})
+	timeout := 3 * offlineCheckInterval
+	eventually(t, timeout, sees(nodes[idA], idC, node.StateDead), "A 未判定 C 离线")
+	eventually(t, timeout, sees(nodes[idB], idC, node.StateDead), "B 未判定 C 离线")
+	eventually(t, timeout, sees(nodes[idC], idA, node.StateDead), "C 未判定 A 离线")
+	eventually(t, timeout, sees(nodes[idC], idB, node.StateDead), "C 未判定 B 离线")
+	if state, _ := nodes[idA].state(idB); state == node.StateDead {
+		t.Fatal("同一分区内的 B 被判定离线")
+	}
+
+	// 分区恢复后心跳使节点重新上线
+	bus.Heal()
+	for self, n := range nodes {
+		for peer := range nodes {
+			if peer != self {
+				eventually(t, 5*time.Second, sees(n, peer, node.StateAlive), "分区恢复后 %s 未发现 %s", self, peer)
+			}
+		}
+	}
+}
+
+// TestDaemonClusterInfo 节点变化回调在管理器持有锁时调用，守护进程模式下打印集群信息不能阻塞消息处理
+func TestDaemonClusterInfo(t *testing.T) {
+	t.Parallel()
+	bus := network.NewMemoryBus()
+	a := startNode(t, bus, "10.0.0.1", idA, testConfig("a"), true)
+	b := startNode(t, bus, "10.0.0.2", idB, testConfig("b"), true)
+	c := startNode(t, bus, "10.0.0.3", idC, testConfig("c"), true)
+
+	// 运行状态快照在第一次离线检查时才写入，在此之前完成
+	timeout := offlineCheckInterval - time.Second
+	for _, n := range []*testNode{a, b, c} {
+		for _, id := range []string{idA, idB, idC} {
+			if id != n.agent.self.deviceID {
+				eventually(t, timeout, sees(n, id, node.StateAlive), "%s 未发现 %s", n.agent.self.deviceID, id)
+			}
+		}
+	}
+	if err := b.stop(); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, time.Second, sees(a, idB, node.StateDead), "A 未收到 B 的离线通知")
+	eventually(t, time.Second, sees(c, idB, node.StateDead), "C 未收到 B 的离线通知")
+}
+
+// TestRejectsInvalidDomain 对端的域名或地址无效时忽略该节点，不写入节点表
+func TestRejectsInvalidDomain(t *testing.T) {
+	transport, err := network.NewMemoryBus().NewTransport("10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewWithTransport(testConfig("a"), idA, transport, nil)
+
+	heartbeat := func(seq uint64, deviceID, domain, ip string) *network.Message {
+		return &network.Message{
+			Action:    network.ActionHeartbeat,
+			Domain:    domain,
+			IP:        ip,
+			DeviceID:  deviceID,
+			Hostname:  deviceID,
+			Timestamp: time.Now().Unix(),
+			Seq:       seq,
+		}
+	}
+	a.handleMessage(heartbeat(1, "injected", "x\ndhcp-script=/tmp/p.coobee.local", "10.0.0.2"))
+	a.handleMessage(heartbeat(1, "outside", "www.example.com", "10.0.0.3"))
+	a.handleMessage(heartbeat(1, "bad-ip", "bad.coobee.local", "10.0.0.4\nserver=8.8.8.8"))
+	a.handleMessage(&network.Message{
+		Action:    network.ActionSyncResponse,
+		DeviceID:  "responder",
+		Timestamp: time.Now().Unix(),
+		Seq:       1,
+		Members: []network.Member{
+			{DeviceID: "member-bad", Domain: "a,b.coobee.local", IP: "10.0.0.5"},
+			{DeviceID: "member-ok", Domain: "ok.coobee.local", IP: "10.0.0.6"},
+		},
+	})
+	a.handleMessage(heartbeat(1, "valid", "valid.coobee.local", "10.0.0.7"))
+
+	for _, id := range []string{"injected", "outside", "bad-ip", "member-bad"} {
+		if _, ok := a.Manager().Get(id); ok {
+			t.Errorf("无效的节点 %s 被加入节点表", id)
+		}
+	}
+	for _, id := range []string{"member-ok", "valid"} {
+		if _, ok := a.Manager().Get(id); !ok {
+			t.Errorf("有效的节点 %s 未加入节点表", id)
+		}
+	}
+}
+
+// TestDropsInvalidLabels 心跳和成员快照中的无效标签被丢弃，有效标签保留
+func TestDropsInvalidLabels(t *testing.T) {
+	transport, err := network.NewMemoryBus().NewTransport("10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewWithTransport(testConfig("a"), idA, transport, nil)
+
+	labels := map[string]string{"env": "dev", "role": "db,env=prod", "bad key": "x"}
+	a.handleMessage(&network.Message{
+		Action:    network.ActionHeartbeat,
+		Domain:    "b.coobee.local",
+		IP:        "10.0.0.2",
+		DeviceID:  "b",
+		Hostname:  "b",
+		Timestamp: time.Now().Unix(),
+		Seq:       1,
+		Labels:    labels,
+	})
+	a.handleMessage(&network.Message{
+		Action:    network.ActionSyncResponse,
+		DeviceID:  "responder",
+		Timestamp: time.Now().Unix(),
+		Seq:       1,
+		Members: []network.Member{
+			{DeviceID: "c", Domain: "c.coobee.local", IP: "10.0.0.3", Labels: labels},
+		},
+	})
+
+	for _, id := range []string{"b", "c"} {
+		n, ok := a.Manager().Get(id)
+		if !ok {
+			t.Fatalf("节点 %s 未加入节点表", id)
+		}
+		if len(n.Labels) != 1 || n.Labels["env"] != "dev" {
+			t.Errorf("节点 %s 的标签 = %v，期望只保留 env=dev", id, n.Labels)
+		}
+	}
+}
+
+// TestNewRejectsLoopbackResolved 启用 resolved 时 dnsListen 为回环地址直接报错
+func TestNewRejectsLoopbackResolved(t *testing.T) {
+	for _, listen := range []string{"127.0.0.1:53", "0.0.0.0:53"} {
+		cfg := testConfig("a")
+		cfg.HostsBackend = "none"
+		cfg.DNSListen = listen
+		cfg.Resolved = true
+		if _, err := New(cfg); err == nil {
+			t.Errorf("dnsListen=%s 时 New 应返回错误", listen)
+		}
+	}
+}
+
+// TestSyncRespondsToSource 成员快照只发往请求的实际来源，伪造通告地址的请求不应答
+func TestSyncRespondsToSource(t *testing.T) {
+	t.Parallel()
+	bus := network.NewMemoryBus()
+	startNode(t, bus, "10.0.0.1", idA, testConfig("a"), false)
+
+	// listen 在总线上创建只收集成员快照应答的传输层
+	listen := func(ip string) (*network.MemoryTransport, *atomic.Int32) {
+		transport, err := bus.NewTransport(ip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var responses atomic.Int32
+		transport.Subscribe(func(msg *network.Message) {
+			if msg.Action == network.ActionSyncResponse {
+				responses.Add(1)
+			}
+		})
+		if err := transport.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { transport.Close() })
+		return transport, &responses
+	}
+	_, victim := listen("10.0.0.2")
+	attacker, attackerResponses := listen("10.0.0.9")
+
+	request := func(ip string) {
+		if err := attacker.Send(&network.Message{Action: network.ActionSyncRequest, DeviceID: "requester", Hostname: "requester", IP: ip}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 通告地址为受害者的请求不应答
+	request("10.0.0.2")
+	time.Sleep(2 * syncResponseJitter)
+	if n := victim.Load() + attackerResponses.Load(); n != 0 {
+		t.Fatalf("伪造的请求收到 %d 个应答", n)
+	}
+
+	// 正常的请求应答到实际来源
+	request("10.0.0.9")
+	eventually(t, 2*time.Second, func() bool { return attackerResponses.Load() > 0 }, "请求方未收到成员快照")
+	if n := victim.Load(); n != 0 {
+		t.Fatalf("受害者收到 %d 个应答", n)
+	}
+}
+
+func TestUnicastPeerTimeout(t *testing.T) {
+	tests := []struct {
+		base, max, offline int
+		want               time.Duration
+	}{
+		{10, 60, 30, 180 * time.Second},
+		{10, 0, 30, 30 * time.Second},
+		{10, 5, 60, 60 * time.Second},
+		{30, 10, 30, 90 * time.Second},
+	}
+	for _, tt := range tests {
+		cfg := config.Default()
+		cfg.HeartbeatIntervalSec, cfg.MaxHeartbeatIntervalSec, cfg.OfflineTimeoutSec = tt.base, tt.max, tt.offline
+		if got := unicastPeerTimeout(cfg); got != tt.want {
+			t.Errorf("unicastPeerTimeout(%d, %d, %d) = %v, want %v", tt.base, tt.max, tt.offline, got, tt.want)
+		}
+	}
+}
+
+func TestRenameDomain(t *testing.T) {
+	tests := []struct {
+		deviceID string
+		want     string
+	}{
+		{"mac-00:11:22:33:44:55", "pc-334455.coobee.local"},
+		{"mac-AA:BB:CC:DD:EE:FF", "pc-ddeeff.coobee.local"},
+		{"mac-00:11", "pc-0011.coobee.local"},
+		{"x\n6.6.6.6 www.google.com #", "pc-6666ec.coobee.local"},
+		{"mac-aa-bb-cc-dd-ee-ff", "pc-ddeeff.coobee.local"},
+	}
+	for _, tt := range tests {
+		got := renameDomain("pc.coobee.local", "coobee.local", tt.deviceID)
+		if got != tt.want {
+			t.Errorf("renameDomain(%q) = %q, want %q", tt.deviceID, got, tt.want)
+		}
+		if err := node.ValidateDomain(got, "coobee.local"); err != nil {
+			t.Errorf("renameDomain(%q) 生成了无效的域名: %v", tt.deviceID, err)
+		}
+	}
+
+	// 没有十六进制字符时使用哈希
+	got := renameDomain("pc.coobee.local", "coobee.local", "xyz\n")
+	if err := node.ValidateDomain(got, "coobee.local"); err != nil || got == "pc.coobee.local" {
+		t.Errorf("renameDomain = %q, %v", got, err)
+	}
+}
+
+// TestConflictRenameRejected 重命名后的域名无效时忽略节点，不会写入节点表
+func TestConflictRenameRejected(t *testing.T) {
+	transport, err := network.NewMemoryBus().NewTransport("10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewWithTransport(testConfig("a"), idA, transport, nil)
+	heartbeat := func(deviceID, domain, ip string) {
+		a.handleMessage(&network.Message{
+			Action:    network.ActionHeartbeat,
+			Domain:    domain,
+			IP:        ip,
+			DeviceID:  deviceID,
+			Hostname:  "pc",
+			Timestamp: time.Now().Unix(),
+			Seq:       1,
+		})
+	}
+
+	heartbeat(idB, "pc.coobee.local", "10.0.0.2")
+	heartbeat("x\n6.6.6.6 www.google.com #", "pc.coobee.local", "10.0.0.3")
+	if got, _ := a.Manager().Get("x\n6.6.6.6 www.google.com #"); got == nil || got.Domain != "pc-6666ec.coobee.local" {
+		t.Fatalf("冲突节点: %+v", got)
+	}
+
+	// 最长的合法名称加上后缀后超过 63 个字符
+	long := strings.Repeat("a", 63) + ".coobee.local"
+	heartbeat(idC, long, "10.0.0.4")
+	heartbeat("mac-00:11:22:33:44:05", long, "10.0.0.5")
+	if _, ok := a.Manager().Get("mac-00:11:22:33:44:05"); ok {
+		t.Fatal("重命名后域名无效的节点被加入节点表")
+	}
+	for _, n := range a.Manager().GetAll() {
+		if err := node.ValidateDomain(n.Domain, "coobee.local"); err != nil {
+			t.Errorf("节点表中有无效的域名 %q", n.Domain)
+		}
+	}
+}
+
+// TestWarnOnceBounded 告警记录的 key 含对端可以伪造的标识，记录数有上限且定期清理
+func TestWarnOnceBounded(t *testing.T) {
+	a := &Agent{warned: make(map[string]time.Time)}
+
+	a.warnOnce("source/a", "告警")
+	first := a.warned["source/a"]
+	a.warnOnce("source/a", "告警")
+	if !a.warned["source/a"].Equal(first) {
+		t.Fatal("重复的告警再次输出")
+	}
+
+	for i := 0; i < 2*maxWarned; i++ {
+		a.warnOnce("source/spoofed-"+strconv.Itoa(i), "告警")
+	}
+	if len(a.warned) > maxWarned {
+		t.Fatalf("warned = %d, want <= %d", len(a.warned), maxWarned)
+	}
+	if _, ok := a.warned["source/spoofed-"+strconv.Itoa(2*maxWarned-1)]; !ok {
+		t.Fatal("最新的告警未记录")
+	}
+
+	a.warned["source/old"] = time.Now().Add(-2 * warnTTL)
+	a.pruneWarnings(time.Now())
+	if _, ok := a.warned["source/old"]; ok {
+		t.Fatal("过期的告警记录未清理")
+	}
+}
@@ -0,0 +1,261 @@
+package agent
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/618lf/lanlink/logger"
+	"github.com/618lf/lanlink/network"
+	"github.com/618lf/lanlink/node"
+)
+
+// handleMessage 处理收到的集群消息
+func (a *Agent) handleMessage(msg *network.Message) {
+	logger.Debug("收到消息: Action=%s, From=%s (%s, 源地址 %s)", msg.Action, msg.Hostname, msg.IP, msg.Source)
+
+	// 传输层已过滤本进程的消息，相同 DeviceID 说明另一台设备与本机冲突（如克隆的虚拟机）
+	if msg.DeviceID == a.self.deviceID {
+		a.warnOnce("identity/"+msg.Instance, "检测到相同 DeviceID 的其他实例: %s (%s, 源地址 %s)，已忽略其消息", msg.Hostname, msg.IP, msg.Source)
+		return
+	}
+
+	// 拒绝过期或重复的消息（防重放）
+	if err := a.manager.Validate(msg.DeviceID, msg.Seq, msg.Timestamp); err != nil {
+		logger.Debug("拒绝消息: %v (From=%s, Seq=%d)", err, msg.DeviceID, msg.Seq)
+		return
+	}
+
+	// 源地址不在对端通告的地址中，可能是伪造的消息（也可能经过了 NAT），每个来源只告警一次
+	if msg.SourceMismatch() {
+		a.warnOnce("source/"+msg.DeviceID+"/"+msg.Source, "消息源地址与通告地址不一致，可能是伪造: %s 通告 %s，实际来自 %s", msg.Hostname, msg.IP, msg.Source)
+	}
+
+	// 按本机当前地址选择对端地址（本机地址可能随网络变化而更新）
+	localAddrs := a.transport.GetLocalAddresses()
+
+	switch msg.Action {
+	case network.ActionHeartbeat:
+		// 从对端上报的地址中选择与本机同网段的地址
+		ip, ipv6 := msg.PreferredAddrs(localAddrs)
+		if !a.acceptNode(msg.DeviceID, msg.Hostname, msg.Domain, ip, ipv6) {
+			return
+		}
+		mergeNode(a.manager, &node.Node{
+			DeviceID:    msg.DeviceID,
+			Domain:      msg.Domain,
+			IP:          ip,
+			IPv6:        ipv6,
+			Addrs:       msg.Addrs,
+			Hostname:    msg.Hostname,
+			Interval:    time.Duration(msg.Interval) * time.Second,
+			Incarnation: msg.Incarnation,
+			Services:    msg.Services,
+			Labels:      a.acceptLabels(msg.DeviceID, msg.Hostname, msg.Labels),
+		}, a.cfg.DomainSuffix)
+
+	case network.ActionPing, network.ActionPingReq, network.ActionAck, network.ActionSuspect:
+		from, _ := msg.PreferredAddrs(localAddrs)
+		a.prober.handle(msg, from)
+
+	case network.ActionSyncRequest:
+		// 新节点请求成员快照，随机延迟后单播应答，避免所有节点同时回复。
+		// 应答发往数据包的实际来源而不是消息中通告的地址：成员快照远大于请求，
+		// 按通告地址应答时一条伪造的请求就能让所有节点向任意地址发送大量数据；
+		// 经中继转发的请求来源是中继，源地址与通告地址不一致的请求可能是伪造的，都不应答
+		if msg.Source == "" || msg.Hops > 0 || msg.SourceMismatch() {
+			logger.Debug("忽略成员快照请求: %s 通告 %s，实际来自 %s (hops=%d)", msg.Hostname, msg.IP, msg.Source, msg.Hops)
+			return
+		}
+		requester := msg.Source
+		time.AfterFunc(time.Duration(rand.Int63n(int64(syncResponseJitter))), func() {
+			if a.stopping() {
+				return
+			}
+			respondSync(a.transport, a.manager, a.self, requester)
+		})
+
+	case network.ActionSyncResponse:
+		// 合并成员快照，只添加尚未知道的节点，已知节点以心跳为准
+		merged := 0
+		for i := range msg.Members {
+			member := &msg.Members[i]
+			if _, exists := a.manager.Get(member.DeviceID); exists {
+				continue
+			}
+			ip, ipv6 := member.PreferredAddrs(localAddrs)
+			if !a.acceptNode(member.DeviceID, member.Hostname, member.Domain, ip, ipv6) {
+				continue
+			}
+			if mergeNode(a.manager, &node.Node{
+				DeviceID: member.DeviceID,
+				Domain:   member.Domain,
+				IP:       ip,
+				IPv6:     ipv6,
+				Addrs:    member.Addrs,
+				Hostname: member.Hostname,
+				Services: member.Services,
+				Labels:   a.acceptLabels(member.DeviceID, member.Hostname, member.Labels),
+			}, a.cfg.DomainSuffix) {
+				merged++
+			}
+		}
+		if merged > 0 {
+			logger.Info("从 %s 同步了 %d 个节点", msg.Hostname, merged)
+		}
+
+	case network.ActionOffline:
+		// 标记节点离线（不删除，保留记录）
+		a.manager.MarkOffline(msg.DeviceID)
+	}
+}
+
+// warnOnce 同一 key 在 warnTTL 内只输出一次告警，避免每条心跳都重复告警
+// 记录已满时淘汰最早的记录，伪造的消息不能让记录无限增长
+func (a *Agent) warnOnce(key, format string, args ...interface{}) {
+	a.warnMu.Lock()
+	defer a.warnMu.Unlock()
+
+	now := time.Now()
+	if at, warned := a.warned[key]; warned && now.Sub(at) < warnTTL {
+		return
+	}
+	if _, exists := a.warned[key]; !exists && len(a.warned) >= maxWarned {
+		oldest := ""
+		for k, at := range a.warned {
+			if oldest == "" || at.Before(a.warned[oldest]) {
+				oldest = k
+			}
+		}
+		delete(a.warned, oldest)
+	}
+	a.warned[key] = now
+	logger.Warn(format, args...)
+}
+
+// pruneWarnings 清理超过 warnTTL 的告警记录，随离线检查定期执行
+func (a *Agent) pruneWarnings(now time.Time) {
+	a.warnMu.Lock()
+	defer a.warnMu.Unlock()
+	for key, at := range a.warned {
+		if now.Sub(at) >= warnTTL {
+			delete(a.warned, key)
+		}
+	}
+}
+
+// acceptNode 对端的域名是否为域名后缀下的有效主机名、地址是否有效，无效时忽略该节点（每个节点只告警一次）
+// 域名和地址会写入 hosts 文件和导出的 DNS 配置，不能接受可能注入配置或不属于集群的域名
+func (a *Agent) acceptNode(deviceID, hostname, domain, ip, ipv6 string) bool {
+	err := node.ValidateDomain(domain, a.cfg.DomainSuffix)
+	if err == nil && (net.ParseIP(ip) == nil || (ipv6 != "" && net.ParseIP(ipv6) == nil)) {
+		err = fmt.Errorf("无效的地址: %q, %q", ip, ipv6)
+	}
+	if err != nil {
+		a.warnOnce("invalid/"+deviceID+"/"+domain, "忽略节点 %s (%s): %v", hostname, deviceID, err)
+		return false
+	}
+	return true
+}
+
+// acceptLabels 丢弃对端标签中不符合标签规则的键值对（每个节点只告警一次）
+// 标签参与选择器匹配并显示在 status 输出中，与本机配置的标签使用相同的规则
+func (a *Agent) acceptLabels(deviceID, hostname string, labels map[string]string) map[string]string {
+	valid, dropped := node.FilterLabels(labels)
+	if dropped > 0 {
+		a.warnOnce("labels/"+deviceID, "丢弃节点 %s (%s) 的 %d 个无效标签", hostname, deviceID, dropped)
+	}
+	return valid
+}
+
+// sendHeartbeat 发送心跳（携带本机当前化身号和心跳间隔）
+func sendHeartbeat(transport network.Transport, manager *node.Manager, scheduler *node.HeartbeatScheduler, self *localNode) {
+	msg := self.message(network.ActionHeartbeat)
+	msg.Incarnation = manager.LocalIncarnation()
+	msg.Interval = int(scheduler.Interval() / time.Second)
+
+	if err := transport.Send(msg); err != nil {
+		logger.Error("发送心跳失败: %v", err)
+	} else {
+		logger.Debug("已发送心跳: %s -> %s", msg.Domain, msg.IP)
+	}
+}
+
+// mergeNode 合并对端节点信息，域名与其他节点冲突时自动重命名
+// 每次合并都检查冲突，节点之后的心跳仍使用重命名后的域名；重命名后的域名无效（如超长）时不合并，返回 false
+func mergeNode(manager *node.Manager, info *node.Node, suffix string) bool {
+	// 检查域名冲突
+	existing, exists := manager.Get(info.DeviceID)
+	if !exists {
+		// LanLink 节点优先于 mDNS 导入的同名设备
+		releaseImported(manager, info.Domain)
+	}
+	if hasDomainConflict(manager, info.Domain, info.DeviceID) {
+		// 域名冲突，添加后缀
+		originalDomain := info.Domain
+		info.Domain = renameDomain(info.Domain, suffix, info.DeviceID)
+		if err := node.ValidateDomain(info.Domain, suffix); err != nil {
+			if !exists {
+				logger.Warn("域名冲突: %s 已被占用，重命名后的域名无效，忽略节点 %s: %v", originalDomain, info.Hostname, err)
+			}
+			return false
+		}
+		if !exists || existing.Domain != info.Domain {
+			logger.Warn("域名冲突: %s 已被占用，自动重命名为 %s", originalDomain, info.Domain)
+		}
+	}
+
+	// 更新节点
+	if changed := manager.AddOrUpdate(info); changed && exists {
+		logger.Info("节点信息更新: %s (%s -> %s)", info.Hostname, info.Domain, info.IP)
+	}
+	return true
+}
+
+// handleAddressChange 本机地址变化后更新本机信息并立即发送心跳
+func handleAddressChange(transport network.Transport, manager *node.Manager, scheduler *node.HeartbeatScheduler, self *localNode) {
+	ip, ipv6, addrs := transport.GetLocalIP(), transport.GetLocalIPv6(), transport.GetLocalAddresses()
+	logger.Info("本机地址已变化: IP=%s, IPv6=%s", ip, ipv6)
+
+	self.setAddrs(ip, ipv6, addrs)
+	local := self.message(network.ActionHeartbeat)
+	manager.AddOrUpdate(&node.Node{
+		DeviceID: local.DeviceID,
+		Domain:   local.Domain,
+		IP:       ip,
+		IPv6:     ipv6,
+		Addrs:    addrs,
+		Hostname: local.Hostname,
+		Services: local.Services,
+		Labels:   local.Labels,
+	})
+	sendHeartbeat(transport, manager, scheduler, self)
+}
+
+// respondSync 向请求方单播当前在线成员快照（包含本机）
+func respondSync(transport network.Transport, manager *node.Manager, self *localNode, requester string) {
+	msg := self.message(network.ActionSyncResponse)
+	for _, n := range manager.GetAll() {
+		// 只读节点由各节点自行通过 mDNS 发现
+		if !n.IsOnline() || n.ReadOnly {
+			continue
+		}
+		msg.Members = append(msg.Members, network.Member{
+			DeviceID: n.DeviceID,
+			Domain:   n.Domain,
+			IP:       n.IP,
+			IPv6:     n.IPv6,
+			Addrs:    n.Addrs,
+			Hostname: n.Hostname,
+			Services: n.Services,
+			Labels:   n.Labels,
+		})
+	}
+
+	if err := transport.SendTo(msg, requester); err != nil {
+		logger.Error("发送成员快照失败: %v", err)
+	} else {
+		logger.Debug("已向 %s 发送成员快照 (%d 个节点)", requester, len(msg.Members))
+	}
+}
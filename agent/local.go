@@ -0,0 +1,39 @@
+package agent
+
+import (
+	"sync"
+
+	"github.com/618lf/lanlink/network"
+)
+
+// localNode 本机节点信息，心跳、探测和离线通知均基于此构造
+// 网络变化时会更新地址，可被多个协程并发读取
+type localNode struct {
+	deviceID string // 设备ID，运行期间不变
+
+	mu  sync.RWMutex
+	msg network.Message
+}
+
+// newLocalNode 创建本机节点信息
+func newLocalNode(msg network.Message) *localNode {
+	return &localNode{deviceID: msg.DeviceID, msg: msg}
+}
+
+// message 基于本机信息构造指定动作的消息
+func (l *localNode) message(action string) *network.Message {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	msg := l.msg
+	msg.Action = action
+	return &msg
+}
+
+// setAddrs 更新本机地址
+func (l *localNode) setAddrs(ip, ipv6 string, addrs []network.Address) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.msg.IP = ip
+	l.msg.IPv6 = ipv6
+	l.msg.Addrs = addrs
+}
@@ -0,0 +1,95 @@
+package agent
+
+import (
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/618lf/lanlink/logger"
+	"github.com/618lf/lanlink/network"
+	"github.com/618lf/lanlink/node"
+)
+
+// importedPrefix mDNS 导入节点的 DeviceID 前缀
+const importedPrefix = "mdns:"
+
+// importHost 把 mDNS 浏览到的设备导入为只读节点，域名为 {主机名}.{后缀}
+// 本机和已运行 LanLink 的设备（地址相同）跳过，域名已被 LanLink 节点使用时也跳过
+func (a *Agent) importHost(host network.MDNSHost) {
+	name := strings.TrimSuffix(strings.TrimSuffix(host.Host, "."), ".local")
+	if name == "" {
+		return
+	}
+
+	// 链路本地 IPv6 地址需要指定网卡，无法写入 hosts
+	var ip, ipv6 string
+	for _, addr := range host.IPs {
+		parsed := net.ParseIP(addr)
+		switch {
+		case parsed == nil || parsed.IsLinkLocalUnicast():
+		case parsed.To4() != nil:
+			if ip == "" {
+				ip = addr
+			}
+		case ipv6 == "":
+			ipv6 = addr
+		}
+	}
+	if ip == "" {
+		ip = ipv6
+	}
+	if ip == "" {
+		return
+	}
+
+	for _, n := range a.manager.GetAll() {
+		if !n.ReadOnly && sharesAddress(n, host.IPs) {
+			return
+		}
+	}
+
+	deviceID := importedPrefix + name
+	domain := generateDomain(name, a.cfg.DomainSuffix)
+	if err := node.ValidateDomain(domain, a.cfg.DomainSuffix); err != nil {
+		logger.Debug("mDNS 设备 %s 的主机名无效，跳过: %v", host.Host, err)
+		return
+	}
+	if hasDomainConflict(a.manager, domain, deviceID) {
+		logger.Debug("mDNS 设备 %s 的域名 %s 已被占用，跳过", host.Host, domain)
+		return
+	}
+
+	if a.manager.Import(&node.Node{
+		DeviceID: deviceID,
+		Domain:   domain,
+		IP:       ip,
+		IPv6:     ipv6,
+		Hostname: name,
+		Interval: host.TTL,
+	}) {
+		logger.Debug("已导入 mDNS 设备: %s (%s)", host.Instance, host.Host)
+	}
+}
+
+// releaseImported 移除使用指定域名的只读节点，让位给同名的 LanLink 节点
+func releaseImported(manager *node.Manager, domain string) {
+	for _, n := range manager.GetAll() {
+		if n.ReadOnly && n.Domain == domain {
+			manager.Remove(n.DeviceID)
+			logger.Info("域名 %s 由 LanLink 节点接管，移除 mDNS 设备 %s", domain, n.Hostname)
+		}
+	}
+}
+
+// sharesAddress 节点是否使用了其中任一地址
+func sharesAddress(n *node.Node, ips []string) bool {
+	if slices.Contains(ips, n.IP) || (n.IPv6 != "" && slices.Contains(ips, n.IPv6)) {
+		return true
+	}
+	for _, addr := range n.Addrs {
+		if slices.Contains(ips, addr.IP) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"github.com/618lf/lanlink/logger"
+	"github.com/618lf/lanlink/network"
+	"github.com/618lf/lanlink/node"
+)
+
+// swimProber 基于组播客户端实现故障检测的探测消息收发
+type swimProber struct {
+	transport network.Transport
+	manager   *node.Manager
+	detector  *node.Detector
+	scheduler *node.HeartbeatScheduler
+	self      *localNode
+}
+
+// message 构造探测消息（只携带本机基本信息）
+func (p *swimProber) message(action string) *network.Message {
+	msg := p.self.message(action)
+	msg.Addrs = nil
+	msg.Services = nil
+	msg.Labels = nil
+	return msg
+}
+
+// Ping 直接探测目标节点
+func (p *swimProber) Ping(target *node.Node, probeID uint64) error {
+	msg := p.message(network.ActionPing)
+	msg.Target = target.DeviceID
+	msg.ProbeID = probeID
+	return p.transport.SendTo(msg, target.IP)
+}
+
+// PingReq 请求 via 节点代为探测目标节点
+func (p *swimProber) PingReq(via, target *node.Node, probeID uint64) error {
+	msg := p.message(network.ActionPingReq)
+	msg.Target = target.DeviceID
+	msg.ProbeID = probeID
+	return p.transport.SendTo(msg, via.IP)
+}
+
+// Suspect 向集群通告目标节点疑似离线
+func (p *swimProber) Suspect(target *node.Node) error {
+	msg := p.message(network.ActionSuspect)
+	msg.Target = target.DeviceID
+	msg.Incarnation = target.Incarnation
+	return p.transport.Send(msg)
+}
+
+// handle 处理故障检测消息，from 为发送方可达地址
+func (p *swimProber) handle(msg *network.Message, from string) {
+	switch msg.Action {
+	case network.ActionPing:
+		// 收到消息本身即说明发送方存活
+		p.manager.Touch(msg.DeviceID)
+		if msg.Target != p.self.deviceID {
+			return
+		}
+		ack := p.message(network.ActionAck)
+		ack.Target = p.self.deviceID
+		ack.ProbeID = msg.ProbeID
+		ack.Origin = msg.Origin
+		if err := p.transport.SendTo(ack, from); err != nil {
+			logger.Debug("发送探测应答失败: %v", err)
+		}
+
+	case network.ActionPingReq:
+		// 代为探测，应答时由本机转发给发起方
+		p.manager.Touch(msg.DeviceID)
+		target, exists := p.manager.Get(msg.Target)
+		if !exists {
+			return
+		}
+		ping := p.message(network.ActionPing)
+		ping.Target = target.DeviceID
+		ping.ProbeID = msg.ProbeID
+		ping.Origin = from
+		if err := p.transport.SendTo(ping, target.IP); err != nil {
+			logger.Debug("代为探测失败: %v", err)
+		}
+
+	case network.ActionAck:
+		p.manager.Touch(msg.Target)
+		if msg.Origin == "" {
+			p.detector.HandleAck(msg.ProbeID, msg.Target)
+			return
+		}
+		// 代为探测的应答，转发给发起方
+		ack := p.message(network.ActionAck)
+		ack.Target = msg.Target
+		ack.ProbeID = msg.ProbeID
+		if err := p.transport.SendTo(ack, msg.Origin); err != nil {
+			logger.Debug("转发探测应答失败: %v", err)
+		}
+
+	case network.ActionSuspect:
+		if msg.Target == p.self.deviceID {
+			// 本机被怀疑，递增化身号并立即发送心跳反驳
+			incarnation := p.manager.Refute(msg.Incarnation)
+			logger.Warn("%s 怀疑本机离线，发送心跳反驳 (incarnation=%d)", msg.Hostname, incarnation)
+			sendHeartbeat(p.transport, p.manager, p.scheduler, p.self)
+			return
+		}
+		p.manager.Suspect(msg.Target, msg.Incarnation)
+	}
+}
@@ -0,0 +1,189 @@
+package agent
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/618lf/lanlink/config"
+	"github.com/618lf/lanlink/internal"
+	"github.com/618lf/lanlink/logger"
+	"github.com/618lf/lanlink/network"
+	"github.com/618lf/lanlink/node"
+)
+
+// generateDomain 生成域名
+// 域名格式: {deviceName}.{suffix}
+// 其中 deviceName 默认为 {platform}-{硬件序列号后6位}
+// 最终域名示例: win-abc123.coobee.local, macos-xyz789.coobee.local
+func generateDomain(deviceName, suffix string) string {
+	// 将设备名转换为小写，替换空格为连字符
+	name := strings.ToLower(deviceName)
+	name = strings.ReplaceAll(name, " ", "-")
+	return fmt.Sprintf("%s.%s", name, suffix)
+}
+
+// renameDomain 域名冲突时在设备名后添加 MAC 后缀
+// 如 pc.coobee.local 重命名为 pc-334455.coobee.local，不在域名后缀下的域名直接追加
+func renameDomain(domain, suffix, deviceID string) string {
+	tag := "-" + extractMACShort(deviceID)
+	if name, ok := strings.CutSuffix(domain, "."+suffix); ok && name != "" {
+		return name + tag + "." + suffix
+	}
+	return domain + tag
+}
+
+// hasDomainConflict 检查域名冲突
+func hasDomainConflict(manager *node.Manager, domain, deviceID string) bool {
+	nodes := manager.GetAll()
+	for _, n := range nodes {
+		if n.Domain == domain && n.DeviceID != deviceID {
+			return true
+		}
+	}
+	return false
+}
+
+// extractMACShort 提取MAC地址的短格式（后6位）
+// deviceID格式: mac-00:11:22:33:44:55；DeviceID 来自其他节点的消息，只取其中的十六进制字符，
+// 没有十六进制字符时使用 DeviceID 的哈希，结果只包含 [0-9a-f]，可以安全地用于域名
+func extractMACShort(deviceID string) string {
+	var hex []byte
+	for _, c := range []byte(strings.ToLower(strings.TrimPrefix(deviceID, "mac-"))) {
+		if (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') {
+			hex = append(hex, c)
+		}
+	}
+	if len(hex) == 0 {
+		h := fnv.New32a()
+		h.Write([]byte(deviceID))
+		return fmt.Sprintf("%06x", h.Sum32()&0xffffff)
+	}
+	return string(hex[max(0, len(hex)-6):])
+}
+
+// logDropStats 记录被丢弃的数据包和被拒绝的消息统计
+func logDropStats(transport network.Transport, manager *node.Manager) {
+	stats := transport.Stats()
+	if stats.Dropped() > 0 {
+		logger.Warn("已丢弃 %d 个数据包 (未签名 %d, 签名无效 %d, 明文 %d, 解密失败 %d, 无法解析 %d, 截断 %d, 分片不完整 %d, 限流 %d)",
+			stats.Dropped(), stats.Unsigned, stats.BadSignature, stats.Plaintext, stats.Undecrypted, stats.Invalid,
+			stats.Truncated, stats.Incomplete, stats.RateLimited)
+	}
+	for _, q := range quarantined(transport) {
+		logger.Warn("来源 %s 因发送过快被隔离，至 %s 解除", q.Key, q.Until.Format("15:04:05"))
+	}
+	if stats.Mismatched > 0 {
+		logger.Warn("有 %d 条消息的源地址与通告地址不一致", stats.Mismatched)
+	}
+	if stats.Oversize > 0 {
+		logger.Warn("有 %d 条消息超过最大长度未能发送", stats.Oversize)
+	}
+	if rejected := manager.RejectedCount(); rejected > 0 {
+		logger.Warn("已拒绝 %d 条过期或重复的消息", rejected)
+	}
+}
+
+// newRateLimiter 根据配置创建限流器，rate 为 0 表示不限流
+func newRateLimiter(rate float64, burst, quarantineSec int) *network.RateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return network.NewRateLimiter(rate, burst, time.Duration(quarantineSec)*time.Second)
+}
+
+// unicastPeerTimeout 单播模式下学习到的对端的过期时间
+// 节点较多时心跳间隔自适应增长到 maxHeartbeatIntervalSec（另有 ±20% 抖动），
+// 按最大间隔的 3 倍计算且不小于离线超时，学习到的对端不会在两次心跳之间过期
+func unicastPeerTimeout(cfg *config.Config) time.Duration {
+	interval := time.Duration(max(cfg.HeartbeatIntervalSec, cfg.MaxHeartbeatIntervalSec)) * time.Second
+	return max(time.Duration(cfg.OfflineTimeoutSec)*time.Second, 3*interval)
+}
+
+// writeState 写入运行状态快照，供 status 命令读取
+func writeState(transport network.Transport, manager *node.Manager) {
+	state := &internal.State{
+		PID:         os.Getpid(),
+		UpdatedAt:   time.Now(),
+		Stats:       transport.Stats(),
+		Rejected:    manager.RejectedCount(),
+		Quarantined: quarantined(transport),
+		Nodes:       nodeStates(manager),
+	}
+	if err := internal.WriteState(state); err != nil {
+		logger.Debug("写入运行状态失败: %v", err)
+	}
+}
+
+// nodeStates 节点快照，按域名排序
+func nodeStates(manager *node.Manager) []internal.NodeState {
+	nodes := manager.GetAll()
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Domain < nodes[j].Domain })
+
+	states := make([]internal.NodeState, 0, len(nodes))
+	for _, n := range nodes {
+		states = append(states, internal.NodeState{
+			Domain:   n.Domain,
+			IP:       n.IP,
+			IPv6:     n.IPv6,
+			Hostname: n.Hostname,
+			Online:   n.IsOnline(),
+			IsLocal:  n.IsLocal,
+			ReadOnly: n.ReadOnly,
+			Services: n.Services,
+			Labels:   n.Labels,
+		})
+	}
+	return states
+}
+
+// quarantined 当前被隔离的来源（仅组播传输层支持限流）
+func quarantined(transport network.Transport) []network.Quarantine {
+	if limited, ok := transport.(interface{ Quarantined() []network.Quarantine }); ok {
+		return limited.Quarantined()
+	}
+	return nil
+}
+
+// printClusterInfo 打印集群节点信息
+func printClusterInfo(manager *node.Manager) {
+	nodes := manager.GetAll()
+	if len(nodes) == 0 {
+		return
+	}
+
+	// 统计在线数量
+	onlineCount := manager.GetOnlineCount()
+
+	fmt.Println()
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	fmt.Printf("  集群节点列表 (总计 %d 个, 在线 %d 个, 离线 %d 个)\n",
+		len(nodes), onlineCount, len(nodes)-onlineCount)
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+
+	for _, n := range nodes {
+		var status string
+
+		if n.IsLocal {
+			status = "本机"
+		} else if n.State == node.StateSuspect {
+			status = "疑似离线"
+		} else if n.IsOnline() {
+			status = "在线"
+		} else {
+			status = "离线"
+		}
+
+		if n.ReadOnly {
+			status += ", mDNS"
+		}
+
+		// 始终显示真实 IP（hosts 文件中离线节点会映射到 127.0.0.1）
+		fmt.Printf("  %-30s -> %-15s [%s]\n", n.Domain, n.IP, status)
+	}
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	fmt.Println()
+}
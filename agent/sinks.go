@@ -0,0 +1,76 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/618lf/lanlink/config"
+	"github.com/618lf/lanlink/hosts"
+	"github.com/618lf/lanlink/logger"
+)
+
+// multiUpdater 把域名映射同时写入多个目标（hosts 文件和各导出文件）
+type multiUpdater []HostsUpdater
+
+// Set 设置域名对应的全部地址
+func (m multiUpdater) Set(domain string, ips []string) error {
+	var errs []error
+	for _, updater := range m {
+		errs = append(errs, updater.Set(domain, ips))
+	}
+	return errors.Join(errs...)
+}
+
+// AddOrUpdate 设置域名对应的单个地址
+func (m multiUpdater) AddOrUpdate(ip, domain string) error {
+	var errs []error
+	for _, updater := range m {
+		errs = append(errs, updater.AddOrUpdate(ip, domain))
+	}
+	return errors.Join(errs...)
+}
+
+// Remove 删除域名映射
+func (m multiUpdater) Remove(domain string) error {
+	var errs []error
+	for _, updater := range m {
+		errs = append(errs, updater.Remove(domain))
+	}
+	return errors.Join(errs...)
+}
+
+// newSinks 按配置创建导出器，并写入空的节点表
+func newSinks(cfg *config.Config) ([]*hosts.Sink, error) {
+	var sinks []*hosts.Sink
+	for _, sc := range cfg.Sinks {
+		sink, err := hosts.NewSink(sc.Format, sc.Path)
+		if err != nil {
+			return nil, err
+		}
+		sink.SetReload(sc.Reload)
+		sink.SetZone(cfg.DomainSuffix)
+		sink.SetTTL(cfg.DNSTTLSec)
+		if err := sink.Initialize(); err != nil {
+			return nil, fmt.Errorf("初始化 %s 失败: %v", sc.Path, err)
+		}
+		logger.Info("已启用节点表导出: %s (%s)", sc.Path, sc.Format)
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+// exportLocal 把本机写入导出文件
+// hosts 文件不需要本机条目，但导出文件通常供整个网络的 DNS 服务使用
+func (a *Agent) exportLocal() {
+	local := a.self.message("")
+	if !a.selector.Matches(local.Labels) {
+		return
+	}
+	ips := []string{local.IP}
+	if local.IPv6 != "" && local.IPv6 != local.IP {
+		ips = append(ips, local.IPv6)
+	}
+	for _, sink := range a.sinks {
+		sink.Set(local.Domain, ips)
+	}
+}
@@ -11,6 +11,9 @@ func ShowHelp() {
 
 用法:
   lanlink [选项]
+  lanlink relay             以中继模式运行（在多个网段之间转发心跳）
+  lanlink nodes [-l 选择器] 列出已知节点，可按标签筛选
+  lanlink services [名称]   列出各节点通告的服务，名称可以是节点域名或 SRV 记录名
 
 选项:
   (无参数)          启动服务（前台运行）
@@ -27,6 +30,10 @@ func ShowHelp() {
   lanlink --status       # 查看状态
   lanlink --stop         # 停止服务
   lanlink --uninstall    # 卸载服务
+  lanlink relay          # 在双网卡主机上桥接两个组播网段
+  lanlink nodes -l role=build-agent              # 列出标签 role=build-agent 的节点
+  lanlink services       # 列出全部服务
+  lanlink services _http._tcp.box.coobee.local   # 解析服务的地址和端口
 
 说明:
   LanLink 启动后会自动：
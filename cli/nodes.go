@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/618lf/lanlink/internal"
+	"github.com/618lf/lanlink/node"
+)
+
+// ShowNodes 显示已知节点（来自服务进程写入的运行状态快照），selector 为标签选择器，为空表示全部
+func ShowNodes(selector string) error {
+	sel, err := node.ParseSelector(selector)
+	if err != nil {
+		Error("%v", err)
+		return err
+	}
+	state, err := internal.GetState()
+	if err != nil {
+		Error("读取运行状态失败（服务是否在运行？）: %v", err)
+		return err
+	}
+	if time.Since(state.UpdatedAt) > time.Minute {
+		Warn("运行状态已过期（%s 前更新）", formatDuration(time.Since(state.UpdatedAt)))
+	}
+
+	Header("LanLink 节点列表")
+	matched := 0
+	for _, n := range state.Nodes {
+		if !sel.Matches(n.Labels) {
+			continue
+		}
+		matched++
+
+		status := color(ColorGreen, "在线")
+		if n.IsLocal {
+			status = color(ColorCyan, "本机")
+		} else if !n.Online {
+			status = color(ColorGray, "离线")
+		}
+		if n.ReadOnly {
+			status += ", mDNS"
+		}
+		fmt.Printf("  %-30s %-15s [%s] %s\n", n.Domain, n.IP, status, color(ColorGray, node.FormatLabels(n.Labels)))
+	}
+
+	fmt.Println()
+	if sel.Empty() {
+		KeyValue("节点", fmt.Sprintf("%d 个", matched))
+	} else {
+		KeyValue("匹配", fmt.Sprintf("%d 个（共 %d 个，选择器 %s）", matched, len(state.Nodes), sel))
+	}
+	Footer()
+	return nil
+}
@@ -0,0 +1,16 @@
+package cli
+
+import (
+	"github.com/618lf/lanlink/dns"
+)
+
+// RevertResolved 撤销 systemd-resolved 中 LanLink 链路的 DNS 配置，并删除 LanLink 创建的 dummy 链路（带有 lanlink 别名）
+func RevertResolved(link, bus string) error {
+	Section("还原 systemd-resolved 配置")
+	if err := dns.NewResolved(link, bus).Remove(); err != nil {
+		Warn("还原失败: %v", err)
+		return err
+	}
+	Success("已还原链路 %s 的 DNS 配置", link)
+	return nil
+}
@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/618lf/lanlink/internal"
+	"github.com/618lf/lanlink/network"
+)
+
+// ShowServices 显示集群中各节点通告的服务（来自服务进程写入的运行状态快照）
+// query 为空时列出全部节点；为节点域名时只列出该节点；
+// 为 SRV 记录名（如 _http._tcp.box.coobee.local）时解析出对应的地址和端口
+func ShowServices(query string) error {
+	state, err := internal.GetState()
+	if err != nil {
+		Error("读取运行状态失败（服务是否在运行？）: %v", err)
+		return err
+	}
+	if time.Since(state.UpdatedAt) > time.Minute {
+		Warn("运行状态已过期（%s 前更新）", formatDuration(time.Since(state.UpdatedAt)))
+	}
+
+	if service, proto, domain, ok := network.ParseSRVName(query); ok {
+		return resolveService(state, service, proto, domain)
+	}
+
+	Header("LanLink 服务列表")
+	count := 0
+	for _, n := range state.Nodes {
+		if query != "" && !strings.EqualFold(n.Domain, strings.TrimSuffix(query, ".")) {
+			continue
+		}
+		if len(n.Services) == 0 {
+			continue
+		}
+
+		status := "在线"
+		if n.IsLocal {
+			status = "本机"
+		} else if !n.Online {
+			status = "离线"
+		}
+		Section(fmt.Sprintf("%s (%s, %s)", n.Domain, n.IP, status))
+		for _, svc := range n.Services {
+			KeyValue(svc.String(), svc.SRVName(n.Domain))
+			count++
+		}
+	}
+	if count == 0 {
+		Warn("没有节点通告服务")
+	}
+	fmt.Println()
+	Footer()
+	return nil
+}
+
+// resolveService 按 SRV 记录名解析服务的地址和端口
+func resolveService(state *internal.State, service, proto, domain string) error {
+	n, ok := state.FindNode(domain)
+	if !ok {
+		err := fmt.Errorf("未知节点: %s", domain)
+		Error("%v", err)
+		return err
+	}
+	svc, ok := network.FindService(n.Services, service, proto)
+	if !ok {
+		err := fmt.Errorf("节点 %s 未通告服务 %s/%s", n.Domain, service, proto)
+		Error("%v", err)
+		return err
+	}
+
+	if !n.Online {
+		Warn("节点 %s 当前离线", n.Domain)
+	}
+	Success("%s -> %s:%d", svc.SRVName(n.Domain), n.Domain, svc.Port)
+	KeyValue("地址", n.IP)
+	if n.IPv6 != "" && n.IPv6 != n.IP {
+		KeyValue("IPv6", n.IPv6)
+	}
+	return nil
+}
@@ -26,6 +26,9 @@ func ShowStatus() error {
 		Success("域名: %s", fullDomain)
 		KeyValue("设备名", cfg.DeviceName)
 		KeyValue("域名后缀", cfg.DomainSuffix)
+		if len(cfg.Services) > 0 {
+			KeyValue("通告服务", strings.Join(cfg.Services, ", "))
+		}
 		
 		// 显示硬件信息
 		platform := hardware.GetPlatform()
@@ -99,7 +102,28 @@ func ShowStatus() error {
 		KeyValue("总节点", fmt.Sprintf("%d 个", len(nodes)))
 	}
 
-	// 5. 最近活动
+	// 5. 收包统计（来自服务进程写入的运行状态快照）
+	Section("收包统计")
+	state, err := internal.GetState()
+	if err != nil {
+		Warn("暂无运行状态数据")
+	} else {
+		if time.Since(state.UpdatedAt) > time.Minute {
+			Warn("运行状态已过期（%s 前更新）", formatDuration(time.Since(state.UpdatedAt)))
+		}
+		KeyValue("接收数据包", fmt.Sprintf("%d 个", state.Stats.Received))
+		KeyValue("丢弃数据包", fmt.Sprintf("%d 个", state.Stats.Dropped()))
+		KeyValue("限流丢弃", fmt.Sprintf("%d 个", state.Stats.RateLimited))
+		KeyValue("拒绝消息", fmt.Sprintf("%d 条（过期或重复）", state.Rejected))
+		if state.Stats.Mismatched > 0 {
+			Warn("%d 条消息的源地址与通告地址不一致（可能是伪造或经过 NAT）", state.Stats.Mismatched)
+		}
+		for _, q := range state.Quarantined {
+			Warn("隔离中: %s（%s 后解除）", q.Key, formatDuration(time.Until(q.Until)))
+		}
+	}
+
+	// 6. 最近活动
 	Section("最近活动")
 	logs, err := internal.GetRecentLogs(5)
 	if err == nil && len(logs) > 0 {
@@ -9,13 +9,55 @@ import (
 
 // Config 应用配置
 type Config struct {
-	DeviceName           string `json:"deviceName"`           // 设备名，空则基于硬件ID自动生成
-	DomainSuffix         string `json:"domainSuffix"`         // 域名后缀
-	MulticastAddr        string `json:"multicastAddr"`        // 组播地址
-	MulticastPort        int    `json:"multicastPort"`        // 组播端口
-	HeartbeatIntervalSec int    `json:"heartbeatIntervalSec"` // 心跳间隔（秒）
-	OfflineTimeoutSec    int    `json:"offlineTimeoutSec"`    // 离线超时（秒）
-	LogLevel             string `json:"logLevel"`             // 日志级别
+	DeviceName              string            `json:"deviceName"`              // 设备名，空则基于硬件ID自动生成
+	DomainSuffix            string            `json:"domainSuffix"`            // 域名后缀
+	Labels                  map[string]string `json:"labels"`                  // 本机标签，如 {"team": "backend", "role": "build-agent"}
+	HostsSelector           string            `json:"hostsSelector"`           // 只把标签匹配的节点写入 hosts（如 env=dev），为空表示全部
+	Services                []string          `json:"services"`                // 本机提供的服务，格式 name:port 或 name:port/udp，如 http:8080
+	HostsBackend            string            `json:"hostsBackend"`            // 域名映射写入方式: hosts(系统 hosts 文件)/none(不写入，只通过内置 DNS 解析)
+	DNSListen               string            `json:"dnsListen"`               // 内置 DNS 服务监听地址（如 127.0.0.1:53），为空表示不启用
+	DNSTTLSec               int               `json:"dnsTtlSec"`               // 内置 DNS 应答的 TTL（秒）
+	DNSUpstreams            []string          `json:"dnsUpstreams"`            // 内置 DNS 转发其他域名的上游服务器（IP 或 IP:端口），为空表示只解析域名后缀
+	DNSCacheSize            int               `json:"dnsCacheSize"`            // 上游应答的缓存条数，0 表示不缓存
+	Sinks                   []Sink            `json:"sinks"`                   // 把在线节点表导出为 dnsmasq、unbound、CoreDNS 的配置文件
+	Resolved                bool              `json:"resolved"`                // Linux: 通过 systemd-resolved 把域名后缀路由到内置 DNS（需要 dnsListen）
+	ResolvedLink            string            `json:"resolvedLink"`            // 注册 DNS 的链路，不存在时创建 dummy 链路（设置别名 lanlink，只删除带该别名的链路）
+	ResolvedBus             string            `json:"resolvedBus"`             // systemd-resolved 所在的 D-Bus 地址，为空表示系统总线
+	MulticastAddr           string            `json:"multicastAddr"`           // 组播地址
+	MulticastAddr6          string            `json:"multicastAddr6"`          // IPv6 组播地址（链路本地范围）
+	IPMode                  string            `json:"ipMode"`                  // IP 模式: ipv4/ipv6/dual
+	Interfaces              []string          `json:"interfaces"`              // 仅使用这些网卡（支持通配符），为空表示全部
+	ExcludeInterfaces       []string          `json:"excludeInterfaces"`       // 排除的网卡（支持通配符，如 docker*、veth*、br-*）
+	PreferredSubnets        []string          `json:"preferredSubnets"`        // 优先通告的网段（CIDR）
+	MulticastPort           int               `json:"multicastPort"`           // 组播端口
+	SeedPeers               []string          `json:"seedPeers"`               // 单播种子节点（host:port），用于组播不可用的网络；只有配置 clusterSecret（且未开启 acceptPlaintext）时节点间才转告对端
+	HeartbeatIntervalSec    int               `json:"heartbeatIntervalSec"`    // 心跳间隔（秒）
+	MaxHeartbeatIntervalSec int               `json:"maxHeartbeatIntervalSec"` // 节点较多时心跳间隔自适应增长的上限（秒）
+	OfflineTimeoutSec       int               `json:"offlineTimeoutSec"`       // 心跳超时（秒），超时后进入疑似离线状态
+	SuspicionTimeoutSec     int               `json:"suspicionTimeoutSec"`     // 疑似离线超时（秒），超时仍无存活证据则判定离线
+	ProbeIntervalSec        int               `json:"probeIntervalSec"`        // 故障检测探测周期（秒），0 表示关闭主动探测
+	IndirectProbes          int               `json:"indirectProbes"`          // 直接探测失败时请求代为探测的节点数
+	LogLevel                string            `json:"logLevel"`                // 日志级别
+	ClusterSecret           string            `json:"clusterSecret"`           // 集群共享密钥，为空则不签名
+	Encryption              string            `json:"encryption"`              // 加密模式: plain(明文，兼容旧版本)/aead
+	AcceptPlaintext         bool              `json:"acceptPlaintext"`         // 是否仍接收未签名的旧版本消息和（aead 模式下）明文消息（迁移期使用）
+	MaxClockSkewSec         int               `json:"maxClockSkewSec"`         // 允许的时钟偏差（秒），超出则视为重放，0 表示不检查
+	SourceRateLimit         float64           `json:"sourceRateLimit"`         // 每个源地址每秒允许的数据包数，0 表示不限流
+	SourceBurst             int               `json:"sourceBurst"`             // 每个源地址允许的突发数据包数
+	DeviceRateLimit         float64           `json:"deviceRateLimit"`         // 每个 DeviceID 每秒允许的消息数，0 表示不限流
+	DeviceBurst             int               `json:"deviceBurst"`             // 每个 DeviceID 允许的突发消息数
+	QuarantineSec           int               `json:"quarantineSec"`           // 超出限流后的隔离时长（秒）
+	NetworkPollSec          int               `json:"networkPollSec"`          // 无法订阅系统网络事件时轮询本机地址的间隔（秒），0 表示不监听网络变化
+	MDNS                    bool              `json:"mdns"`                    // 启用 mDNS：应答本机域名，并导入 Avahi/Bonjour 设备
+	MDNSServices            []string          `json:"mdnsServices"`            // mDNS 浏览的服务类型
+	MDNSBrowseSec           int               `json:"mdnsBrowseSec"`           // mDNS 浏览间隔（秒）
+}
+
+// Sink 节点表导出配置
+type Sink struct {
+	Format string `json:"format"` // 格式: dnsmasq(host-record)/dnsmasq-hosts(addn-hosts)/unbound(local-data)/coredns(hosts 插件)
+	Path   string `json:"path"`   // 导出文件路径
+	Reload string `json:"reload"` // 写入后执行的重新加载命令（如 systemctl reload dnsmasq），为空表示不执行
 }
 
 // Default 默认配置
@@ -28,13 +70,33 @@ func Default() *Config {
 	}
 
 	return &Config{
-		DeviceName:           deviceName,
-		DomainSuffix:         "coobee.local",
-		MulticastAddr:        "239.255.0.1",
-		MulticastPort:        9527,
-		HeartbeatIntervalSec: 10,
-		OfflineTimeoutSec:    30,
-		LogLevel:             "info",
+		DeviceName:              deviceName,
+		DomainSuffix:            "coobee.local",
+		HostsBackend:            "hosts",
+		DNSTTLSec:               10,
+		DNSCacheSize:            1000,
+		ResolvedLink:            "lanlink0",
+		MulticastAddr:           "239.255.0.1",
+		MulticastAddr6:          "ff02::4c4c",
+		IPMode:                  "ipv4",
+		MulticastPort:           9527,
+		HeartbeatIntervalSec:    10,
+		MaxHeartbeatIntervalSec: 60,
+		OfflineTimeoutSec:       30,
+		SuspicionTimeoutSec:     15,
+		ProbeIntervalSec:        5,
+		IndirectProbes:          3,
+		LogLevel:                "info",
+		Encryption:              "plain",
+		MaxClockSkewSec:         60,
+		SourceRateLimit:         50,
+		SourceBurst:             100,
+		DeviceRateLimit:         5,
+		DeviceBurst:             20,
+		QuarantineSec:           60,
+		NetworkPollSec:          10,
+		MDNSServices:            []string{"_workstation._tcp"},
+		MDNSBrowseSec:           60,
 	}
 }
 
@@ -77,4 +139,3 @@ func (c *Config) Save(path string) error {
 	}
 	return os.WriteFile(path, data, 0644)
 }
-
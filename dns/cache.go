@@ -0,0 +1,136 @@
+package dns
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// maxCacheTTL 缓存时间上限，上游 TTL 更长时按上限处理
+const maxCacheTTL = time.Hour
+
+// cacheEntry 缓存的应答（编码后保存，读取时解码出新的副本）
+type cacheEntry struct {
+	data    []byte
+	stored  time.Time
+	expires time.Time
+}
+
+// cache 上游应答缓存
+// 肯定应答按最小的记录 TTL 缓存，NXDOMAIN 和无数据应答按 SOA 的否定缓存时间缓存（RFC 2308）
+type cache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]cacheEntry
+}
+
+// newCache 创建缓存，size 为 0 时不缓存
+func newCache(size int) *cache {
+	return &cache{size: size, entries: make(map[string]cacheEntry)}
+}
+
+// cacheKey 缓存键：域名（不区分大小写）、类型和类
+func cacheKey(q dnsmessage.Question) string {
+	return fmt.Sprintf("%s/%d/%d", strings.ToLower(q.Name.String()), q.Type, q.Class)
+}
+
+// get 读取未过期的应答，记录的 TTL 扣除已缓存的时间
+func (c *cache) get(key string, now time.Time) (*dnsmessage.Message, bool) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok && !now.Before(entry.expires) {
+		delete(c.entries, key)
+		ok = false
+	}
+	c.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	var resp dnsmessage.Message
+	if err := resp.Unpack(entry.data); err != nil {
+		return nil, false
+	}
+	elapsed := uint32(now.Sub(entry.stored) / time.Second)
+	for _, section := range [][]dnsmessage.Resource{resp.Answers, resp.Authorities, resp.Additionals} {
+		for i := range section {
+			if section[i].Header.TTL > elapsed {
+				section[i].Header.TTL -= elapsed
+			} else {
+				section[i].Header.TTL = 0
+			}
+		}
+	}
+	return &resp, true
+}
+
+// put 缓存应答，不可缓存的应答（失败、截断、TTL 为 0）忽略
+func (c *cache) put(key string, resp *dnsmessage.Message, now time.Time) {
+	if c.size <= 0 {
+		return
+	}
+	ttl, ok := cacheTTL(resp)
+	if !ok {
+		return
+	}
+	data, err := resp.Pack()
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= c.size {
+		c.evict(now)
+	}
+	c.entries[key] = cacheEntry{data: data, stored: now, expires: now.Add(ttl)}
+}
+
+// evict 清理过期条目，仍然已满时淘汰最早过期的条目
+func (c *cache) evict(now time.Time) {
+	oldest := ""
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+			continue
+		}
+		if oldest == "" || entry.expires.Before(c.entries[oldest].expires) {
+			oldest = key
+		}
+	}
+	if len(c.entries) >= c.size && oldest != "" {
+		delete(c.entries, oldest)
+	}
+}
+
+// cacheTTL 应答的缓存时间
+func cacheTTL(resp *dnsmessage.Message) (time.Duration, bool) {
+	if resp.Truncated || (resp.RCode != dnsmessage.RCodeSuccess && resp.RCode != dnsmessage.RCodeNameError) {
+		return 0, false
+	}
+
+	var ttl uint32
+	found := false
+	if len(resp.Answers) > 0 && resp.RCode == dnsmessage.RCodeSuccess {
+		for _, r := range resp.Answers {
+			if !found || r.Header.TTL < ttl {
+				ttl, found = r.Header.TTL, true
+			}
+		}
+	} else {
+		// 否定应答的缓存时间取 SOA 记录 TTL 和 MINIMUM 中较小的值，没有 SOA 时不缓存
+		for _, r := range resp.Authorities {
+			if soa, ok := r.Body.(*dnsmessage.SOAResource); ok {
+				ttl, found = min(r.Header.TTL, soa.MinTTL), true
+				break
+			}
+		}
+	}
+	if !found || ttl == 0 {
+		return 0, false
+	}
+	return min(time.Duration(ttl)*time.Second, maxCacheTTL), true
+}
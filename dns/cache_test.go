@@ -0,0 +1,121 @@
+package dns
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestCacheTTLDecrement(t *testing.T) {
+	q := question("example.com.", dnsmessage.TypeA)
+	query := &dnsmessage.Message{Questions: []dnsmessage.Question{q}}
+	now := time.Now()
+
+	c := newCache(10)
+	c.put(cacheKey(q), answerA(query, [4]byte{1, 2, 3, 4}, 60), now)
+
+	resp, ok := c.get(cacheKey(q), now.Add(25*time.Second))
+	if !ok {
+		t.Fatal("未命中缓存")
+	}
+	if ttl := resp.Answers[0].Header.TTL; ttl != 35 {
+		t.Fatalf("TTL = %d, want 35", ttl)
+	}
+	if _, ok := c.get(cacheKey(q), now.Add(60*time.Second)); ok {
+		t.Fatal("过期的应答仍然命中")
+	}
+}
+
+func TestCacheNegative(t *testing.T) {
+	q := question("missing.example.com.", dnsmessage.TypeA)
+	query := &dnsmessage.Message{Questions: []dnsmessage.Question{q}}
+
+	// 否定应答按 SOA TTL 和 MINIMUM 中较小的值缓存
+	if ttl, ok := cacheTTL(nxdomain(query, 300, 60)); !ok || ttl != 60*time.Second {
+		t.Fatalf("cacheTTL = %v, %v, want 60s", ttl, ok)
+	}
+	if ttl, ok := cacheTTL(nxdomain(query, 30, 60)); !ok || ttl != 30*time.Second {
+		t.Fatalf("cacheTTL = %v, %v, want 30s", ttl, ok)
+	}
+
+	// 没有 SOA 的否定应答、失败和截断的应答不缓存
+	noSOA := nxdomain(query, 300, 60)
+	noSOA.Authorities = nil
+	failed := answerA(query, [4]byte{1, 2, 3, 4}, 60)
+	failed.RCode = dnsmessage.RCodeServerFailure
+	truncated := answerA(query, [4]byte{1, 2, 3, 4}, 60)
+	truncated.Truncated = true
+	for name, resp := range map[string]*dnsmessage.Message{"无 SOA": noSOA, "失败": failed, "截断": truncated} {
+		if _, ok := cacheTTL(resp); ok {
+			t.Errorf("%s的应答被缓存", name)
+		}
+	}
+
+	// 上游 TTL 过长时按上限缓存
+	if ttl, _ := cacheTTL(answerA(query, [4]byte{1, 2, 3, 4}, 86400)); ttl != maxCacheTTL {
+		t.Fatalf("cacheTTL = %v, want %v", ttl, maxCacheTTL)
+	}
+
+	now := time.Now()
+	c := newCache(10)
+	c.put(cacheKey(q), nxdomain(query, 300, 60), now)
+	resp, ok := c.get(cacheKey(q), now.Add(59*time.Second))
+	if !ok || resp.RCode != dnsmessage.RCodeNameError {
+		t.Fatal("否定应答未命中缓存")
+	}
+	if _, ok := c.get(cacheKey(q), now.Add(61*time.Second)); ok {
+		t.Fatal("否定应答超过 MINIMUM 后仍然命中")
+	}
+}
+
+func TestCacheEvict(t *testing.T) {
+	now := time.Now()
+	put := func(c *cache, name string, ttl uint32, at time.Time) dnsmessage.Question {
+		q := question(name, dnsmessage.TypeA)
+		c.put(cacheKey(q), answerA(&dnsmessage.Message{Questions: []dnsmessage.Question{q}}, [4]byte{1, 2, 3, 4}, ttl), at)
+		return q
+	}
+
+	// 已满时淘汰最早过期的条目
+	c := newCache(2)
+	short := put(c, "short.example.com.", 10, now)
+	long := put(c, "long.example.com.", 100, now)
+	added := put(c, "added.example.com.", 50, now)
+	if len(c.entries) != 2 {
+		t.Fatalf("entries = %d, want 2", len(c.entries))
+	}
+	if _, ok := c.get(cacheKey(short), now); ok {
+		t.Error("最早过期的条目未被淘汰")
+	}
+	for _, q := range []dnsmessage.Question{long, added} {
+		if _, ok := c.get(cacheKey(q), now); !ok {
+			t.Errorf("%s 被错误淘汰", q.Name)
+		}
+	}
+
+	// 有过期条目时只清理过期条目
+	c = newCache(2)
+	expired := put(c, "expired.example.com.", 10, now.Add(-time.Minute))
+	kept := put(c, "kept.example.com.", 10, now)
+	added = put(c, "added.example.com.", 100, now)
+	if _, ok := c.entries[cacheKey(expired)]; ok {
+		t.Error("过期条目未被清理")
+	}
+	for _, q := range []dnsmessage.Question{kept, added} {
+		if _, ok := c.get(cacheKey(q), now); !ok {
+			t.Errorf("%s 被错误淘汰", q.Name)
+		}
+	}
+
+	// 更新已有条目不触发淘汰，size 为 0 时不缓存
+	put(c, "kept.example.com.", 20, now)
+	if len(c.entries) != 2 {
+		t.Fatalf("entries = %d, want 2", len(c.entries))
+	}
+	c = newCache(0)
+	put(c, "example.com.", 10, now)
+	if len(c.entries) != 0 {
+		t.Fatal("size 为 0 时不应缓存")
+	}
+}
@@ -0,0 +1,180 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// upstreamTimeout 单个上游服务器的查询超时
+	upstreamTimeout = 2 * time.Second
+	// upstreamPort 上游服务器的默认端口
+	upstreamPort = "53"
+)
+
+// Forwarder 把不属于域名后缀的查询转发到上游 DNS，并缓存应答
+// 按配置顺序依次尝试上游，UDP 应答被截断时改用 TCP 重新查询
+type Forwarder struct {
+	upstreams []string
+	timeout   time.Duration
+	cache     *cache
+}
+
+// NewForwarder 创建转发器，upstreams 为 ParseUpstreams 解析后的地址，cacheSize 为 0 时不缓存
+func NewForwarder(upstreams []string, cacheSize int) *Forwarder {
+	return &Forwarder{
+		upstreams: upstreams,
+		timeout:   upstreamTimeout,
+		cache:     newCache(cacheSize),
+	}
+}
+
+// ParseUpstreams 解析上游 DNS 地址，格式为 IP 或 IP:端口（默认端口 53）
+// 只接受 IP 地址，避免解析上游地址本身又依赖 DNS。返回有效的地址和全部解析错误
+func ParseUpstreams(addrs []string) ([]string, error) {
+	var upstreams []string
+	var errs []error
+	for _, addr := range addrs {
+		addr = strings.TrimSpace(addr)
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			host, port = strings.Trim(addr, "[]"), upstreamPort
+		}
+		if net.ParseIP(host) == nil {
+			errs = append(errs, fmt.Errorf("上游 DNS 必须是 IP 地址: %s", addr))
+			continue
+		}
+		upstreams = append(upstreams, net.JoinHostPort(host, port))
+	}
+	return upstreams, errors.Join(errs...)
+}
+
+// Upstreams 上游服务器地址
+func (f *Forwarder) Upstreams() []string {
+	return f.upstreams
+}
+
+// Resolve 解析单个问题，命中缓存时直接返回（TTL 扣除已缓存的时间）
+func (f *Forwarder) Resolve(q dnsmessage.Question) (*dnsmessage.Message, error) {
+	key := cacheKey(q)
+	if resp, ok := f.cache.get(key, time.Now()); ok {
+		return resp, nil
+	}
+
+	resp, err := f.exchange(q)
+	if err != nil {
+		return nil, err
+	}
+	f.cache.put(key, resp, time.Now())
+	return resp, nil
+}
+
+// exchange 依次向上游查询，返回第一个有效应答
+func (f *Forwarder) exchange(q dnsmessage.Question) (*dnsmessage.Message, error) {
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: uint16(rand.Intn(1 << 16)), RecursionDesired: true},
+		Questions: []dnsmessage.Question{q},
+	}
+	var opt dnsmessage.ResourceHeader
+	if err := opt.SetEDNS0(maxEDNSSize, dnsmessage.RCodeSuccess, false); err == nil {
+		query.Additionals = []dnsmessage.Resource{{Header: opt, Body: &dnsmessage.OPTResource{}}}
+	}
+	data, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, upstream := range f.upstreams {
+		resp, err := f.exchangeUDP(upstream, data, &query)
+		if err == nil && resp.Truncated {
+			resp, err = f.exchangeTCP(upstream, data, &query)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", upstream, err))
+			continue
+		}
+		// 上游的 EDNS 记录只对本次连接有效，应答时按客户端的查询重新添加
+		resp.Additionals = withoutOPT(resp.Additionals)
+		return resp, nil
+	}
+	return nil, errors.Join(errs...)
+}
+
+// exchangeUDP 通过 UDP 查询，每次使用新的套接字（随机源端口），忽略 ID 或问题不匹配的应答
+func (f *Forwarder) exchangeUDP(upstream string, data []byte, query *dnsmessage.Message) (*dnsmessage.Message, error) {
+	conn, err := net.DialTimeout("udp", upstream, f.timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(f.timeout))
+
+	if _, err := conn.Write(data); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 65535)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		var resp dnsmessage.Message
+		if err := resp.Unpack(buf[:n]); err != nil || !matches(&resp, query) {
+			continue
+		}
+		return &resp, nil
+	}
+}
+
+// exchangeTCP 通过 TCP 查询
+func (f *Forwarder) exchangeTCP(upstream string, data []byte, query *dnsmessage.Message) (*dnsmessage.Message, error) {
+	conn, err := net.DialTimeout("tcp", upstream, f.timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(f.timeout))
+
+	if err := writeTCP(conn, data); err != nil {
+		return nil, err
+	}
+	buf, err := readTCP(conn)
+	if err != nil {
+		return nil, err
+	}
+	var resp dnsmessage.Message
+	if err := resp.Unpack(buf); err != nil {
+		return nil, err
+	}
+	if !matches(&resp, query) {
+		return nil, fmt.Errorf("应答与查询不匹配")
+	}
+	return &resp, nil
+}
+
+// matches 应答的 ID 和问题是否与查询一致
+func matches(resp, query *dnsmessage.Message) bool {
+	if !resp.Response || resp.ID != query.ID || len(resp.Questions) != 1 {
+		return false
+	}
+	q, r := query.Questions[0], resp.Questions[0]
+	return q.Type == r.Type && q.Class == r.Class && strings.EqualFold(q.Name.String(), r.Name.String())
+}
+
+// withoutOPT 去掉 EDNS 记录
+func withoutOPT(records []dnsmessage.Resource) []dnsmessage.Resource {
+	var kept []dnsmessage.Resource
+	for _, r := range records {
+		if r.Header.Type != dnsmessage.TypeOPT {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,276 @@
+package dns
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/618lf/lanlink/node"
+)
+
+// fakeUpstream 进程内的上游 DNS，UDP 和 TCP 监听同一端口
+// reply 返回对查询的应答，UDP 依次发送每条应答，TCP 只发送第一条
+type fakeUpstream struct {
+	addr    string
+	udp     net.PacketConn
+	tcp     net.Listener
+	queries atomic.Int32
+	reply   func(query *dnsmessage.Message, tcp bool) []*dnsmessage.Message
+}
+
+func newFakeUpstream(t *testing.T, reply func(query *dnsmessage.Message, tcp bool) []*dnsmessage.Message) *fakeUpstream {
+	t.Helper()
+	f := &fakeUpstream{reply: reply}
+	for i := 0; ; i++ {
+		udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+		if err != nil {
+			udp.Close()
+			if i < 10 {
+				continue
+			}
+			t.Fatal(err)
+		}
+		f.udp, f.tcp, f.addr = udp, tcp, udp.LocalAddr().String()
+		break
+	}
+	t.Cleanup(func() {
+		f.udp.Close()
+		f.tcp.Close()
+	})
+	go f.serveUDP()
+	go f.serveTCP()
+	return f
+}
+
+func (f *fakeUpstream) serveUDP() {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := f.udp.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		var query dnsmessage.Message
+		if err := query.Unpack(buf[:n]); err != nil {
+			continue
+		}
+		f.queries.Add(1)
+		for _, resp := range f.reply(&query, false) {
+			if data, err := resp.Pack(); err == nil {
+				f.udp.WriteTo(data, addr)
+			}
+		}
+	}
+}
+
+func (f *fakeUpstream) serveTCP() {
+	for {
+		conn, err := f.tcp.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			data, err := readTCP(conn)
+			if err != nil {
+				return
+			}
+			var query dnsmessage.Message
+			if err := query.Unpack(data); err != nil {
+				return
+			}
+			f.queries.Add(1)
+			if resps := f.reply(&query, true); len(resps) > 0 {
+				if data, err := resps[0].Pack(); err == nil {
+					writeTCP(conn, data)
+				}
+			}
+		}()
+	}
+}
+
+// answerA 对查询应答一条 A 记录
+func answerA(query *dnsmessage.Message, ip [4]byte, ttl uint32) *dnsmessage.Message {
+	return &dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: query.ID, Response: true, RecursionAvailable: true},
+		Questions: query.Questions,
+		Answers: []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{Name: query.Questions[0].Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: ttl},
+			Body:   &dnsmessage.AResource{A: ip},
+		}},
+	}
+}
+
+func question(name string, qtype dnsmessage.Type) dnsmessage.Question {
+	return dnsmessage.Question{Name: dnsmessage.MustNewName(name), Type: qtype, Class: dnsmessage.ClassINET}
+}
+
+// query 构造查询并交给服务端处理，返回解码后的应答
+func query(t *testing.T, s *Server, q dnsmessage.Question) *dnsmessage.Message {
+	t.Helper()
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: 42, RecursionDesired: true},
+		Questions: []dnsmessage.Question{q},
+	}
+	data, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp dnsmessage.Message
+	if err := resp.Unpack(s.handle(data, true)); err != nil {
+		t.Fatal(err)
+	}
+	return &resp
+}
+
+func TestSuffixNotForwarded(t *testing.T) {
+	upstream := newFakeUpstream(t, func(q *dnsmessage.Message, tcp bool) []*dnsmessage.Message {
+		return []*dnsmessage.Message{answerA(q, [4]byte{1, 2, 3, 4}, 60)}
+	})
+
+	manager := node.NewManager(30 * time.Second)
+	manager.AddOrUpdate(&node.Node{DeviceID: "a", Domain: "pc.coobee.local", IP: "10.0.0.1"})
+	s := NewServer("127.0.0.1:0", "coobee.local", manager)
+	s.SetForwarder(NewForwarder([]string{upstream.addr}, 100))
+
+	if resp := query(t, s, question("pc.coobee.local.", dnsmessage.TypeA)); resp.RCode != dnsmessage.RCodeSuccess || len(resp.Answers) != 1 {
+		t.Fatalf("节点域名: rcode=%v answers=%d", resp.RCode, len(resp.Answers))
+	}
+	if resp := query(t, s, question("missing.coobee.local.", dnsmessage.TypeA)); resp.RCode != dnsmessage.RCodeNameError {
+		t.Fatalf("未知域名: rcode=%v", resp.RCode)
+	}
+	if n := upstream.queries.Load(); n != 0 {
+		t.Fatalf("域名后缀下的查询发往了上游 %d 次", n)
+	}
+
+	resp := query(t, s, question("example.com.", dnsmessage.TypeA))
+	if resp.RCode != dnsmessage.RCodeSuccess || len(resp.Answers) != 1 || !resp.RecursionAvailable {
+		t.Fatalf("转发: rcode=%v answers=%d", resp.RCode, len(resp.Answers))
+	}
+	if n := upstream.queries.Load(); n != 1 {
+		t.Fatalf("上游查询次数 = %d, want 1", n)
+	}
+}
+
+func TestForwarderFallback(t *testing.T) {
+	// 第一个上游不应答，超时后改用第二个
+	silent := newFakeUpstream(t, func(*dnsmessage.Message, bool) []*dnsmessage.Message { return nil })
+	working := newFakeUpstream(t, func(q *dnsmessage.Message, tcp bool) []*dnsmessage.Message {
+		return []*dnsmessage.Message{answerA(q, [4]byte{1, 2, 3, 4}, 60)}
+	})
+
+	f := NewForwarder([]string{silent.addr, working.addr}, 0)
+	f.timeout = 200 * time.Millisecond
+	resp, err := f.Resolve(question("example.com.", dnsmessage.TypeA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Answers) != 1 {
+		t.Fatalf("answers = %d", len(resp.Answers))
+	}
+	if silent.queries.Load() != 1 || working.queries.Load() != 1 {
+		t.Fatalf("查询次数: %d, %d", silent.queries.Load(), working.queries.Load())
+	}
+
+	// 全部失败时返回错误
+	f = NewForwarder([]string{silent.addr}, 0)
+	f.timeout = 200 * time.Millisecond
+	if _, err := f.Resolve(question("example.com.", dnsmessage.TypeA)); err == nil {
+		t.Fatal("所有上游都失败时应返回错误")
+	}
+}
+
+func TestForwarderTCPRetry(t *testing.T) {
+	var tcpQueries atomic.Int32
+	upstream := newFakeUpstream(t, func(q *dnsmessage.Message, tcp bool) []*dnsmessage.Message {
+		resp := answerA(q, [4]byte{1, 2, 3, 4}, 60)
+		if !tcp {
+			resp.Truncated = true
+			resp.Answers = nil
+			return []*dnsmessage.Message{resp}
+		}
+		tcpQueries.Add(1)
+		return []*dnsmessage.Message{resp}
+	})
+
+	resp, err := NewForwarder([]string{upstream.addr}, 0).Resolve(question("example.com.", dnsmessage.TypeA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Truncated || len(resp.Answers) != 1 {
+		t.Fatalf("truncated=%v answers=%d", resp.Truncated, len(resp.Answers))
+	}
+	if tcpQueries.Load() != 1 {
+		t.Fatalf("TCP 查询次数 = %d, want 1", tcpQueries.Load())
+	}
+}
+
+func TestForwarderIgnoresMismatch(t *testing.T) {
+	upstream := newFakeUpstream(t, func(q *dnsmessage.Message, tcp bool) []*dnsmessage.Message {
+		// 先发送 ID 不匹配和问题不匹配的应答（伪造或迟到的应答），最后才是正确的应答
+		wrongID := answerA(q, [4]byte{6, 6, 6, 6}, 60)
+		wrongID.ID++
+		wrongQuestion := answerA(q, [4]byte{7, 7, 7, 7}, 60)
+		wrongQuestion.Questions = []dnsmessage.Question{question("evil.com.", dnsmessage.TypeA)}
+		return []*dnsmessage.Message{wrongID, wrongQuestion, answerA(q, [4]byte{1, 2, 3, 4}, 60)}
+	})
+
+	resp, err := NewForwarder([]string{upstream.addr}, 0).Resolve(question("example.com.", dnsmessage.TypeA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Answers) != 1 || resp.Answers[0].Body.(*dnsmessage.AResource).A != [4]byte{1, 2, 3, 4} {
+		t.Fatalf("answers = %+v", resp.Answers)
+	}
+}
+
+func TestForwarderCache(t *testing.T) {
+	upstream := newFakeUpstream(t, func(q *dnsmessage.Message, tcp bool) []*dnsmessage.Message {
+		if q.Questions[0].Name.String() == "missing.example.com." {
+			return []*dnsmessage.Message{nxdomain(q, 300, 60)}
+		}
+		return []*dnsmessage.Message{answerA(q, [4]byte{1, 2, 3, 4}, 60)}
+	})
+	f := NewForwarder([]string{upstream.addr}, 100)
+
+	for i := 0; i < 3; i++ {
+		if _, err := f.Resolve(question("Example.COM.", dnsmessage.TypeA)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Resolve(question("missing.example.com.", dnsmessage.TypeA)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 肯定应答和否定应答都只查询一次上游，域名不区分大小写
+	if n := upstream.queries.Load(); n != 2 {
+		t.Fatalf("上游查询次数 = %d, want 2", n)
+	}
+	if _, err := f.Resolve(question("example.com.", dnsmessage.TypeAAAA)); err != nil {
+		t.Fatal(err)
+	}
+	if n := upstream.queries.Load(); n != 3 {
+		t.Fatalf("不同类型应分别缓存，上游查询次数 = %d, want 3", n)
+	}
+}
+
+// nxdomain 构造带 SOA 的 NXDOMAIN 应答
+func nxdomain(query *dnsmessage.Message, ttl, minTTL uint32) *dnsmessage.Message {
+	return &dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: query.ID, Response: true, RCode: dnsmessage.RCodeNameError},
+		Questions: query.Questions,
+		Authorities: []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName("example.com."), Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET, TTL: ttl},
+			Body: &dnsmessage.SOAResource{
+				NS:     dnsmessage.MustNewName("ns.example.com."),
+				MBox:   dnsmessage.MustNewName("hostmaster.example.com."),
+				MinTTL: minTTL,
+			},
+		}},
+	}
+}
@@ -0,0 +1,61 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+)
+
+// resolvedLinkAlias LanLink 创建的链路的别名，清理时只删除带有该别名的链路
+const resolvedLinkAlias = "lanlink"
+
+// Resolved 通过 systemd-resolved 把域名后缀路由到内置 DNS（仅 Linux）
+// 在专用链路上设置 DNS 服务器和路由域名 ~{suffix}：只有该后缀的查询发往 LanLink，其他域名仍按系统原有配置解析
+type Resolved struct {
+	link    string
+	bus     string
+	ifindex int
+	created bool // 链路是否由 LanLink 创建
+
+	run    func(name string, args ...string) ([]byte, error) // 执行 busctl 和 ip 命令，返回合并的输出
+	lookup func(name string) (int, error)                    // 查找链路的 ifindex
+}
+
+// NewResolved 创建 systemd-resolved 集成
+// link 为注册 DNS 的链路，不存在时创建 dummy 链路；bus 为 D-Bus 地址（如 unix:path=/run/dbus/system_bus_socket），为空表示系统总线
+func NewResolved(link, bus string) *Resolved {
+	return &Resolved{link: link, bus: bus, run: execCommand, lookup: interfaceIndex}
+}
+
+// Link 注册 DNS 的链路名
+func (r *Resolved) Link() string {
+	return r.link
+}
+
+// ValidateResolvedListen 校验注册到 systemd-resolved 的 DNS 监听地址，返回 DNS 服务器地址
+// systemd-resolved 不使用只有回环地址的链路，LanLink 创建的链路上需要添加监听地址，
+// 因此监听地址必须是明确的非回环地址（如 10.53.53.53:53），不能是回环地址或全部地址
+func ValidateResolvedListen(listen string) (*net.UDPAddr, error) {
+	server, err := net.ResolveUDPAddr("udp", listen)
+	if err != nil || server.Port == 0 {
+		return nil, fmt.Errorf("无效的 DNS 监听地址: %s", listen)
+	}
+	if server.IP == nil || server.IP.IsUnspecified() || server.IP.IsLoopback() {
+		return nil, fmt.Errorf("启用 resolved 时 DNS 监听地址必须是非回环地址（如 10.53.53.53:53）: %s", listen)
+	}
+	return server, nil
+}
+
+// execCommand 执行命令并返回合并的标准输出和错误输出
+func execCommand(name string, args ...string) ([]byte, error) {
+	return exec.Command(name, args...).CombinedOutput()
+}
+
+// interfaceIndex 按名称查找网卡的 ifindex
+func interfaceIndex(name string) (int, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return 0, err
+	}
+	return iface.Index, nil
+}
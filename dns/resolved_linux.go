@@ -0,0 +1,177 @@
+//go:build linux
+
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/618lf/lanlink/logger"
+)
+
+const (
+	resolvedService   = "org.freedesktop.resolve1"
+	resolvedPath      = "/org/freedesktop/resolve1"
+	resolvedInterface = "org.freedesktop.resolve1.Manager"
+)
+
+// Register 在链路上注册 DNS 服务器（listen 为内置 DNS 的监听地址）和路由域名
+// 链路不存在时创建 dummy 链路，并把监听地址添加到链路上（systemd-resolved 只使用有可路由地址的链路），
+// 因此需要在内置 DNS 开始监听之前调用，监听地址不能是回环地址（见 ValidateResolvedListen）。失败时撤销已完成的步骤
+func (r *Resolved) Register(listen, suffix string) error {
+	server, err := ValidateResolvedListen(listen)
+	if err != nil {
+		return err
+	}
+
+	if err := r.ensureLink(server.IP); err != nil {
+		return err
+	}
+	if err := r.register(server, strings.Trim(suffix, ".")); err != nil {
+		r.Revert()
+		return err
+	}
+	return nil
+}
+
+// Revert 撤销链路上的 DNS 配置，链路由 LanLink 创建时一并删除
+func (r *Resolved) Revert() error {
+	if r.ifindex == 0 {
+		return nil
+	}
+	err := r.call("RevertLink", "i", strconv.Itoa(r.ifindex))
+	if r.created {
+		if e := r.runIP("link", "delete", r.link); e != nil {
+			err = errors.Join(err, fmt.Errorf("删除链路 %s 失败: %v", r.link, e))
+		}
+		r.created = false
+	}
+	r.ifindex = 0
+	return err
+}
+
+// Remove 撤销链路上的 DNS 配置，链路由 LanLink 创建时删除，用于卸载时清理服务异常退出后残留的配置
+// 用户指定的已有链路（如 eth0 或其他程序创建的 dummy 链路）只撤销 DNS 配置，不删除
+func (r *Resolved) Remove() error {
+	ifindex, err := r.lookup(r.link)
+	if err != nil {
+		return nil // 链路不存在，无需清理
+	}
+	r.ifindex = ifindex
+	r.created = r.owned()
+	return r.Revert()
+}
+
+// ensureLink 查找链路，不存在时创建 dummy 链路，设置别名标记为 LanLink 创建，并添加服务器地址
+// 链路已存在且带有该别名时（上次运行异常退出后残留），同样视为 LanLink 创建，撤销时删除
+func (r *Resolved) ensureLink(ip net.IP) error {
+	ifindex, err := r.lookup(r.link)
+	if err == nil {
+		r.ifindex = ifindex
+		r.created = r.owned()
+		return nil
+	}
+
+	if err := r.runIP("link", "add", r.link, "type", "dummy"); err != nil {
+		return fmt.Errorf("创建链路 %s 失败: %v", r.link, err)
+	}
+	r.created = true
+	if r.ifindex, err = r.lookup(r.link); err != nil {
+		r.created = false
+		r.runIP("link", "delete", r.link)
+		return err
+	}
+
+	prefix := ip.String() + "/32"
+	if ip.To4() == nil {
+		prefix = ip.String() + "/128"
+	}
+	steps := [][]string{
+		{"link", "set", r.link, "alias", resolvedLinkAlias},
+		{"link", "set", r.link, "up"},
+		{"addr", "add", prefix, "dev", r.link},
+	}
+	for _, args := range steps {
+		if err := r.runIP(args...); err != nil {
+			r.Revert()
+			return fmt.Errorf("配置链路 %s 失败: %v", r.link, err)
+		}
+	}
+	return nil
+}
+
+// register 设置链路的 DNS 服务器和路由域名，并禁止该链路作为默认 DNS 路由
+func (r *Resolved) register(server *net.UDPAddr, suffix string) error {
+	ifindex := strconv.Itoa(r.ifindex)
+
+	family, addr := "2", server.IP.To4() // AF_INET
+	if addr == nil {
+		family, addr = "10", server.IP.To16() // AF_INET6
+	}
+	args := []string{ifindex, "1", family, strconv.Itoa(len(addr))}
+	for _, b := range addr {
+		args = append(args, strconv.Itoa(int(b)))
+	}
+	// 非 53 端口需要 SetLinkDNSEx（systemd 246 及以上）
+	if server.Port == 53 {
+		if err := r.call("SetLinkDNS", "ia(iay)", args...); err != nil {
+			return err
+		}
+	} else if err := r.call("SetLinkDNSEx", "ia(iayqs)", append(args, strconv.Itoa(server.Port), "")...); err != nil {
+		return err
+	}
+
+	if err := r.call("SetLinkDomains", "ia(sb)", ifindex, "1", suffix, "true"); err != nil {
+		return err
+	}
+	// 旧版本不支持，失败不影响按域名路由
+	if err := r.call("SetLinkDefaultRoute", "ib", ifindex, "false"); err != nil {
+		logger.Debug("设置默认路由失败: %v", err)
+	}
+	return nil
+}
+
+// call 通过 busctl 调用 systemd-resolved 的方法
+func (r *Resolved) call(method, signature string, args ...string) error {
+	var cmdArgs []string
+	if r.bus != "" {
+		cmdArgs = append(cmdArgs, "--address="+r.bus)
+	}
+	cmdArgs = append(cmdArgs, "call", resolvedService, resolvedPath, resolvedInterface, method, signature)
+	cmdArgs = append(cmdArgs, args...)
+
+	if output, err := r.run("busctl", cmdArgs...); err != nil {
+		return fmt.Errorf("%s: %v: %s", method, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// runIP 执行 ip 命令
+func (r *Resolved) runIP(args ...string) error {
+	if output, err := r.run("ip", args...); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// owned 链路是否由 LanLink 创建：dummy 链路且别名为 resolvedLinkAlias
+func (r *Resolved) owned() bool {
+	output, err := r.run("ip", "-d", "-o", "link", "show", "dev", r.link)
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(output))
+	alias, dummy := false, false
+	for i, field := range fields {
+		if field == "alias" && i+1 < len(fields) && fields[i+1] == resolvedLinkAlias {
+			alias = true
+		}
+		if field == "dummy" {
+			dummy = true
+		}
+	}
+	return alias && dummy
+}
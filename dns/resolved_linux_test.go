@@ -0,0 +1,208 @@
+//go:build linux
+
+package dns
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeSystem 记录执行的 busctl 和 ip 命令，模拟链路的创建和删除
+type fakeSystem struct {
+	links    map[string]string // 链路名 -> ip -d -o link show 的输出
+	commands [][]string
+	fail     string // 执行包含该参数的命令时失败
+}
+
+func newFakeResolved(sys *fakeSystem, link, bus string) *Resolved {
+	r := NewResolved(link, bus)
+	r.run = sys.run
+	r.lookup = sys.lookup
+	return r
+}
+
+func (s *fakeSystem) run(name string, args ...string) ([]byte, error) {
+	command := append([]string{name}, args...)
+	s.commands = append(s.commands, command)
+	if s.fail != "" {
+		for _, arg := range args {
+			if arg == s.fail {
+				return []byte("failed"), errors.New("exit status 1")
+			}
+		}
+	}
+	if name != "ip" {
+		return nil, nil
+	}
+	switch {
+	case len(args) >= 5 && args[0] == "link" && args[1] == "add":
+		s.links[args[2]] = "9: " + args[2] + ": <BROADCAST,NOARP> mtu 1500 \\    link/ether 00:00:00:00:00:00 brd ff:ff:ff:ff:ff:ff \\    dummy addrgenmode eui64"
+	case len(args) == 5 && args[0] == "link" && args[3] == "alias":
+		s.links[args[2]] = strings.Replace(s.links[args[2]], " \\    dummy", " \\    alias "+args[4]+" \\    dummy", 1)
+	case len(args) == 3 && args[0] == "link" && args[1] == "delete":
+		delete(s.links, args[2])
+	case len(args) == 6 && args[0] == "-d" && args[3] == "show":
+		output, ok := s.links[args[5]]
+		if !ok {
+			return []byte("Device does not exist"), errors.New("exit status 1")
+		}
+		return []byte(output), nil
+	}
+	return nil, nil
+}
+
+func (s *fakeSystem) lookup(name string) (int, error) {
+	if _, ok := s.links[name]; !ok {
+		return 0, errors.New("no such network interface")
+	}
+	return 9, nil
+}
+
+// busctl 命令的参数
+func busctl(method, signature string, args ...string) []string {
+	return append([]string{"busctl", "call", resolvedService, resolvedPath, resolvedInterface, method, signature}, args...)
+}
+
+func TestResolvedRegister(t *testing.T) {
+	tests := []struct {
+		name   string
+		listen string
+		dns    []string
+	}{
+		{"53 端口", "10.53.53.53:53",
+			busctl("SetLinkDNS", "ia(iay)", "9", "1", "2", "4", "10", "53", "53", "53")},
+		{"其他端口", "10.53.53.53:5353",
+			busctl("SetLinkDNSEx", "ia(iayqs)", "9", "1", "2", "4", "10", "53", "53", "53", "5353", "")},
+		{"IPv6", "[fd00::53]:53",
+			busctl("SetLinkDNS", "ia(iay)", "9", "1", "10", "16", "253", "0", "0", "0", "0", "0", "0", "0", "0", "0", "0", "0", "0", "0", "0", "83")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sys := &fakeSystem{links: map[string]string{}}
+			r := newFakeResolved(sys, "lanlink0", "")
+			if err := r.Register(tt.listen, ".coobee.local."); err != nil {
+				t.Fatal(err)
+			}
+
+			want := [][]string{
+				{"ip", "link", "add", "lanlink0", "type", "dummy"},
+				{"ip", "link", "set", "lanlink0", "alias", resolvedLinkAlias},
+				{"ip", "link", "set", "lanlink0", "up"},
+			}
+			prefix := "10.53.53.53/32"
+			if strings.HasPrefix(tt.listen, "[") {
+				prefix = "fd00::53/128"
+			}
+			want = append(want,
+				[]string{"ip", "addr", "add", prefix, "dev", "lanlink0"},
+				tt.dns,
+				busctl("SetLinkDomains", "ia(sb)", "9", "1", "coobee.local", "true"),
+				busctl("SetLinkDefaultRoute", "ib", "9", "false"),
+			)
+			if !reflect.DeepEqual(sys.commands, want) {
+				t.Fatalf("commands =\n%q\nwant\n%q", sys.commands, want)
+			}
+
+			// 撤销时恢复链路配置并删除创建的链路
+			sys.commands = nil
+			if err := r.Revert(); err != nil {
+				t.Fatal(err)
+			}
+			want = [][]string{
+				busctl("RevertLink", "i", "9"),
+				{"ip", "link", "delete", "lanlink0"},
+			}
+			if !reflect.DeepEqual(sys.commands, want) {
+				t.Fatalf("commands =\n%q\nwant\n%q", sys.commands, want)
+			}
+			if _, ok := sys.links["lanlink0"]; ok {
+				t.Fatal("链路未删除")
+			}
+		})
+	}
+}
+
+func TestResolvedRegisterLoopback(t *testing.T) {
+	// 回环地址和全部地址无法添加到链路上，systemd-resolved 不会使用该链路，不创建链路直接返回错误
+	for _, listen := range []string{"127.0.0.1:53", "[::1]:53", "0.0.0.0:53", ":53", "[::]:5353", "10.53.53.53:0", "invalid"} {
+		sys := &fakeSystem{links: map[string]string{}}
+		if err := newFakeResolved(sys, "lanlink0", "").Register(listen, "coobee.local"); err == nil {
+			t.Errorf("Register(%q) 应返回错误", listen)
+		}
+		if len(sys.commands) != 0 {
+			t.Errorf("Register(%q) 执行了命令: %q", listen, sys.commands)
+		}
+	}
+}
+
+func TestResolvedRegisterFailure(t *testing.T) {
+	// 设置 DNS 失败时撤销配置并删除创建的链路
+	sys := &fakeSystem{links: map[string]string{}, fail: "SetLinkDNS"}
+	r := newFakeResolved(sys, "lanlink0", "unix:path=/run/dbus/system_bus_socket")
+	if err := r.Register("10.53.53.53:53", "coobee.local"); err == nil {
+		t.Fatal("Register 应返回错误")
+	}
+	if _, ok := sys.links["lanlink0"]; ok {
+		t.Fatal("失败后链路未删除")
+	}
+	last := sys.commands[len(sys.commands)-2]
+	want := []string{"busctl", "--address=unix:path=/run/dbus/system_bus_socket", "call", resolvedService, resolvedPath, resolvedInterface, "RevertLink", "i", "9"}
+	if !reflect.DeepEqual(last, want) {
+		t.Fatalf("command = %q, want %q", last, want)
+	}
+}
+
+func TestResolvedRemove(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		deleted bool
+	}{
+		{"LanLink 创建的链路", "9: lanlink0: <BROADCAST,NOARP> mtu 1500 \\    link/ether 00:00:00:00:00:00 brd ff:ff:ff:ff:ff:ff \\    alias lanlink \\    dummy addrgenmode eui64", true},
+		{"其他程序创建的 dummy 链路", "9: lanlink0: <BROADCAST,NOARP> mtu 1500 \\    link/ether 00:00:00:00:00:00 brd ff:ff:ff:ff:ff:ff \\    dummy addrgenmode eui64", false},
+		{"别名相同的物理网卡", "9: lanlink0: <BROADCAST,MULTICAST,UP> mtu 1500 \\    link/ether 52:54:00:12:34:56 brd ff:ff:ff:ff:ff:ff \\    alias lanlink", false},
+		{"其他别名", "9: lanlink0: <BROADCAST,NOARP> mtu 1500 \\    link/ether 00:00:00:00:00:00 brd ff:ff:ff:ff:ff:ff \\    alias lanlink-old \\    dummy addrgenmode eui64", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sys := &fakeSystem{links: map[string]string{"lanlink0": tt.output}}
+			if err := newFakeResolved(sys, "lanlink0", "").Remove(); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(sys.commands[1], busctl("RevertLink", "i", "9")) {
+				t.Fatalf("command = %q", sys.commands[1])
+			}
+			if _, ok := sys.links["lanlink0"]; ok == tt.deleted {
+				t.Fatalf("deleted = %v, want %v", !ok, tt.deleted)
+			}
+		})
+	}
+
+	// 链路不存在时无需清理
+	sys := &fakeSystem{links: map[string]string{}}
+	if err := newFakeResolved(sys, "lanlink0", "").Remove(); err != nil || len(sys.commands) != 0 {
+		t.Fatalf("err = %v, commands = %q", err, sys.commands)
+	}
+}
+
+func TestResolvedExistingLink(t *testing.T) {
+	// 使用已有的链路时不创建也不删除
+	sys := &fakeSystem{links: map[string]string{"eth0": "2: eth0: <BROADCAST,MULTICAST,UP> mtu 1500 \\    link/ether 52:54:00:12:34:56 brd ff:ff:ff:ff:ff:ff"}}
+	r := newFakeResolved(sys, "eth0", "")
+	if err := r.Register("10.53.53.53:53", "coobee.local"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Revert(); err != nil {
+		t.Fatal(err)
+	}
+	for _, command := range sys.commands {
+		if command[0] == "ip" && command[1] != "-d" {
+			t.Fatalf("修改了已有的链路: %q", command)
+		}
+	}
+	if _, ok := sys.links["eth0"]; !ok {
+		t.Fatal("已有的链路被删除")
+	}
+}
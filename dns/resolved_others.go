@@ -0,0 +1,20 @@
+//go:build !linux
+
+package dns
+
+import "errors"
+
+// Register 非 Linux 平台没有 systemd-resolved
+func (r *Resolved) Register(listen, suffix string) error {
+	return errors.New("当前平台不支持 systemd-resolved")
+}
+
+// Revert 非 Linux 平台无需撤销
+func (r *Resolved) Revert() error {
+	return nil
+}
+
+// Remove 非 Linux 平台无需清理
+func (r *Resolved) Remove() error {
+	return nil
+}
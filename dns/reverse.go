@@ -0,0 +1,72 @@
+package dns
+
+import (
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// reverseV4 IPv4 反向解析域名的后缀
+	reverseV4 = ".in-addr.arpa."
+	// reverseV6 IPv6 反向解析域名的后缀
+	reverseV6 = ".ip6.arpa."
+)
+
+// answerPTR 为集群节点的地址应答 PTR 记录，返回 false 表示地址不属于任何在线节点
+func (s *Server) answerPTR(q dnsmessage.Question, ip net.IP, resp *dnsmessage.Message) bool {
+	n, ok := s.manager.FindByAddress(ip)
+	if !ok || !n.IsOnline() || (s.filter != nil && !s.filter(n)) {
+		return false
+	}
+	resp.Authoritative = true
+	if q.Type != dnsmessage.TypePTR && q.Type != dnsmessage.TypeALL {
+		return true
+	}
+
+	target, err := dnsmessage.NewName(strings.ToLower(n.Domain) + ".")
+	if err != nil {
+		return true
+	}
+	resp.Answers = append(resp.Answers, dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET, TTL: s.ttl},
+		Body:   &dnsmessage.PTRResource{PTR: target},
+	})
+	return true
+}
+
+// parseReverse 解析反向解析域名，如 2.0.0.10.in-addr.arpa. 解析为 10.0.0.2
+// 只接受完整的地址（IPv4 四段、IPv6 32 个半字节），网段形式的域名返回 false
+func parseReverse(name string) (net.IP, bool) {
+	switch {
+	case strings.HasSuffix(name, reverseV4):
+		labels := strings.Split(strings.TrimSuffix(name, reverseV4), ".")
+		if len(labels) != net.IPv4len {
+			return nil, false
+		}
+		slices.Reverse(labels)
+		ip := net.ParseIP(strings.Join(labels, "."))
+		return ip, ip != nil && ip.To4() != nil
+
+	case strings.HasSuffix(name, reverseV6):
+		nibbles := strings.Split(strings.TrimSuffix(name, reverseV6), ".")
+		if len(nibbles) != net.IPv6len*2 {
+			return nil, false
+		}
+		ip := make(net.IP, net.IPv6len)
+		for i, nibble := range nibbles {
+			v, err := strconv.ParseUint(nibble, 16, 4)
+			if err != nil || len(nibble) != 1 {
+				return nil, false
+			}
+			// 最低位的半字节在最前面
+			pos := len(nibbles) - 1 - i
+			ip[pos/2] |= byte(v) << (4 * (1 - pos%2))
+		}
+		return ip, true
+	}
+	return nil, false
+}
@@ -0,0 +1,84 @@
+package dns
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/618lf/lanlink/network"
+	"github.com/618lf/lanlink/node"
+)
+
+func TestParseReverse(t *testing.T) {
+	v6 := "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.d.f.ip6.arpa."
+	tests := []struct {
+		name string
+		want string // 为空表示解析失败
+	}{
+		{"2.0.0.10.in-addr.arpa.", "10.0.0.2"},
+		{"255.1.168.192.in-addr.arpa.", "192.168.1.255"},
+		{v6, "fd00::1"},
+		{"b.a.9.8.7.6.5.0.4.0.0.0.3.0.0.0.2.0.0.0.1.0.0.0.0.0.0.0.1.2.3.4.ip6.arpa.", "4321:0:1:2:3:4:567:89ab"},
+		{"0.0.10.in-addr.arpa.", ""},
+		{"1.2.0.0.10.in-addr.arpa.", ""},
+		{"256.0.0.10.in-addr.arpa.", ""},
+		{"x.0.0.10.in-addr.arpa.", ""},
+		{".0.0.10.in-addr.arpa.", ""},
+		{"in-addr.arpa.", ""},
+		{v6[2:], ""},
+		{"0." + v6, ""},
+		{"g" + v6[1:], ""},
+		{"10" + v6[1:], ""},
+		{"2.0.0.10.example.com.", ""},
+		{"pc.coobee.local.", ""},
+	}
+	for _, tt := range tests {
+		ip, ok := parseReverse(tt.name)
+		if tt.want == "" {
+			if ok {
+				t.Errorf("parseReverse(%q) = %v，期望解析失败", tt.name, ip)
+			}
+			continue
+		}
+		if !ok || !ip.Equal(net.ParseIP(tt.want)) {
+			t.Errorf("parseReverse(%q) = %v, %v，期望 %s", tt.name, ip, ok, tt.want)
+		}
+	}
+}
+
+// TestReverseForwardsUnknown 节点使用的地址本地应答 PTR，其他地址（包括节点上报但未使用的地址）转发上游
+func TestReverseForwardsUnknown(t *testing.T) {
+	upstream := newFakeUpstream(t, func(q *dnsmessage.Message, tcp bool) []*dnsmessage.Message {
+		return []*dnsmessage.Message{nxdomain(q, 300, 60)}
+	})
+
+	manager := node.NewManager(30 * time.Second)
+	manager.AddOrUpdate(&node.Node{
+		DeviceID: "a",
+		Domain:   "pc.coobee.local",
+		IP:       "10.0.0.1",
+		Addrs:    []network.Address{{IP: "10.0.0.1"}, {IP: "8.8.8.8"}},
+	})
+	s := NewServer("127.0.0.1:0", "coobee.local", manager)
+	s.SetForwarder(NewForwarder([]string{upstream.addr}, 0))
+
+	resp := query(t, s, question("1.0.0.10.in-addr.arpa.", dnsmessage.TypePTR))
+	if len(resp.Answers) != 1 || resp.Answers[0].Body.(*dnsmessage.PTRResource).PTR.String() != "pc.coobee.local." {
+		t.Fatalf("节点地址的 PTR: %+v", resp.Answers)
+	}
+	if n := upstream.queries.Load(); n != 0 {
+		t.Fatalf("节点地址的反向解析发往了上游 %d 次", n)
+	}
+
+	for i, name := range []string{"8.8.8.8.in-addr.arpa.", "9.0.0.10.in-addr.arpa.", "0.10.in-addr.arpa."} {
+		resp := query(t, s, question(name, dnsmessage.TypePTR))
+		if resp.RCode != dnsmessage.RCodeNameError || len(resp.Answers) != 0 {
+			t.Fatalf("%s: rcode=%v answers=%d", name, resp.RCode, len(resp.Answers))
+		}
+		if n := upstream.queries.Load(); n != int32(i+1) {
+			t.Fatalf("%s 未转发上游: 查询次数 = %d", name, n)
+		}
+	}
+}
@@ -0,0 +1,446 @@
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/618lf/lanlink/logger"
+	"github.com/618lf/lanlink/network"
+	"github.com/618lf/lanlink/node"
+)
+
+const (
+	// maxUDPSize 未携带 EDNS 时 UDP 应答的最大长度
+	maxUDPSize = 512
+	// maxEDNSSize 通过 EDNS 声明支持的最大 UDP 应答长度
+	maxEDNSSize = 4096
+	// tcpTimeout TCP 连接的空闲超时
+	tcpTimeout = 10 * time.Second
+	// defaultTTL 默认应答 TTL
+	defaultTTL = 10 * time.Second
+	// maxInflight 同时处理的 UDP 查询数上限（转发上游时需要等待应答）
+	maxInflight = 256
+)
+
+// Server 内置 DNS 服务
+// 对 {DomainSuffix} 下的域名直接根据节点状态权威应答：在线节点返回真实地址，
+// 离线和未知节点返回 NXDOMAIN；节点通告的服务以 SRV 记录应答，节点地址的反向解析以 PTR 记录应答。
+// 其他域名在设置了转发器时转发到上游，否则拒绝解析；域名后缀下的查询不会发往上游
+type Server struct {
+	addr      string
+	zone      string // 小写、以点结尾的域名后缀
+	manager   *node.Manager
+	filter    func(*node.Node) bool
+	forwarder *Forwarder // 为 nil 时不转发
+	ttl       uint32
+	serial    uint32
+	inflight  chan struct{}
+
+	udp   net.PacketConn
+	tcp   net.Listener
+	mu    sync.Mutex // 保护 conns 和 stopCtx
+	conns map[net.Conn]struct{}
+	// stopCtx 取消 Start 注册的 ctx 回调，Close 后不再引用 ctx
+	stopCtx func() bool
+
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// NewServer 创建 DNS 服务，addr 为监听地址（如 127.0.0.1:53），suffix 为权威应答的域名后缀
+func NewServer(addr, suffix string, manager *node.Manager) *Server {
+	return &Server{
+		addr:     addr,
+		zone:     strings.ToLower(strings.Trim(suffix, ".")) + ".",
+		manager:  manager,
+		ttl:      uint32(defaultTTL / time.Second),
+		serial:   uint32(time.Now().Unix()),
+		conns:    make(map[net.Conn]struct{}),
+		inflight: make(chan struct{}, maxInflight),
+	}
+}
+
+// SetTTL 设置应答的 TTL（同时用作否定应答的缓存时间）
+func (s *Server) SetTTL(ttl time.Duration) {
+	if ttl >= time.Second {
+		s.ttl = uint32(ttl / time.Second)
+	}
+}
+
+// SetFilter 设置节点过滤函数，返回 false 的节点按不存在处理
+func (s *Server) SetFilter(filter func(*node.Node) bool) {
+	s.filter = filter
+}
+
+// SetForwarder 设置上游转发器
+func (s *Server) SetForwarder(forwarder *Forwarder) {
+	s.forwarder = forwarder
+}
+
+// Start 开始监听 UDP 和 TCP，ctx 取消时关闭
+func (s *Server) Start(ctx context.Context) error {
+	udp, err := net.ListenPacket("udp", s.addr)
+	if err != nil {
+		return err
+	}
+	// 端口为 0 时 TCP 使用与 UDP 相同的端口
+	tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+	if err != nil {
+		udp.Close()
+		return err
+	}
+	s.udp, s.tcp = udp, tcp
+
+	s.wg.Add(2)
+	go s.serveUDP()
+	go s.serveTCP()
+
+	stop := context.AfterFunc(ctx, func() { s.Close() })
+	s.mu.Lock()
+	s.stopCtx = stop
+	s.mu.Unlock()
+	return nil
+}
+
+// Addr 实际监听的地址
+func (s *Server) Addr() net.Addr {
+	if s.udp == nil {
+		return nil
+	}
+	return s.udp.LocalAddr()
+}
+
+// Close 关闭监听和全部 TCP 连接，等待处理协程退出
+func (s *Server) Close() error {
+	s.closeOnce.Do(func() {
+		if s.udp != nil {
+			s.udp.Close()
+		}
+		if s.tcp != nil {
+			s.tcp.Close()
+		}
+		s.mu.Lock()
+		if s.stopCtx != nil {
+			s.stopCtx()
+		}
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.mu.Unlock()
+	})
+	s.wg.Wait()
+	return nil
+}
+
+// serveUDP 处理 UDP 查询
+func (s *Server) serveUDP() {
+	defer s.wg.Done()
+
+	buf := make([]byte, 65535)
+	for {
+		n, src, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		// 处理中的查询过多时丢弃，客户端会重试
+		select {
+		case s.inflight <- struct{}{}:
+		default:
+			logger.Debug("DNS 查询过多，丢弃来自 %s 的查询", src)
+			continue
+		}
+		data := append([]byte(nil), buf[:n]...)
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() { <-s.inflight }()
+
+			if resp := s.handle(data, true); resp != nil {
+				if _, err := s.udp.WriteTo(resp, src); err != nil {
+					logger.Debug("DNS 应答 %s 失败: %v", src, err)
+				}
+			}
+		}()
+	}
+}
+
+// serveTCP 接受 TCP 连接
+func (s *Server) serveTCP() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.serveConn(conn)
+	}
+}
+
+// serveConn 处理一个 TCP 连接上的查询（两字节长度前缀）
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		conn.SetDeadline(time.Now().Add(tcpTimeout))
+		data, err := readTCP(conn)
+		if err != nil {
+			return
+		}
+		resp := s.handle(data, false)
+		if resp == nil {
+			return
+		}
+		if err := writeTCP(conn, resp); err != nil {
+			return
+		}
+	}
+}
+
+// handle 处理一个查询，返回应答数据；无法解析的数据返回 nil
+func (s *Server) handle(data []byte, udp bool) []byte {
+	var query dnsmessage.Message
+	if err := query.Unpack(data); err != nil || query.Response {
+		return nil
+	}
+
+	resp := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:               query.ID,
+			Response:         true,
+			OpCode:           query.OpCode,
+			RecursionDesired: query.RecursionDesired,
+			// 设置了转发器时可以解析任意域名
+			RecursionAvailable: s.forwarder != nil,
+		},
+		Questions: query.Questions,
+	}
+	switch {
+	case query.OpCode != 0:
+		resp.RCode = dnsmessage.RCodeNotImplemented
+	case len(query.Questions) != 1:
+		resp.RCode = dnsmessage.RCodeFormatError
+	default:
+		s.answer(query.Questions[0], &resp)
+	}
+
+	// 查询携带 EDNS 时按其声明的长度限制 UDP 应答
+	size, edns := maxUDPSize, false
+	for _, r := range query.Additionals {
+		if r.Header.Type == dnsmessage.TypeOPT {
+			edns = true
+			size = max(size, min(int(r.Header.Class), maxEDNSSize))
+		}
+	}
+	if edns {
+		var header dnsmessage.ResourceHeader
+		if err := header.SetEDNS0(maxEDNSSize, dnsmessage.RCodeSuccess, false); err == nil {
+			resp.Additionals = append(resp.Additionals, dnsmessage.Resource{Header: header, Body: &dnsmessage.OPTResource{}})
+		}
+	}
+
+	out, err := resp.Pack()
+	if err != nil {
+		logger.Debug("DNS 应答编码失败: %v", err)
+		return nil
+	}
+	if udp && len(out) > size {
+		// 超出长度时只保留问题部分并设置截断标志，客户端改用 TCP 重试
+		resp.Truncated = true
+		resp.Answers, resp.Authorities, resp.Additionals = nil, nil, nil
+		if out, err = resp.Pack(); err != nil {
+			return nil
+		}
+	}
+	return out
+}
+
+// answer 应答单个问题
+func (s *Server) answer(q dnsmessage.Question, resp *dnsmessage.Message) {
+	name := strings.ToLower(q.Name.String())
+	if name != s.zone && !strings.HasSuffix(name, "."+s.zone) {
+		// 集群节点地址的反向解析在本地应答，其他地址交给上游
+		if ip, ok := parseReverse(name); ok && s.answerPTR(q, ip, resp) {
+			return
+		}
+		s.forward(q, resp)
+		return
+	}
+	resp.Authoritative = true
+
+	switch {
+	case name == s.zone:
+		// 域名后缀本身只有 SOA 记录
+		if soa, ok := s.soa(); ok && (q.Type == dnsmessage.TypeSOA || q.Type == dnsmessage.TypeALL) {
+			resp.Answers = append(resp.Answers, soa)
+		}
+	case strings.HasPrefix(name, "_"):
+		s.answerSRV(q, name, resp)
+	default:
+		n, ok := s.lookup(name)
+		if !ok {
+			resp.RCode = dnsmessage.RCodeNameError
+			break
+		}
+		resp.Answers = append(resp.Answers, s.addrRecords(q.Name, q.Type, n)...)
+	}
+
+	// 否定应答（NXDOMAIN 和无数据）附带 SOA，TTL 即否定缓存时间
+	if len(resp.Answers) == 0 {
+		if soa, ok := s.soa(); ok {
+			resp.Authorities = append(resp.Authorities, soa)
+		}
+	}
+}
+
+// forward 把域名后缀以外的查询转发到上游，上游全部失败时返回 SERVFAIL
+func (s *Server) forward(q dnsmessage.Question, resp *dnsmessage.Message) {
+	if s.forwarder == nil {
+		resp.RCode = dnsmessage.RCodeRefused
+		return
+	}
+	upstream, err := s.forwarder.Resolve(q)
+	if err != nil {
+		logger.Debug("DNS 转发 %s 失败: %v", q.Name, err)
+		resp.RCode = dnsmessage.RCodeServerFailure
+		return
+	}
+	resp.RCode = upstream.RCode
+	resp.Answers = upstream.Answers
+	resp.Authorities = upstream.Authorities
+	resp.Additionals = upstream.Additionals
+}
+
+// answerSRV 应答服务记录，如 _http._tcp.box.coobee.local
+func (s *Server) answerSRV(q dnsmessage.Question, name string, resp *dnsmessage.Message) {
+	service, proto, domain, ok := network.ParseSRVName(name)
+	if !ok {
+		resp.RCode = dnsmessage.RCodeNameError
+		return
+	}
+	n, ok := s.lookup(domain)
+	if !ok {
+		resp.RCode = dnsmessage.RCodeNameError
+		return
+	}
+	svc, ok := network.FindService(n.Services, service, proto)
+	if !ok {
+		resp.RCode = dnsmessage.RCodeNameError
+		return
+	}
+	if q.Type != dnsmessage.TypeSRV && q.Type != dnsmessage.TypeALL {
+		return
+	}
+
+	target, err := dnsmessage.NewName(strings.ToLower(n.Domain) + ".")
+	if err != nil {
+		return
+	}
+	resp.Answers = append(resp.Answers, dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeSRV, Class: dnsmessage.ClassINET, TTL: s.ttl},
+		Body:   &dnsmessage.SRVResource{Target: target, Port: uint16(svc.Port)},
+	})
+	resp.Additionals = append(resp.Additionals, s.addrRecords(target, dnsmessage.TypeALL, n)...)
+}
+
+// lookup 查找可应答的节点：存在、在线且通过过滤
+func (s *Server) lookup(name string) (*node.Node, bool) {
+	n, ok := s.manager.FindByDomain(strings.TrimSuffix(name, "."))
+	if !ok || !n.IsOnline() || (s.filter != nil && !s.filter(n)) {
+		return nil, false
+	}
+	return n, true
+}
+
+// addrRecords 节点的 A/AAAA 记录
+func (s *Server) addrRecords(name dnsmessage.Name, qtype dnsmessage.Type, n *node.Node) []dnsmessage.Resource {
+	var records []dnsmessage.Resource
+	seen := make(map[string]bool)
+	for _, addr := range []string{n.IP, n.IPv6} {
+		ip := net.ParseIP(addr)
+		if ip == nil || seen[ip.String()] {
+			continue
+		}
+		seen[ip.String()] = true
+
+		header := dnsmessage.ResourceHeader{Name: name, Class: dnsmessage.ClassINET, TTL: s.ttl}
+		if v4 := ip.To4(); v4 != nil {
+			if qtype == dnsmessage.TypeA || qtype == dnsmessage.TypeALL {
+				header.Type = dnsmessage.TypeA
+				records = append(records, dnsmessage.Resource{Header: header, Body: &dnsmessage.AResource{A: [4]byte(v4)}})
+			}
+		} else if qtype == dnsmessage.TypeAAAA || qtype == dnsmessage.TypeALL {
+			header.Type = dnsmessage.TypeAAAA
+			records = append(records, dnsmessage.Resource{Header: header, Body: &dnsmessage.AAAAResource{AAAA: [16]byte(ip.To16())}})
+		}
+	}
+	return records
+}
+
+// soa 域名后缀的 SOA 记录
+func (s *Server) soa() (dnsmessage.Resource, bool) {
+	zone, err := dnsmessage.NewName(s.zone)
+	if err != nil {
+		return dnsmessage.Resource{}, false
+	}
+	ns, err := dnsmessage.NewName("ns." + s.zone)
+	if err != nil {
+		return dnsmessage.Resource{}, false
+	}
+	mbox, err := dnsmessage.NewName("hostmaster." + s.zone)
+	if err != nil {
+		return dnsmessage.Resource{}, false
+	}
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: zone, Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET, TTL: s.ttl},
+		Body: &dnsmessage.SOAResource{
+			NS:      ns,
+			MBox:    mbox,
+			Serial:  s.serial,
+			Refresh: 3600,
+			Retry:   600,
+			Expire:  86400,
+			MinTTL:  s.ttl,
+		},
+	}, true
+}
+
+// readTCP 读取一个带两字节长度前缀的 DNS 消息
+func readTCP(conn net.Conn) ([]byte, error) {
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	data := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// writeTCP 写入一个带两字节长度前缀的 DNS 消息
+func writeTCP(conn net.Conn, data []byte) error {
+	out := binary.BigEndian.AppendUint16(make([]byte, 0, len(data)+2), uint16(len(data)))
+	_, err := conn.Write(append(out, data...))
+	return err
+}
@@ -0,0 +1,54 @@
+package dns
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/618lf/lanlink/node"
+)
+
+// TestServerCloseReleasesContext 未取消 ctx 时关闭服务不残留等待 ctx 的协程
+func TestServerCloseReleasesContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	before := runtime.NumGoroutine()
+	for range 20 {
+		s := NewServer("127.0.0.1:0", "coobee.local", node.NewManager(time.Minute))
+		if err := s.Start(ctx); err != nil {
+			t.Fatal(err)
+		}
+		s.Close()
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Fatalf("关闭后残留 %d 个协程", n-before)
+	}
+}
+
+// TestServerClosesOnCancel 取消 ctx 时关闭服务
+func TestServerClosesOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := NewServer("127.0.0.1:0", "coobee.local", node.NewManager(time.Minute))
+	if err := s.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("取消 ctx 后服务未关闭")
+	}
+}
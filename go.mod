@@ -2,6 +2,8 @@ module github.com/618lf/lanlink
 
 go 1.23
 
-require golang.org/x/net v0.30.0
-
-require golang.org/x/sys v0.26.0 // indirect
+require (
+	golang.org/x/crypto v0.28.0
+	golang.org/x/net v0.30.0
+	golang.org/x/sys v0.26.0
+)
@@ -3,9 +3,12 @@ package hosts
 import (
 	"bufio"
 	"fmt"
+	"net"
 	"os"
 	"runtime"
 	"strings"
+
+	"github.com/618lf/lanlink/node"
 )
 
 const (
@@ -18,6 +21,7 @@ const (
 // Manager Hosts文件管理器
 type Manager struct {
 	hostsPath string
+	zone      string // 域名后缀，为空时只校验主机名格式
 }
 
 // NewManager 创建Hosts管理器
@@ -27,6 +31,11 @@ func NewManager() *Manager {
 	}
 }
 
+// SetZone 设置域名后缀，只写入后缀下的域名
+func (m *Manager) SetZone(suffix string) {
+	m.zone = suffix
+}
+
 // CheckPermission 检查是否有权限修改hosts文件
 func (m *Manager) CheckPermission() error {
 	// 尝试打开文件
@@ -77,6 +86,28 @@ func (m *Manager) Initialize() error {
 
 // AddOrUpdate 添加或更新域名映射
 func (m *Manager) AddOrUpdate(ip, domain string) error {
+	return m.Set(domain, []string{ip})
+}
+
+// Set 设置域名映射的全部地址（IPv4/IPv6），替换该域名原有的所有条目
+// 反向解析（如 ssh、last 显示的主机名）取 hosts 中第一条匹配地址的条目，因此真实地址写在管理区域开头，
+// 同一地址有多个条目时最近上线的节点优先；离线占位地址（127.0.0.1）写在末尾，不会遮挡其他条目
+// 无效的域名和地址不写入，避免在 hosts 文件中注入其他条目
+func (m *Manager) Set(domain string, ips []string) error {
+	if err := node.ValidateDomain(domain, m.zone); err != nil {
+		return err
+	}
+	var kept []string
+	for _, ip := range ips {
+		if net.ParseIP(ip) != nil {
+			kept = append(kept, ip)
+		}
+	}
+	if len(kept) == 0 {
+		return fmt.Errorf("没有有效的地址: %s %q", domain, ips)
+	}
+	ips = kept
+
 	if err := m.backup(); err != nil {
 		return err
 	}
@@ -87,35 +118,39 @@ func (m *Manager) AddOrUpdate(ip, domain string) error {
 	}
 
 	lines := strings.Split(string(content), "\n")
-	newLines := make([]string, 0, len(lines))
+	newLines := make([]string, 0, len(lines)+len(ips))
 	inManagedZone := false
-	found := false
-	entry := fmt.Sprintf("%s\t%s\t%s", ip, domain, entryMarker)
+	var head, tail []string
+	for _, ip := range ips {
+		entry := fmt.Sprintf("%s\t%s\t%s", ip, domain, entryMarker)
+		if isLoopback(ip) {
+			tail = append(tail, entry)
+		} else {
+			head = append(head, entry)
+		}
+	}
 
 	for _, line := range lines {
 		if strings.TrimSpace(line) == beginMarker {
 			inManagedZone = true
 			newLines = append(newLines, line)
+			newLines = append(newLines, head...)
 			continue
 		}
 
 		if strings.TrimSpace(line) == endMarker {
-			// 如果在管理区域内没找到，添加新条目
-			if inManagedZone && !found {
-				newLines = append(newLines, entry)
+			if inManagedZone {
+				newLines = append(newLines, tail...)
 			}
 			inManagedZone = false
 			newLines = append(newLines, line)
 			continue
 		}
 
-		// 在管理区域内，检查是否是要更新的域名
+		// 在管理区域内，删除该域名的旧条目
 		if inManagedZone && strings.Contains(line, entryMarker) {
 			fields := strings.Fields(line)
 			if len(fields) >= 2 && fields[1] == domain {
-				// 找到了，更新IP
-				newLines = append(newLines, entry)
-				found = true
 				continue
 			}
 		}
@@ -171,7 +206,7 @@ func (m *Manager) Remove(domain string) error {
 	return os.WriteFile(m.hostsPath, []byte(strings.Join(newLines, "\n")), 0644)
 }
 
-// List 列出所有LanLink管理的条目
+// List 列出所有LanLink管理的条目（同一域名有多个地址时保留最后一个）
 func (m *Manager) List() (map[string]string, error) {
 	content, err := os.ReadFile(m.hostsPath)
 	if err != nil {
@@ -218,6 +253,12 @@ func (m *Manager) backup() error {
 	return os.WriteFile(backupPath, content, 0644)
 }
 
+// isLoopback 是否为回环地址（离线节点的占位地址）
+func isLoopback(ip string) bool {
+	parsed := net.ParseIP(ip)
+	return parsed != nil && parsed.IsLoopback()
+}
+
 // getHostsPath 获取hosts文件路径
 func getHostsPath() string {
 	switch runtime.GOOS {
@@ -0,0 +1,85 @@
+package hosts
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestManager 创建使用临时 hosts 文件的管理器
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hosts")
+	if err := os.WriteFile(path, []byte("127.0.0.1\tlocalhost\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := &Manager{hostsPath: path}
+	m.SetZone("coobee.local")
+	if err := m.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestManagerSet(t *testing.T) {
+	m := newTestManager(t)
+	if err := m.Set("pc.coobee.local", []string{"192.168.1.10", "fd00::10"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddOrUpdate("127.0.0.1", "nas.coobee.local"); err != nil {
+		t.Fatal(err)
+	}
+	// 替换原有条目
+	if err := m.Set("pc.coobee.local", []string{"192.168.1.11"}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := m.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries["pc.coobee.local"] != "192.168.1.11" || entries["nas.coobee.local"] != "127.0.0.1" {
+		t.Fatalf("entries = %v", entries)
+	}
+
+	if err := m.Remove("pc.coobee.local"); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := m.List(); len(entries) != 1 {
+		t.Fatalf("删除后 entries = %v", entries)
+	}
+}
+
+func TestManagerSetRejectsInvalid(t *testing.T) {
+	m := newTestManager(t)
+	before, _ := os.ReadFile(m.hostsPath)
+
+	tests := []struct {
+		domain string
+		ips    []string
+	}{
+		{"x\n0.0.0.0 bank.com.coobee.local", []string{"192.168.1.10"}},
+		{"www.example.com", []string{"192.168.1.10"}},
+		{"a b.coobee.local", []string{"192.168.1.10"}},
+		{"pc.coobee.local", []string{"192.168.1.10\n0.0.0.0 bank.com"}},
+		{"pc.coobee.local", nil},
+	}
+	for _, tt := range tests {
+		if err := m.Set(tt.domain, tt.ips); err == nil {
+			t.Errorf("Set(%q, %q) 应返回错误", tt.domain, tt.ips)
+		}
+	}
+	if after, _ := os.ReadFile(m.hostsPath); string(after) != string(before) {
+		t.Fatalf("无效的映射修改了 hosts 文件:\n%s", after)
+	}
+
+	// 无效的地址被丢弃，有效的地址照常写入
+	if err := m.Set("pc.coobee.local", []string{"bad\nentry", "192.168.1.10"}); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := os.ReadFile(m.hostsPath)
+	if strings.Contains(string(content), "bad") || !strings.Contains(string(content), "192.168.1.10\tpc.coobee.local") {
+		t.Fatalf("hosts 文件:\n%s", content)
+	}
+}
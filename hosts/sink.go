@@ -0,0 +1,279 @@
+package hosts
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/618lf/lanlink/logger"
+	"github.com/618lf/lanlink/node"
+)
+
+// 导出格式
+const (
+	FormatDnsmasq      = "dnsmasq"       // dnsmasq host-record（conf-file / conf-dir 引入）
+	FormatDnsmasqHosts = "dnsmasq-hosts" // dnsmasq addn-hosts（hosts 语法）
+	FormatUnbound      = "unbound"       // unbound local-data（include 引入）
+	FormatCoreDNS      = "coredns"       // CoreDNS hosts 插件（hosts 语法）
+)
+
+const (
+	// sinkFlushDelay 合并短时间内的多次变化后再写入，避免启动同步时频繁重新加载
+	sinkFlushDelay = time.Second
+	// reloadTimeout 重新加载命令的超时
+	reloadTimeout = 30 * time.Second
+	// defaultSinkTTL 导出记录的默认 TTL（秒）
+	defaultSinkTTL = 10
+)
+
+// Sink 把在线节点表导出为 DNS 服务的配置文件，与 Manager 一样按域名更新
+// 离线节点的占位地址（127.0.0.1）不导出，整个文件在变化后重写，写入后可执行重新加载命令
+type Sink struct {
+	format string
+	path   string
+	reload string
+	zone   string
+	ttl    int
+
+	mu      sync.Mutex
+	records map[string][]string // domain -> ips
+	timer   *time.Timer
+
+	flushMu sync.Mutex // 串行写入文件和执行重新加载命令，不阻塞更新
+	written []byte
+}
+
+// NewSink 创建导出器，format 为 dnsmasq、dnsmasq-hosts、unbound 或 coredns
+func NewSink(format, path string) (*Sink, error) {
+	switch format {
+	case FormatDnsmasq, FormatDnsmasqHosts, FormatUnbound, FormatCoreDNS:
+	default:
+		return nil, fmt.Errorf("不支持的导出格式: %s", format)
+	}
+	if path == "" {
+		return nil, fmt.Errorf("导出文件路径不能为空")
+	}
+	return &Sink{
+		format:  format,
+		path:    path,
+		ttl:     defaultSinkTTL,
+		records: make(map[string][]string),
+	}, nil
+}
+
+// SetReload 设置写入后执行的重新加载命令，如 systemctl reload dnsmasq
+func (s *Sink) SetReload(command string) {
+	s.reload = command
+}
+
+// SetZone 设置域名后缀，unbound 格式据此声明 static 区域（后缀下的未知域名直接返回 NXDOMAIN）
+func (s *Sink) SetZone(suffix string) {
+	s.zone = strings.Trim(suffix, ".")
+}
+
+// SetTTL 设置导出记录的 TTL（秒）
+func (s *Sink) SetTTL(ttl int) {
+	if ttl > 0 {
+		s.ttl = ttl
+	}
+}
+
+// Path 导出文件路径
+func (s *Sink) Path() string {
+	return s.path
+}
+
+// Initialize 写入空的节点表，清除上次运行遗留的记录，同时检查写权限
+func (s *Sink) Initialize() error {
+	return s.Flush()
+}
+
+// AddOrUpdate 添加或更新域名映射
+func (s *Sink) AddOrUpdate(ip, domain string) error {
+	return s.Set(domain, []string{ip})
+}
+
+// Set 设置域名映射的全部地址，只有回环地址时视为离线，删除该域名
+// 不在域名后缀下的域名和无效的地址不导出，避免注入 DNS 服务的配置
+func (s *Sink) Set(domain string, ips []string) error {
+	if err := node.ValidateDomain(domain, s.zone); err != nil {
+		return err
+	}
+	var kept []string
+	for _, ip := range ips {
+		if net.ParseIP(ip) != nil && !isLoopback(ip) {
+			kept = append(kept, ip)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(kept) == 0 {
+		delete(s.records, domain)
+	} else {
+		s.records[domain] = kept
+	}
+	s.schedule()
+	return nil
+}
+
+// Remove 删除域名映射
+func (s *Sink) Remove(domain string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, domain)
+	s.schedule()
+	return nil
+}
+
+// Close 立即写入尚未写入的变化
+func (s *Sink) Close() error {
+	s.mu.Lock()
+	pending := s.timer != nil && s.timer.Stop()
+	s.timer = nil
+	s.mu.Unlock()
+
+	if pending {
+		return s.Flush()
+	}
+	return nil
+}
+
+// Flush 立即写入节点表，内容变化时执行重新加载命令
+func (s *Sink) Flush() error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	data := s.render()
+	s.mu.Unlock()
+	if s.written != nil && bytes.Equal(data, s.written) {
+		return nil
+	}
+
+	// 先写临时文件再重命名，DNS 服务不会读到写了一半的文件
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	s.written = data
+
+	if s.reload != "" {
+		if err := runCommand(s.reload); err != nil {
+			s.written = nil // 下次写入时重试
+			return fmt.Errorf("重新加载失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// schedule 延迟写入，调用方需持有锁
+func (s *Sink) schedule() {
+	if s.timer != nil {
+		return
+	}
+	s.timer = time.AfterFunc(sinkFlushDelay, func() {
+		s.mu.Lock()
+		s.timer = nil
+		s.mu.Unlock()
+
+		if err := s.Flush(); err != nil {
+			logger.Error("导出 %s 失败: %v", s.path, err)
+		}
+	})
+}
+
+// render 按域名排序生成文件内容，调用方需持有锁
+func (s *Sink) render() []byte {
+	domains := make([]string, 0, len(s.records))
+	for domain := range s.records {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+
+	var b strings.Builder
+	b.WriteString("# 由 LanLink 自动生成，请勿手动修改\n")
+	switch s.format {
+	case FormatDnsmasq:
+		for _, domain := range domains {
+			// host-record 最多一个 IPv4 和一个 IPv6 地址，dnsmasq 同时生成 PTR 记录
+			ipv4, ipv6 := splitFamilies(s.records[domain])
+			fields := []string{domain}
+			if len(ipv4) > 0 {
+				fields = append(fields, ipv4[0])
+			}
+			if len(ipv6) > 0 {
+				fields = append(fields, ipv6[0])
+			}
+			fmt.Fprintf(&b, "host-record=%s,%d\n", strings.Join(fields, ","), s.ttl)
+		}
+
+	case FormatUnbound:
+		b.WriteString("server:\n")
+		if s.zone != "" {
+			fmt.Fprintf(&b, "\tlocal-zone: \"%s.\" static\n", s.zone)
+		}
+		for _, domain := range domains {
+			for _, ip := range s.records[domain] {
+				rrtype := "A"
+				if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+					rrtype = "AAAA"
+				}
+				fmt.Fprintf(&b, "\tlocal-data: \"%s. %d IN %s %s\"\n", domain, s.ttl, rrtype, ip)
+				fmt.Fprintf(&b, "\tlocal-data-ptr: \"%s %s.\"\n", ip, domain)
+			}
+		}
+
+	default: // hosts 语法
+		for _, domain := range domains {
+			for _, ip := range s.records[domain] {
+				fmt.Fprintf(&b, "%s\t%s\n", ip, domain)
+			}
+		}
+	}
+	return []byte(b.String())
+}
+
+// splitFamilies 按地址族拆分地址
+func splitFamilies(ips []string) (ipv4, ipv6 []string) {
+	for _, ip := range ips {
+		parsed := net.ParseIP(ip)
+		switch {
+		case parsed == nil:
+		case parsed.To4() != nil:
+			ipv4 = append(ipv4, ip)
+		default:
+			ipv6 = append(ipv6, ip)
+		}
+	}
+	return ipv4, ipv6
+}
+
+// runCommand 通过系统 shell 执行命令
+func runCommand(command string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), reloadTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package hosts
+
+import "testing"
+
+// newTestSink 创建导出器并写入测试记录，不写文件
+func newTestSink(t *testing.T, format string) *Sink {
+	t.Helper()
+	s, err := NewSink(format, t.TempDir()+"/lanlink.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetZone("coobee.local")
+	s.SetTTL(30)
+	t.Cleanup(func() { s.Close() })
+
+	for domain, ips := range map[string][]string{
+		"pc.coobee.local":     {"192.168.1.10", "fd00::10"},
+		"nas.coobee.local":    {"192.168.1.20"},
+		"laptop.coobee.local": {"127.0.0.1"}, // 离线，不导出
+	} {
+		if err := s.Set(domain, ips); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func renderString(s *Sink) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return string(s.render())
+}
+
+func TestSinkRender(t *testing.T) {
+	const header = "# 由 LanLink 自动生成，请勿手动修改\n"
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{FormatDnsmasq, header +
+			"host-record=nas.coobee.local,192.168.1.20,30\n" +
+			"host-record=pc.coobee.local,192.168.1.10,fd00::10,30\n"},
+		{FormatDnsmasqHosts, header +
+			"192.168.1.20\tnas.coobee.local\n" +
+			"192.168.1.10\tpc.coobee.local\n" +
+			"fd00::10\tpc.coobee.local\n"},
+		{FormatUnbound, header +
+			"server:\n" +
+			"\tlocal-zone: \"coobee.local.\" static\n" +
+			"\tlocal-data: \"nas.coobee.local. 30 IN A 192.168.1.20\"\n" +
+			"\tlocal-data-ptr: \"192.168.1.20 nas.coobee.local.\"\n" +
+			"\tlocal-data: \"pc.coobee.local. 30 IN A 192.168.1.10\"\n" +
+			"\tlocal-data-ptr: \"192.168.1.10 pc.coobee.local.\"\n" +
+			"\tlocal-data: \"pc.coobee.local. 30 IN AAAA fd00::10\"\n" +
+			"\tlocal-data-ptr: \"fd00::10 pc.coobee.local.\"\n"},
+		{FormatCoreDNS, header +
+			"192.168.1.20\tnas.coobee.local\n" +
+			"192.168.1.10\tpc.coobee.local\n" +
+			"fd00::10\tpc.coobee.local\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			if got := renderString(newTestSink(t, tt.format)); got != tt.want {
+				t.Fatalf("render =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSinkRejectsInjection 来自其他节点的域名和地址可能注入配置，不导出
+func TestSinkRejectsInjection(t *testing.T) {
+	for _, format := range []string{FormatDnsmasq, FormatUnbound} {
+		t.Run(format, func(t *testing.T) {
+			s := newTestSink(t, format)
+			want := renderString(s)
+
+			for _, domain := range []string{
+				"x\ndhcp-script=/tmp/p.coobee.local",
+				"x\" IN A 1.2.3.4\".coobee.local",
+				"a,b.coobee.local",
+				"a b.coobee.local",
+				"www.example.com",
+				"coobee.local",
+				".coobee.local",
+				"-pc.coobee.local",
+			} {
+				if err := s.Set(domain, []string{"192.168.1.30"}); err == nil {
+					t.Errorf("Set(%q) 应返回错误", domain)
+				}
+			}
+			// 无效的地址被丢弃，没有有效地址时删除该域名
+			if err := s.Set("nas.coobee.local", []string{"1.2.3.4\nserver=8.8.8.8", "not-an-ip"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Set("nas.coobee.local", []string{"192.168.1.20", "1.2.3.4,5.6.7.8"}); err != nil {
+				t.Fatal(err)
+			}
+			if got := renderString(s); got != want {
+				t.Fatalf("render =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
@@ -14,6 +14,7 @@ import (
 type NodeInfo struct {
 	Domain   string
 	IP       string
+	IPv6     string
 	Hostname string
 	Status   string // online/offline
 	LastSeen time.Time
@@ -63,6 +64,7 @@ func GetNodes() ([]NodeInfo, error) {
 	defer file.Close()
 
 	var nodes []NodeInfo
+	index := make(map[string]int) // domain -> nodes 下标，合并同一域名的 IPv4/IPv6 条目
 	scanner := bufio.NewScanner(file)
 	inManagedZone := false
 
@@ -81,6 +83,13 @@ func GetNodes() ([]NodeInfo, error) {
 		if inManagedZone && strings.Contains(line, "# LanLink") {
 			fields := strings.Fields(line)
 			if len(fields) >= 2 {
+				if i, ok := index[fields[1]]; ok {
+					if strings.Contains(fields[0], ":") {
+						nodes[i].IPv6 = fields[0]
+					}
+					continue
+				}
+				index[fields[1]] = len(nodes)
 				node := NodeInfo{
 					IP:      fields[0],
 					Domain:  fields[1],
@@ -235,4 +244,3 @@ func GetLogFileModTime() (time.Time, error) {
 	}
 	return stat.ModTime(), nil
 }
-
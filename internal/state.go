@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/618lf/lanlink/network"
+)
+
+// stateFile 运行状态快照文件，由服务进程定期写入
+const stateFile = "lanlink.state.json"
+
+// State 运行状态快照
+type State struct {
+	PID         int                  `json:"pid"`
+	UpdatedAt   time.Time            `json:"updatedAt"`
+	Stats       network.Stats        `json:"stats"`       // 收包统计
+	Rejected    uint64               `json:"rejected"`    // 过期或重复而被拒绝的消息
+	Quarantined []network.Quarantine `json:"quarantined"` // 当前被隔离的来源
+	Nodes       []NodeState          `json:"nodes"`       // 已知节点（按域名排序）
+}
+
+// NodeState 节点快照
+type NodeState struct {
+	Domain   string            `json:"domain"`
+	IP       string            `json:"ip"`
+	IPv6     string            `json:"ipv6,omitempty"`
+	Hostname string            `json:"hostname"`
+	Online   bool              `json:"online"`
+	IsLocal  bool              `json:"isLocal,omitempty"`
+	ReadOnly bool              `json:"readOnly,omitempty"` // 通过 mDNS 导入
+	Services []network.Service `json:"services,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+}
+
+// FindNode 按域名查找节点（不区分大小写）
+func (s *State) FindNode(domain string) (*NodeState, bool) {
+	domain = strings.TrimSuffix(domain, ".")
+	for i := range s.Nodes {
+		if strings.EqualFold(s.Nodes[i].Domain, domain) {
+			return &s.Nodes[i], true
+		}
+	}
+	return nil, false
+}
+
+// WriteState 写入运行状态快照（先写临时文件再重命名，避免读到半个文件）
+func WriteState(state *State) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := stateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, stateFile)
+}
+
+// GetState 读取运行状态快照
+func GetState() (*State, error) {
+	data, err := os.ReadFile(stateFile)
+	if err != nil {
+		return nil, err
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// RemoveState 删除运行状态快照（服务退出时调用）
+func RemoveState() error {
+	err := os.Remove(stateFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
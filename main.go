@@ -1,20 +1,17 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
-	"time"
 
+	"github.com/618lf/lanlink/agent"
 	"github.com/618lf/lanlink/cli"
 	"github.com/618lf/lanlink/config"
-	"github.com/618lf/lanlink/hosts"
 	"github.com/618lf/lanlink/logger"
-	"github.com/618lf/lanlink/network"
-	"github.com/618lf/lanlink/node"
 )
 
 const (
@@ -76,6 +73,29 @@ func main() {
 		if err := cli.ServiceUninstall(); err != nil {
 			os.Exit(1)
 		}
+		// 服务异常退出时可能没有撤销 systemd-resolved 的配置
+		if cfg, err := config.Load(configFile); err == nil && cfg.Resolved {
+			cli.RevertResolved(cfg.ResolvedLink, cfg.ResolvedBus)
+		}
+
+	case flag.Arg(0) == "nodes":
+		// 列出节点，-l 按标签筛选
+		nodesCmd := flag.NewFlagSet("nodes", flag.ExitOnError)
+		selector := nodesCmd.String("l", "", "标签选择器，如 role=build-agent,env!=prod")
+		nodesCmd.Parse(flag.Args()[1:])
+		if err := cli.ShowNodes(*selector); err != nil {
+			os.Exit(1)
+		}
+
+	case flag.Arg(0) == "services":
+		// 列出各节点通告的服务，或解析 SRV 记录名
+		if err := cli.ShowServices(flag.Arg(1)); err != nil {
+			os.Exit(1)
+		}
+
+	case flag.Arg(0) == "relay":
+		// 中继模式：在多个网段之间转发心跳
+		runRelay()
 
 	default:
 		// 默认：启动服务（前台运行）
@@ -83,6 +103,7 @@ func main() {
 	}
 }
 
+// runService 前台运行节点代理，收到退出信号后优雅退出
 func runService() {
 	fmt.Println("LanLink - 局域网域名自动映射工具")
 	fmt.Println("Version: 1.0.0")
@@ -106,256 +127,25 @@ func runService() {
 	logger.Info("设备名称: %s", cfg.DeviceName)
 	logger.Info("域名后缀: %s", cfg.DomainSuffix)
 
-	// 3. 检查hosts文件权限
-	hostsManager := hosts.NewManager()
-	if err := hostsManager.CheckPermission(); err != nil {
+	// 3. 创建节点代理
+	a, err := agent.New(cfg)
+	if err != nil {
 		logger.Error("%v", err)
 		fmt.Printf("错误: %v\n", err)
+		logger.Close()
 		os.Exit(1)
 	}
 
-	// 初始化hosts文件（添加标记区域）
-	if err := hostsManager.Initialize(); err != nil {
-		logger.Error("初始化hosts文件失败: %v", err)
-		os.Exit(1)
-	}
-	logger.Info("Hosts文件初始化完成")
-
-	// 4. 获取本机信息
-	deviceID, err := network.GetMACAddress()
-	if err != nil {
-		logger.Error("获取MAC地址失败: %v", err)
-		os.Exit(1)
-	}
-
-	// 5. 创建组播客户端
-	client, err := network.NewMulticastClient(cfg.MulticastAddr, cfg.MulticastPort)
-	if err != nil {
-		logger.Error("创建组播客户端失败: %v", err)
-		os.Exit(1)
-	}
-	defer client.Close()
-
-	localIP := client.GetLocalIP()
-	domain := generateDomain(cfg.DeviceName, cfg.DomainSuffix)
-
-	logger.Info("本机信息: DeviceID=%s, IP=%s, Domain=%s", deviceID, localIP, domain)
-	fmt.Printf("本机域名: %s\n", domain)
-	fmt.Printf("本机 IP: %s\n", localIP)
-	fmt.Println()
-
-	// 6. 创建节点管理器
-	nodeManager := node.NewManager(time.Duration(cfg.OfflineTimeoutSec) * time.Second)
-
-	// 添加本机节点
-	nodeManager.AddOrUpdate(deviceID, domain, localIP, cfg.DeviceName)
-	nodeManager.SetLocal(deviceID)
-
-	// 设置节点变化回调（更新hosts文件并打印集群信息）
-	nodeManager.SetChangeCallback(func(n *node.Node, isOnline bool) {
-		if n.IsLocal {
-			return
-		}
-
-		if isOnline {
-			logger.Info("节点上线: %s (%s -> %s)", n.Hostname, n.Domain, n.IP)
-			// 上线时使用真实IP
-			if err := hostsManager.AddOrUpdate(n.IP, n.Domain); err != nil {
-				logger.Error("更新hosts失败: %v", err)
-			} else {
-				logger.Info("已更新hosts: %s -> %s", n.Domain, n.IP)
-			}
-		} else {
-			logger.Info("节点离线: %s (%s)", n.Hostname, n.Domain)
-			// 离线时将IP设为127.0.0.1（保留域名映射）
-			if err := hostsManager.AddOrUpdate("127.0.0.1", n.Domain); err != nil {
-				logger.Error("更新hosts失败: %v", err)
-			} else {
-				logger.Info("已更新hosts: %s -> 127.0.0.1 (离线)", n.Domain)
-			}
-		}
-
-		// 状态变化时立即打印集群信息
-		printClusterInfo(nodeManager)
-	})
-
-	// 设置消息接收回调
-	client.SetMessageCallback(func(msg *network.Message) {
-		logger.Debug("收到消息: Action=%s, From=%s (%s)", msg.Action, msg.Hostname, msg.IP)
-
-		switch msg.Action {
-		case network.ActionHeartbeat:
-			// 检查域名冲突
-			_, exists := nodeManager.Get(msg.DeviceID)
-			if !exists && hasDomainConflict(nodeManager, msg.Domain, msg.DeviceID) {
-				// 域名冲突，添加后缀
-				originalDomain := msg.Domain
-				msg.Domain = msg.Domain + "-" + extractMACShort(msg.DeviceID)
-				logger.Warn("域名冲突: %s 已被占用，自动重命名为 %s", originalDomain, msg.Domain)
-			}
-
-			// 更新节点
-			if changed := nodeManager.AddOrUpdate(msg.DeviceID, msg.Domain, msg.IP, msg.Hostname); changed && exists {
-				logger.Info("节点信息更新: %s (%s -> %s)", msg.Hostname, msg.Domain, msg.IP)
-			}
-
-		case network.ActionOffline:
-			// 标记节点离线（不删除，保留记录）
-			nodeManager.MarkOffline(msg.DeviceID)
-		}
-	})
-
-	// 7. 启动组播监听
-	if err := client.Start(); err != nil {
-		logger.Error("启动组播监听失败: %v", err)
-		os.Exit(1)
-	}
-	logger.Info("组播监听已启动: %s:%d", cfg.MulticastAddr, cfg.MulticastPort)
-
-	// 8. 发送首次心跳
-	sendHeartbeat(client, domain, localIP, deviceID, cfg.DeviceName)
-
-	// 9. 启动定时任务
-	heartbeatTicker := time.NewTicker(time.Duration(cfg.HeartbeatIntervalSec) * time.Second)
-	offlineCheckTicker := time.NewTicker(5 * time.Second)
-	clusterInfoTicker := time.NewTicker(30 * time.Second)
-	defer heartbeatTicker.Stop()
-	defer offlineCheckTicker.Stop()
-	defer clusterInfoTicker.Stop()
+	// 4. 运行直到收到退出信号
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// 10. 优雅退出处理
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-
-	logger.Info("LanLink 运行中，按 Ctrl+C 退出")
 	fmt.Println("LanLink 运行中，按 Ctrl+C 退出...")
-
-	// 主循环
-	for {
-		select {
-		case <-heartbeatTicker.C:
-			// 发送心跳
-			sendHeartbeat(client, domain, localIP, deviceID, cfg.DeviceName)
-
-		case <-offlineCheckTicker.C:
-			// 检查离线节点
-			offlineNodes := nodeManager.CheckOffline()
-			if len(offlineNodes) > 0 {
-				logger.Debug("检查到 %d 个离线节点", len(offlineNodes))
-			}
-
-		case <-clusterInfoTicker.C:
-			// 每30秒打印集群节点信息
-			printClusterInfo(nodeManager)
-
-		case <-sigChan:
-			// 优雅退出
-			logger.Info("收到退出信号，正在清理...")
-			fmt.Println("\n正在退出...")
-
-			// 发送离线通知
-			msg := &network.Message{
-				Action:   network.ActionOffline,
-				Domain:   domain,
-				IP:       localIP,
-				DeviceID: deviceID,
-				Hostname: cfg.DeviceName,
-			}
-			client.Send(msg)
-			logger.Info("已发送离线通知")
-
-			// 等待消息发送完成
-			time.Sleep(100 * time.Millisecond)
-
-			logger.Info("=== LanLink 已退出 ===")
-			return
-		}
-	}
-}
-
-// sendHeartbeat 发送心跳
-func sendHeartbeat(client *network.MulticastClient, domain, ip, deviceID, hostname string) {
-	msg := &network.Message{
-		Action:   network.ActionHeartbeat,
-		Domain:   domain,
-		IP:       ip,
-		DeviceID: deviceID,
-		Hostname: hostname,
-	}
-
-	if err := client.Send(msg); err != nil {
-		logger.Error("发送心跳失败: %v", err)
-	} else {
-		logger.Debug("已发送心跳: %s -> %s", domain, ip)
-	}
-}
-
-// generateDomain 生成域名
-// 域名格式: {deviceName}.{suffix}
-// 其中 deviceName 默认为 {platform}-{硬件序列号后6位}
-// 最终域名示例: win-abc123.coobee.local, macos-xyz789.coobee.local
-func generateDomain(deviceName, suffix string) string {
-	// 将设备名转换为小写，替换空格为连字符
-	name := strings.ToLower(deviceName)
-	name = strings.ReplaceAll(name, " ", "-")
-	return fmt.Sprintf("%s.%s", name, suffix)
-}
-
-// hasDomainConflict 检查域名冲突
-func hasDomainConflict(manager *node.Manager, domain, deviceID string) bool {
-	nodes := manager.GetAll()
-	for _, n := range nodes {
-		if n.Domain == domain && n.DeviceID != deviceID {
-			return true
-		}
-	}
-	return false
-}
-
-// extractMACShort 提取MAC地址的短格式（后6位）
-func extractMACShort(deviceID string) string {
-	// deviceID格式: mac-00:11:22:33:44:55
-	parts := strings.Split(deviceID, "-")
-	if len(parts) != 2 {
-		return deviceID
-	}
-	mac := strings.ReplaceAll(parts[1], ":", "")
-	if len(mac) >= 6 {
-		return mac[len(mac)-6:]
-	}
-	return mac
-}
-
-// printClusterInfo 打印集群节点信息
-func printClusterInfo(manager *node.Manager) {
-	nodes := manager.GetAll()
-	if len(nodes) == 0 {
-		return
-	}
-
-	// 统计在线数量
-	onlineCount := manager.GetOnlineCount()
-
-	fmt.Println()
-	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-	fmt.Printf("  集群节点列表 (总计 %d 个, 在线 %d 个, 离线 %d 个)\n", 
-		len(nodes), onlineCount, len(nodes)-onlineCount)
-	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-
-	for _, n := range nodes {
-		var status string
-
-		if n.IsLocal {
-			status = "本机"
-		} else if n.IsOnline {
-			status = "在线"
-		} else {
-			status = "离线"
-		}
-
-		// 始终显示真实 IP（hosts 文件中离线节点会映射到 127.0.0.1）
-		fmt.Printf("  %-30s -> %-15s [%s]\n", n.Domain, n.IP, status)
+	if err := a.Run(ctx); err != nil {
+		logger.Error("%v", err)
+		fmt.Printf("错误: %v\n", err)
+		logger.Close()
+		os.Exit(1)
 	}
-	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-	fmt.Println()
+	logger.Info("=== LanLink 已退出 ===")
 }
@@ -0,0 +1,183 @@
+package network
+
+import (
+	"net"
+	"slices"
+	"strings"
+)
+
+// Address 节点网卡地址
+type Address struct {
+	IP     string `json:"ip"`     // IP地址
+	Iface  string `json:"iface"`  // 网卡名称
+	Prefix int    `json:"prefix"` // 前缀长度
+}
+
+// network 地址所在网段
+func (a Address) network() *net.IPNet {
+	ip := net.ParseIP(a.IP)
+	if ip == nil {
+		return nil
+	}
+	bits := 128
+	if ip.To4() != nil {
+		ip = ip.To4()
+		bits = 32
+	}
+	mask := net.CIDRMask(a.Prefix, bits)
+	if mask == nil {
+		return nil
+	}
+	return &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+}
+
+// LocalAddresses 获取本机所有可用地址
+// 排除未启用或不符合网卡策略的接口、回环地址和 IPv6 链路本地地址
+func LocalAddresses(policy *InterfacePolicy) ([]Address, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []Address
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		if !policy.Allow(iface.Name) {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.IsLoopback() || ipNet.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			prefix, _ := ipNet.Mask.Size()
+			result = append(result, Address{
+				IP:     ipNet.IP.String(),
+				Iface:  iface.Name,
+				Prefix: prefix,
+			})
+		}
+	}
+	return result, nil
+}
+
+// primaryFirst 将主地址排在列表最前面
+func primaryFirst(addrs []Address, primary ...string) []Address {
+	result := make([]Address, 0, len(addrs))
+	for _, p := range primary {
+		for _, a := range addrs {
+			if a.IP == p {
+				result = append(result, a)
+				break
+			}
+		}
+	}
+	for _, a := range addrs {
+		isPrimary := false
+		for _, p := range primary {
+			if a.IP == p {
+				isPrimary = true
+				break
+			}
+		}
+		if !isPrimary {
+			result = append(result, a)
+		}
+	}
+	return result
+}
+
+// PreferredAddrs 根据本机网段从消息携带的地址列表中选择可达地址
+// 优先选择与本机某个接口同网段的地址，否则回退到消息的 IP/IPv6 字段
+func (m *Message) PreferredAddrs(local []Address) (ip, ipv6 string) {
+	return preferredAddrs(m.IP, m.IPv6, m.Addrs, local)
+}
+
+// Advertises 检查 ip 是否为消息通告的地址之一
+func (m *Message) Advertises(ip string) bool {
+	target := net.ParseIP(ip)
+	if target == nil {
+		return false
+	}
+	if target.Equal(net.ParseIP(m.IP)) || target.Equal(net.ParseIP(m.IPv6)) {
+		return true
+	}
+	for _, a := range m.Addrs {
+		if target.Equal(net.ParseIP(a.IP)) {
+			return true
+		}
+	}
+	return false
+}
+
+// SourceMismatch 检查直接收到的消息源地址是否与通告地址不一致（可能是伪造）
+// 经中继转发的消息源地址为中继，不做检查
+func (m *Message) SourceMismatch() bool {
+	return m.Source != "" && m.Hops == 0 && !m.Advertises(m.Source)
+}
+
+// preferredAddrs 从地址列表中选择与本机同网段的 IPv4/IPv6 地址，没有则使用主地址
+func preferredAddrs(primary, primary6 string, addrs, local []Address) (ip, ipv6 string) {
+	ip, ipv6 = primary, primary6
+
+	if v4 := selectAddress(primary, addrs, local, false); v4 != "" {
+		ip = v4
+	}
+	// 仅 IPv6 模式下主地址也是 IPv6
+	v6only := strings.Contains(primary, ":")
+	if v6only {
+		primary6 = primary
+	}
+	if v6 := selectAddress(primary6, addrs, local, true); v6 != "" {
+		ipv6 = v6
+		if v6only {
+			ip = v6
+		}
+	}
+	return ip, ipv6
+}
+
+// selectAddress 选择与本机某个接口同网段的对端地址，没有或无法确定时返回空
+// 与本机地址相同的对端地址（如各自 docker0 的 172.17.0.1）不可能指向对端，直接跳过；
+// 多个对端地址分别落在不同的共享网段（如对端的网桥地址恰好与本机网桥同网段）时无法判断哪个可达，
+// 此时主地址在其中则选择主地址，否则返回空，由调用方回退到主地址
+func selectAddress(primary string, remote, local []Address, v6 bool) string {
+	var matched []string
+	for _, r := range remote {
+		ip := net.ParseIP(r.IP)
+		if ip == nil || (ip.To4() == nil) != v6 || isLocalAddress(ip, local) {
+			continue
+		}
+		for _, l := range local {
+			if subnet := l.network(); subnet != nil && subnet.Contains(ip) {
+				matched = append(matched, r.IP)
+				break
+			}
+		}
+	}
+
+	switch {
+	case len(matched) == 1:
+		return matched[0]
+	case slices.Contains(matched, primary):
+		return primary
+	default:
+		return ""
+	}
+}
+
+// isLocalAddress ip 是否为本机地址之一
+func isLocalAddress(ip net.IP, local []Address) bool {
+	for _, l := range local {
+		if ip.Equal(net.ParseIP(l.IP)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package network
+
+import "testing"
+
+func TestPreferredAddrs(t *testing.T) {
+	lan := Address{IP: "192.168.1.10", Iface: "eth0", Prefix: 24}
+	docker := Address{IP: "172.17.0.1", Iface: "docker0", Prefix: 16}
+	lan6 := Address{IP: "fd00::10", Iface: "eth0", Prefix: 64}
+
+	tests := []struct {
+		name     string
+		primary  string
+		primary6 string
+		remote   []Address
+		local    []Address
+		wantIP   string
+		wantIPv6 string
+	}{
+		{
+			name:    "同网段的非主地址",
+			primary: "10.0.0.20",
+			remote:  []Address{{IP: "10.0.0.20", Prefix: 24}, {IP: "192.168.1.20", Prefix: 24}},
+			local:   []Address{lan},
+			wantIP:  "192.168.1.20",
+		},
+		{
+			name:    "没有同网段地址时使用主地址",
+			primary: "10.0.0.20",
+			remote:  []Address{{IP: "10.0.0.20", Prefix: 24}},
+			local:   []Address{lan},
+			wantIP:  "10.0.0.20",
+		},
+		{
+			// 两台主机的局域网地址在不同的路由网段，各自都有 docker0
+			name:    "跳过与本机相同的网桥地址",
+			primary: "10.0.0.20",
+			remote:  []Address{{IP: "10.0.0.20", Prefix: 24}, {IP: "172.17.0.1", Prefix: 16}},
+			local:   []Address{lan, docker},
+			wantIP:  "10.0.0.20",
+		},
+		{
+			name:    "多个地址落在共享网段时使用主地址",
+			primary: "192.168.1.20",
+			remote:  []Address{{IP: "192.168.1.20", Prefix: 24}, {IP: "172.17.0.2", Prefix: 16}},
+			local:   []Address{lan, docker},
+			wantIP:  "192.168.1.20",
+		},
+		{
+			name:    "多个地址落在共享网段且主地址不在其中时使用主地址",
+			primary: "10.0.0.20",
+			remote:  []Address{{IP: "10.0.0.20", Prefix: 24}, {IP: "172.17.0.2", Prefix: 16}, {IP: "192.168.1.20", Prefix: 24}},
+			local:   []Address{lan, docker},
+			wantIP:  "10.0.0.20",
+		},
+		{
+			name:     "双栈分别选择",
+			primary:  "10.0.0.20",
+			primary6: "2001:db8::20",
+			remote:   []Address{{IP: "192.168.1.20", Prefix: 24}, {IP: "2001:db8::20", Prefix: 64}, {IP: "fd00::20", Prefix: 64}},
+			local:    []Address{lan, lan6},
+			wantIP:   "192.168.1.20",
+			wantIPv6: "fd00::20",
+		},
+		{
+			name:     "仅 IPv6 模式下主地址也是 IPv6",
+			primary:  "2001:db8::20",
+			remote:   []Address{{IP: "2001:db8::20", Prefix: 64}, {IP: "fd00::20", Prefix: 64}},
+			local:    []Address{lan6},
+			wantIP:   "fd00::20",
+			wantIPv6: "fd00::20",
+		},
+		{
+			name:    "忽略无效地址",
+			primary: "10.0.0.20",
+			remote:  []Address{{IP: "not-an-ip", Prefix: 24}, {IP: "192.168.1.20", Prefix: 24}},
+			local:   []Address{lan, {IP: "bad", Prefix: 24}},
+			wantIP:  "192.168.1.20",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip, ipv6 := preferredAddrs(tt.primary, tt.primary6, tt.remote, tt.local)
+			if ip != tt.wantIP || ipv6 != tt.wantIPv6 {
+				t.Fatalf("preferredAddrs = %q, %q, want %q, %q", ip, ipv6, tt.wantIP, tt.wantIPv6)
+			}
+		})
+	}
+}
+
+func TestSourceMismatch(t *testing.T) {
+	msg := &Message{IP: "10.0.0.20", Addrs: []Address{{IP: "192.168.1.20", Prefix: 24}}}
+	for source, want := range map[string]bool{"": false, "10.0.0.20": false, "192.168.1.20": false, "10.0.0.99": true} {
+		msg.Source = source
+		if got := msg.SourceMismatch(); got != want {
+			t.Errorf("SourceMismatch(%q) = %v, want %v", source, got, want)
+		}
+	}
+	// 经中继转发的消息源地址为中继
+	msg.Source, msg.Hops = "10.0.0.99", 1
+	if msg.SourceMismatch() {
+		t.Error("中继转发的消息不应检查源地址")
+	}
+}
@@ -0,0 +1,223 @@
+package network
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// 加密模式
+const (
+	EncryptionPlain = "plain" // 明文 JSON（兼容旧版本）
+	EncryptionAEAD  = "aead"  // AES-256-GCM 加密信封
+)
+
+// 消息解码错误
+var (
+	ErrUnsigned      = errors.New("消息未签名")
+	ErrBadSignature  = errors.New("消息签名无效")
+	ErrPlaintext     = errors.New("拒绝明文消息")
+	ErrUndecryptable = errors.New("消息解密失败")
+)
+
+// 密钥派生参数
+const (
+	kdfSalt       = "lanlink-aead-v1"
+	kdfIterations = 4096
+)
+
+// envelope 消息信封
+// 签名模式: payload + sig，签名针对原始 payload 字节计算，避免重新序列化导致的差异
+// 加密模式: mode + nonce + data，data 为 AEAD 密文
+type envelope struct {
+	Payload json.RawMessage `json:"payload,omitempty"` // 原始消息
+	Sig     string          `json:"sig,omitempty"`     // HMAC-SHA256 签名（hex）
+	Mode    string          `json:"mode,omitempty"`    // 加密模式
+	Nonce   []byte          `json:"nonce,omitempty"`   // AEAD nonce
+	Data    []byte          `json:"data,omitempty"`    // 密文
+}
+
+// Codec 消息编解码器
+// 配置了集群密钥时，明文消息会被签名，接收时校验签名；
+// 加密模式下使用由集群密钥派生的 AES-256-GCM 密钥加密整个消息；
+// 未配置密钥时收发普通 JSON 消息（兼容旧版本）
+type Codec struct {
+	secret          []byte
+	aead            cipher.AEAD // 配置了密钥即可解密，encrypt 决定是否加密发送
+	encrypt         bool
+	acceptPlaintext bool
+}
+
+// NewCodec 创建编解码器
+// secret 为空表示不签名；mode 为 plain 或 aead，aead 模式必须配置 secret；
+// acceptPlaintext 表示是否仍接收未签名的旧版本 JSON 消息（加密模式下还包括签名的明文消息），便于集群逐步迁移
+func NewCodec(secret, mode string, acceptPlaintext bool) (*Codec, error) {
+	c := &Codec{acceptPlaintext: acceptPlaintext}
+
+	switch mode {
+	case "", EncryptionPlain:
+	case EncryptionAEAD:
+		if secret == "" {
+			return nil, fmt.Errorf("加密模式需要配置集群密钥")
+		}
+		c.encrypt = true
+	default:
+		return nil, fmt.Errorf("未知的加密模式: %s", mode)
+	}
+
+	if secret != "" {
+		c.secret = []byte(secret)
+		block, err := aes.NewCipher(deriveKey(c.secret))
+		if err != nil {
+			return nil, err
+		}
+		if c.aead, err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// Signed 是否启用签名
+func (c *Codec) Signed() bool {
+	return len(c.secret) > 0
+}
+
+// AcceptsUnsigned 是否接收未签名的消息（未配置密钥，或迁移期间接收旧版本消息）
+func (c *Codec) AcceptsUnsigned() bool {
+	return !c.Signed() || c.acceptPlaintext
+}
+
+// Encrypted 是否加密发送
+func (c *Codec) Encrypted() bool {
+	return c.encrypt
+}
+
+// Encode 编码消息
+func (c *Codec) Encode(msg *Message) ([]byte, error) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.encrypt {
+		nonce := make([]byte, c.aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, err
+		}
+		return json.Marshal(&envelope{
+			Mode:  EncryptionAEAD,
+			Nonce: nonce,
+			Data:  c.aead.Seal(nil, nonce, payload, []byte(EncryptionAEAD)),
+		})
+	}
+
+	if !c.Signed() {
+		return payload, nil
+	}
+
+	return json.Marshal(&envelope{
+		Payload: payload,
+		Sig:     c.sign(payload),
+	})
+}
+
+// Decode 解码消息
+// 启用签名时，未签名或签名错误的消息分别返回 ErrUnsigned / ErrBadSignature，
+// acceptPlaintext 时旧版本的普通 JSON 消息仍然接收；
+// 加密模式下不接收明文时返回 ErrPlaintext，无法解密时返回 ErrUndecryptable；
+// 签名校验或解密通过的消息 Authenticated 为 true
+func (c *Codec) Decode(data []byte) (*Message, error) {
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, decodeError(err, data)
+	}
+
+	var payload []byte
+	authenticated := false
+	switch {
+	case env.Mode == EncryptionAEAD:
+		// AEAD 本身带认证，无需再校验签名
+		if c.aead == nil || len(env.Nonce) != c.aead.NonceSize() {
+			return nil, ErrUndecryptable
+		}
+		plain, err := c.aead.Open(nil, env.Nonce, env.Data, []byte(EncryptionAEAD))
+		if err != nil {
+			return nil, ErrUndecryptable
+		}
+		payload = plain
+		authenticated = true
+
+	case env.Mode != "":
+		return nil, fmt.Errorf("未知的加密模式: %s", env.Mode)
+
+	default:
+		if c.encrypt && !c.acceptPlaintext {
+			return nil, ErrPlaintext
+		}
+		payload = []byte(env.Payload)
+		if len(payload) == 0 {
+			// 普通 JSON 消息（旧版本节点），迁移期间允许接收
+			if c.Signed() && !c.acceptPlaintext {
+				return nil, ErrUnsigned
+			}
+			payload = data
+		} else if c.Signed() {
+			if env.Sig == "" {
+				return nil, ErrUnsigned
+			}
+			if !c.verify(payload, env.Sig) {
+				return nil, ErrBadSignature
+			}
+			authenticated = true
+		}
+	}
+
+	var msg Message
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return nil, decodeError(err, payload)
+	}
+	msg.Authenticated = authenticated
+	return &msg, nil
+}
+
+// decodeError 区分被截断的数据和其他解析错误
+func decodeError(err error, data []byte) error {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) && syntaxErr.Offset >= int64(len(data)) {
+		return fmt.Errorf("%w: %v", ErrTruncated, err)
+	}
+	return err
+}
+
+// sign 计算签名
+func (c *Codec) sign(payload []byte) string {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify 校验签名
+func (c *Codec) verify(payload []byte, sig string) bool {
+	expected, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write(payload)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// deriveKey 从集群密钥派生 32 字节加密密钥（PBKDF2-HMAC-SHA256）
+func deriveKey(secret []byte) []byte {
+	return pbkdf2.Key(secret, []byte(kdfSalt), kdfIterations, 32, sha256.New)
+}
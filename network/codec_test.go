@@ -0,0 +1,74 @@
+package network
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// TestDeriveKey 密钥派生结果必须与已部署的版本一致，否则新旧节点无法互相解密
+func TestDeriveKey(t *testing.T) {
+	want := "f5991757d9889e4277f14e402fc1d6b16ea8b9e729a4ec21adc1ca6e8b85892c"
+	if got := hex.EncodeToString(deriveKey([]byte("password"))); got != want {
+		t.Fatalf("deriveKey = %s, want %s", got, want)
+	}
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	for _, mode := range []string{EncryptionPlain, EncryptionAEAD} {
+		c, err := NewCodec("secret", mode, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := c.Encode(&Message{Action: ActionHeartbeat, Domain: "a.coobee.local"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg, err := c.Decode(data)
+		if err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+		if msg.Domain != "a.coobee.local" {
+			t.Fatalf("%s: domain = %q", mode, msg.Domain)
+		}
+	}
+}
+
+func TestCodecMigration(t *testing.T) {
+	legacy, _ := json.Marshal(&Message{Action: ActionHeartbeat, Domain: "old.coobee.local"})
+
+	signer, _ := NewCodec("secret", EncryptionPlain, false)
+	signed, _ := signer.Encode(&Message{Action: ActionHeartbeat, Domain: "signed.coobee.local"})
+
+	other, _ := NewCodec("other", EncryptionPlain, false)
+	forged, _ := other.Encode(&Message{Action: ActionHeartbeat, Domain: "forged.coobee.local"})
+
+	tests := []struct {
+		name    string
+		mode    string
+		accept  bool
+		data    []byte
+		wantErr error
+	}{
+		{"签名模式拒绝旧版本消息", EncryptionPlain, false, legacy, ErrUnsigned},
+		{"签名模式迁移期接收旧版本消息", EncryptionPlain, true, legacy, nil},
+		{"迁移期仍校验签名", EncryptionPlain, true, forged, ErrBadSignature},
+		{"加密模式拒绝明文", EncryptionAEAD, false, signed, ErrPlaintext},
+		{"加密模式迁移期接收签名消息", EncryptionAEAD, true, signed, nil},
+		{"加密模式迁移期接收旧版本消息", EncryptionAEAD, true, legacy, nil},
+		{"加密模式迁移期仍校验签名", EncryptionAEAD, true, forged, ErrBadSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewCodec("secret", tt.mode, tt.accept)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = c.Decode(tt.data)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Decode error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
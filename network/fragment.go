@@ -0,0 +1,203 @@
+package network
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// maxDatagramSize 单个数据报的最大长度，超过则分片发送
+	// 小于常见以太网 MTU 扣除 IP/UDP 头后的长度，避免 IP 层分片（组播下 IP 分片容易丢失）
+	maxDatagramSize = 1200
+	// maxFragments 单条消息的最大分片数
+	maxFragments = 64
+	// maxPendingMessages 同时重组中的消息数上限，防止伪造分片耗尽内存
+	maxPendingMessages = 256
+	// maxPendingPerSource 每个源地址同时重组中的消息数上限，单个来源不能占满重组表
+	maxPendingPerSource = 8
+	// reassemblyTimeout 分片重组超时
+	reassemblyTimeout = 5 * time.Second
+)
+
+// fragmentMagic 分片数据报标识，JSON 消息以 '{' 开头，不会与之冲突
+var fragmentMagic = []byte("LLFR")
+
+// fragmentHeaderSize 分片头长度: magic(4) + 消息ID(8) + 序号(2) + 总数(2)
+const fragmentHeaderSize = 16
+
+// 分片错误
+var (
+	ErrMessageTooLarge = errors.New("消息超过最大长度")
+	ErrTruncated       = errors.New("消息被截断")
+)
+
+// splitFragments 将编码后的消息拆分为数据报
+// 不超过 maxDatagramSize 的消息原样发送，与旧版本兼容
+func splitFragments(data []byte) ([][]byte, error) {
+	if len(data) <= maxDatagramSize {
+		return [][]byte{data}, nil
+	}
+
+	chunkSize := maxDatagramSize - fragmentHeaderSize
+	total := (len(data) + chunkSize - 1) / chunkSize
+	if total > maxFragments {
+		return nil, fmt.Errorf("%w: %d 字节", ErrMessageTooLarge, len(data))
+	}
+
+	id := rand.Uint64()
+	packets := make([][]byte, 0, total)
+	for i := 0; i < total; i++ {
+		end := min((i+1)*chunkSize, len(data))
+		packet := make([]byte, fragmentHeaderSize, fragmentHeaderSize+end-i*chunkSize)
+		copy(packet, fragmentMagic)
+		binary.BigEndian.PutUint64(packet[4:], id)
+		binary.BigEndian.PutUint16(packet[12:], uint16(i))
+		binary.BigEndian.PutUint16(packet[14:], uint16(total))
+		packets = append(packets, append(packet, data[i*chunkSize:end]...))
+	}
+	return packets, nil
+}
+
+// writePackets 依次发送消息的全部数据报
+func writePackets(conn *net.UDPConn, packets [][]byte, addr *net.UDPAddr) error {
+	for _, packet := range packets {
+		if _, err := conn.WriteToUDP(packet, addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// partialMessage 重组中的消息
+type partialMessage struct {
+	source   string // 源 IP（不含端口）
+	chunks   [][]byte
+	received int
+	started  time.Time
+}
+
+// reassembler 分片重组器
+// 每个源 IP 最多同时重组 maxPendingPerSource 条消息；重组表已满时淘汰最早开始的消息，
+// 不收齐分片的来源不能长期占用重组表，使合法的分片消息被拒绝
+type reassembler struct {
+	mu       sync.Mutex
+	pending  map[string]*partialMessage // key: 源地址 + 消息ID
+	bySource map[string]int             // 源 IP -> 重组中的消息数
+	stats    *counters
+}
+
+// newReassembler 创建分片重组器
+func newReassembler(stats *counters) *reassembler {
+	return &reassembler{
+		pending:  make(map[string]*partialMessage),
+		bySource: make(map[string]int),
+		stats:    stats,
+	}
+}
+
+// add 处理收到的数据报
+// 非分片数据报原样返回；分片未收齐时返回 nil；收齐后返回完整消息
+func (r *reassembler) add(src string, packet []byte) ([]byte, error) {
+	if !bytes.HasPrefix(packet, fragmentMagic) {
+		return packet, nil
+	}
+	if len(packet) <= fragmentHeaderSize {
+		return nil, ErrTruncated
+	}
+
+	id := binary.BigEndian.Uint64(packet[4:])
+	index := int(binary.BigEndian.Uint16(packet[12:]))
+	total := int(binary.BigEndian.Uint16(packet[14:]))
+	if total == 0 || total > maxFragments || index >= total {
+		return nil, fmt.Errorf("无效的分片头: %d/%d", index, total)
+	}
+	r.stats.fragments.Add(1)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.expire()
+
+	key := fmt.Sprintf("%s/%x", src, id)
+	partial, ok := r.pending[key]
+	if !ok {
+		source := src
+		if host, _, err := net.SplitHostPort(src); err == nil {
+			source = host
+		}
+		if r.bySource[source] >= maxPendingPerSource {
+			return nil, fmt.Errorf("来源 %s 重组中的消息过多", source)
+		}
+		if len(r.pending) >= maxPendingMessages {
+			r.evictOldest()
+		}
+		partial = &partialMessage{
+			source:  source,
+			chunks:  make([][]byte, total),
+			started: time.Now(),
+		}
+		r.pending[key] = partial
+		r.bySource[source]++
+	}
+	if len(partial.chunks) != total {
+		return nil, fmt.Errorf("分片总数不一致: %d != %d", total, len(partial.chunks))
+	}
+	if partial.chunks[index] != nil {
+		// 重复分片
+		return nil, nil
+	}
+
+	// 接收缓冲区会被复用，需要复制分片内容
+	partial.chunks[index] = append([]byte(nil), packet[fragmentHeaderSize:]...)
+	partial.received++
+	if partial.received < total {
+		return nil, nil
+	}
+
+	r.remove(key)
+	r.stats.reassembled.Add(1)
+	return bytes.Join(partial.chunks, nil), nil
+}
+
+// expire 清理超时未收齐的消息，调用方需持有锁
+func (r *reassembler) expire() {
+	now := time.Now()
+	for key, partial := range r.pending {
+		if now.Sub(partial.started) > reassemblyTimeout {
+			r.remove(key)
+			r.stats.incomplete.Add(1)
+		}
+	}
+}
+
+// evictOldest 淘汰最早开始重组的消息，调用方需持有锁
+func (r *reassembler) evictOldest() {
+	oldest := ""
+	for key, partial := range r.pending {
+		if oldest == "" || partial.started.Before(r.pending[oldest].started) {
+			oldest = key
+		}
+	}
+	if oldest != "" {
+		r.remove(oldest)
+		r.stats.incomplete.Add(1)
+	}
+}
+
+// remove 删除重组中的消息，调用方需持有锁
+func (r *reassembler) remove(key string) {
+	partial, ok := r.pending[key]
+	if !ok {
+		return
+	}
+	delete(r.pending, key)
+	if r.bySource[partial.source]--; r.bySource[partial.source] <= 0 {
+		delete(r.bySource, partial.source)
+	}
+}
@@ -0,0 +1,180 @@
+package network
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// testPayload 生成指定长度的消息内容
+func testPayload(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte('a' + i%26)
+	}
+	return data
+}
+
+func TestFragmentReassembly(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		shuffle bool
+	}{
+		{"不分片", maxDatagramSize, false},
+		{"两个分片", maxDatagramSize + 1, false},
+		{"乱序", 20 * maxDatagramSize, true},
+		{"最大长度", maxFragments * (maxDatagramSize - fragmentHeaderSize), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := testPayload(tt.size)
+			packets, err := splitFragments(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, packet := range packets {
+				if len(packet) > maxDatagramSize {
+					t.Fatalf("数据报长度 %d 超过 %d", len(packet), maxDatagramSize)
+				}
+			}
+			if tt.shuffle {
+				rand.Shuffle(len(packets), func(i, j int) { packets[i], packets[j] = packets[j], packets[i] })
+			}
+
+			var stats counters
+			r := newReassembler(&stats)
+			var got []byte
+			for i, packet := range packets {
+				out, err := r.add("10.0.0.1:9527", packet)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if i < len(packets)-1 && out != nil {
+					t.Fatalf("第 %d 个分片后提前完成重组", i+1)
+				}
+				got = out
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatalf("重组结果长度 %d, want %d", len(got), len(data))
+			}
+			if len(r.pending) != 0 || len(r.bySource) != 0 {
+				t.Fatalf("重组完成后仍有记录: %d, %d", len(r.pending), len(r.bySource))
+			}
+		})
+	}
+}
+
+func TestFragmentTooLarge(t *testing.T) {
+	_, err := splitFragments(testPayload(maxFragments*(maxDatagramSize-fragmentHeaderSize) + 1))
+	if !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("err = %v, want ErrMessageTooLarge", err)
+	}
+}
+
+func TestFragmentInvalid(t *testing.T) {
+	packets, _ := splitFragments(testPayload(3 * maxDatagramSize))
+	header := func(index, total uint16) []byte {
+		p := append([]byte(nil), packets[0]...)
+		p[12], p[13], p[14], p[15] = byte(index>>8), byte(index), byte(total>>8), byte(total)
+		return p
+	}
+	tests := []struct {
+		name   string
+		packet []byte
+	}{
+		{"只有分片头", packets[0][:fragmentHeaderSize]},
+		{"总数为 0", header(0, 0)},
+		{"序号超出总数", header(3, 3)},
+		{"总数过多", header(0, maxFragments+1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stats counters
+			if _, err := newReassembler(&stats).add("10.0.0.1:9527", tt.packet); err == nil {
+				t.Fatal("应返回错误")
+			}
+		})
+	}
+
+	// 同一消息的分片总数不一致
+	var stats counters
+	r := newReassembler(&stats)
+	r.add("10.0.0.1:9527", packets[0])
+	if _, err := r.add("10.0.0.1:9527", header(1, uint16(len(packets)+1))); err == nil {
+		t.Fatal("分片总数不一致应返回错误")
+	}
+
+	// 重复分片被忽略
+	if out, err := r.add("10.0.0.1:9527", packets[0]); out != nil || err != nil {
+		t.Fatalf("重复分片: %v, %v", out, err)
+	}
+}
+
+func TestFragmentTimeout(t *testing.T) {
+	packets, _ := splitFragments(testPayload(3 * maxDatagramSize))
+	var stats counters
+	r := newReassembler(&stats)
+	r.add("10.0.0.1:9527", packets[0])
+
+	for _, partial := range r.pending {
+		partial.started = time.Now().Add(-2 * reassemblyTimeout)
+	}
+	// 超时后剩余的分片开始新的重组，不会拼接到已超时的消息上
+	if out, _ := r.add("10.0.0.1:9527", packets[1]); out != nil {
+		t.Fatal("超时的消息完成了重组")
+	}
+	if stats.incomplete.Load() != 1 {
+		t.Fatalf("incomplete = %d, want 1", stats.incomplete.Load())
+	}
+}
+
+func TestFragmentPendingLimits(t *testing.T) {
+	var stats counters
+	r := newReassembler(&stats)
+
+	// incomplete 每次返回新消息的第一个分片
+	incomplete := func() []byte {
+		packets, _ := splitFragments(testPayload(2 * maxDatagramSize))
+		return packets[0]
+	}
+
+	// 单个来源（不区分端口）最多同时重组 maxPendingPerSource 条消息
+	for i := 0; i < maxPendingPerSource; i++ {
+		if _, err := r.add(fmt.Sprintf("10.0.0.66:%d", 1000+i), incomplete()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := r.add("10.0.0.66:2000", incomplete()); err == nil {
+		t.Fatal("超出单个来源的重组上限")
+	}
+
+	// 多个来源占满重组表后淘汰最早的消息，合法的分片消息仍能完成重组
+	for i := 0; len(r.pending) < maxPendingMessages; i++ {
+		if _, err := r.add(fmt.Sprintf("10.1.%d.%d:9527", i/200, i%200), incomplete()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data := testPayload(3 * maxDatagramSize)
+	packets, _ := splitFragments(data)
+	var got []byte
+	for _, packet := range packets {
+		out, err := r.add("10.0.0.1:9527", packet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = out
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("重组表已满时合法消息未完成重组")
+	}
+	if len(r.pending) > maxPendingMessages {
+		t.Fatalf("pending = %d, want <= %d", len(r.pending), maxPendingMessages)
+	}
+	if r.bySource["10.0.0.66"] >= maxPendingPerSource {
+		t.Fatal("最早的消息未被淘汰")
+	}
+}
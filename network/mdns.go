@@ -0,0 +1,703 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	mdnsPort  = 5353
+	mdnsAddr  = "224.0.0.251"
+	mdnsAddr6 = "ff02::fb"
+
+	// mdnsTTL 本机记录的 TTL（秒）
+	mdnsTTL = 120
+	// mdnsLegacyTTL 应答传统单播查询（源端口不是 5353）时使用的 TTL（秒）
+	mdnsLegacyTTL = 10
+	// mdnsCacheFlush class 字段最高位：应答中表示缓存刷新，查询中表示请求单播应答
+	mdnsCacheFlush = 1 << 15
+	// mdnsMaxPacket mDNS 数据包最大长度
+	mdnsMaxPacket = 9000
+	// mdnsSuffix mDNS 主机名的后缀，浏览到的 SRV 目标主机必须在其下
+	mdnsSuffix = ".local."
+	// mdnsMaxTTL 缓存记录的最长有效期（秒，RFC 6762 建议的 75 分钟），超过的按此截断
+	mdnsMaxTTL = 4500
+	// mdnsMaxEntries 每类缓存的最大条目数，已满时淘汰最早过期的
+	mdnsMaxEntries = 256
+	// mdnsMaxAddrs 每个主机缓存的最大地址数
+	mdnsMaxAddrs = 8
+)
+
+// MDNSHost 通过 mDNS 浏览到的主机
+type MDNSHost struct {
+	Instance string        // 服务实例名，如 "nas [00:11:22:33:44:55]._workstation._tcp.local."
+	Host     string        // 主机名，如 "nas.local."
+	IPs      []string      // 主机地址，IPv4 在前
+	TTL      time.Duration // 记录的剩余有效期，到期未刷新视为离线
+}
+
+// mdnsRecord 带过期时间的缓存记录
+type mdnsRecord struct {
+	value   string
+	expires time.Time
+}
+
+// MDNS mDNS 响应器和浏览器
+// 响应器为本机的 LanLink 域名应答 A/AAAA 查询和本机服务的 SRV 查询；浏览器定期查询指定的服务类型（如 _workstation._tcp），
+// 解析出主机名和地址后通过回调通知。与系统的 Avahi、Bonjour 共用 5353 端口
+type MDNS struct {
+	mode   string
+	policy *InterfacePolicy
+
+	mu        sync.Mutex // 保护以下字段和已加入组播组的接口
+	conns     []*groupConn
+	domain    string           // 本机应答的域名（FQDN），为空表示不应答
+	addrs     func() []Address // 本机当前地址
+	offered   []Service        // 本机提供的服务，应答 SRV 查询
+	services  []string         // 浏览的服务类型（FQDN）
+	interval  time.Duration    // 浏览间隔
+	onHost    func(MDNSHost)
+	instances map[string]mdnsRecord           // key: 服务实例名，value: 服务类型
+	targets   map[string]mdnsRecord           // key: 服务实例名，value: SRV 目标主机名
+	hosts     map[string]map[string]time.Time // key: 主机名，value: 地址 -> 过期时间
+
+	stop      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// NewMDNS 创建 mDNS 响应器和浏览器
+// mode 为 ipv4/ipv6/dual，policy 决定加入组播组的网卡，为 nil 表示使用全部网卡
+func NewMDNS(mode string, policy *InterfacePolicy) *MDNS {
+	return &MDNS{
+		mode:      mode,
+		policy:    policy,
+		instances: make(map[string]mdnsRecord),
+		targets:   make(map[string]mdnsRecord),
+		hosts:     make(map[string]map[string]time.Time),
+		stop:      make(chan struct{}),
+	}
+}
+
+// SetHost 设置本机应答的域名，addrs 返回本机当前地址（网络变化后应答新地址）
+func (m *MDNS) SetHost(domain string, addrs func() []Address) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.domain = fqdn(domain)
+	m.addrs = addrs
+}
+
+// SetServices 设置本机提供的服务，应答 _name._proto.{domain} 的 SRV 查询
+func (m *MDNS) SetServices(services []Service) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.offered = services
+}
+
+// Browse 设置浏览的服务类型（如 _workstation._tcp）、查询间隔和主机回调
+// 回调在收到相关记录时触发，同一主机会随记录刷新多次触发
+func (m *MDNS) Browse(services []string, interval time.Duration, callback func(MDNSHost)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.services = m.services[:0]
+	for _, service := range services {
+		service = strings.TrimSuffix(strings.ToLower(service), ".")
+		if !strings.HasSuffix(service, ".local") {
+			service += ".local"
+		}
+		m.services = append(m.services, service+".")
+	}
+	m.interval = interval
+	m.onHost = callback
+}
+
+// Start 开始监听 mDNS 组播，ctx 取消时关闭
+func (m *MDNS) Start(ctx context.Context) error {
+	if m.mode != IPModeIPv6 {
+		if err := m.listen("udp4", mdnsAddr); err != nil {
+			m.closeConns()
+			return err
+		}
+	}
+	if m.mode != IPModeIPv4 {
+		if err := m.listen("udp6", mdnsAddr6); err != nil {
+			m.closeConns()
+			return err
+		}
+	}
+
+	for _, gc := range m.conns {
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			m.receiveLoop(gc)
+		}()
+	}
+	if len(m.services) > 0 && m.interval > 0 {
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			m.browseLoop()
+		}()
+	}
+	m.Announce()
+
+	context.AfterFunc(ctx, func() { m.Close() })
+	return nil
+}
+
+// listen 监听指定地址族的 mDNS 端口并加入组播组
+func (m *MDNS) listen(network, addr string) error {
+	group := &net.UDPAddr{IP: net.ParseIP(addr), Port: mdnsPort}
+
+	lc := net.ListenConfig{Control: reusePort}
+	pc, err := lc.ListenPacket(context.Background(), network, fmt.Sprintf(":%d", mdnsPort))
+	if err != nil {
+		return fmt.Errorf("监听 mDNS 端口失败: %v", err)
+	}
+	conn := pc.(*net.UDPConn)
+
+	// mDNS 要求组播数据包的 TTL 为 255
+	var join func(iface *net.Interface) error
+	if network == "udp4" {
+		packetConn := ipv4.NewPacketConn(conn)
+		packetConn.SetMulticastTTL(255)
+		join = func(iface *net.Interface) error {
+			return packetConn.JoinGroup(iface, group)
+		}
+	} else {
+		packetConn := ipv6.NewPacketConn(conn)
+		packetConn.SetMulticastHopLimit(255)
+		join = func(iface *net.Interface) error {
+			return packetConn.JoinGroup(iface, group)
+		}
+	}
+
+	ifaces, err := joinGroup(m.policy, join, nil)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	m.conns = append(m.conns, &groupConn{conn: conn, group: group, join: join, ifaces: ifaces})
+	return nil
+}
+
+// Refresh 在新启用的网卡上加入组播组，并重新通告本机记录（本机地址变化后调用）
+func (m *MDNS) Refresh() {
+	m.mu.Lock()
+	for _, gc := range m.conns {
+		gc.ifaces, _ = joinGroup(m.policy, gc.join, gc.ifaces)
+	}
+	m.mu.Unlock()
+	m.Announce()
+}
+
+// Announce 主动通告本机记录，使其他设备的缓存立即更新
+func (m *MDNS) Announce() {
+	// 没有可用的网卡时发送失败，等待网络变化后重新通告
+	m.announce(mdnsTTL)
+}
+
+// Close 发送记录失效通告、关闭连接并等待协程退出，可重复调用
+func (m *MDNS) Close() error {
+	m.closeOnce.Do(func() {
+		m.announce(0)
+		close(m.stop)
+		m.closeConns()
+	})
+	m.wg.Wait()
+	return nil
+}
+
+// closeConns 关闭全部连接
+func (m *MDNS) closeConns() {
+	for _, gc := range m.conns {
+		gc.conn.Close()
+	}
+}
+
+// announce 发送本机记录，ttl 为 0 表示记录失效
+func (m *MDNS) announce(ttl uint32) error {
+	answers := m.records(dnsmessage.TypeALL, ttl, true)
+	if len(answers) == 0 {
+		return nil
+	}
+	data, err := (&dnsmessage.Message{
+		Header:  dnsmessage.Header{Response: true, Authoritative: true},
+		Answers: answers,
+	}).Pack()
+	if err != nil {
+		return err
+	}
+	return m.broadcast(data)
+}
+
+// query 发送浏览查询：服务类型的 PTR，以及缓存中尚不完整的实例的 SRV 和主机地址
+func (m *MDNS) query() error {
+	m.mu.Lock()
+	var questions []dnsmessage.Question
+	ask := func(name string, qtype dnsmessage.Type) {
+		if n, err := dnsmessage.NewName(name); err == nil {
+			questions = append(questions, dnsmessage.Question{Name: n, Type: qtype, Class: dnsmessage.ClassINET})
+		}
+	}
+	for _, service := range m.services {
+		ask(service, dnsmessage.TypePTR)
+	}
+	for instance := range m.instances {
+		target, ok := m.targets[instance]
+		if !ok {
+			ask(instance, dnsmessage.TypeSRV)
+			continue
+		}
+		if len(m.hosts[target.value]) == 0 {
+			if m.mode != IPModeIPv6 {
+				ask(target.value, dnsmessage.TypeA)
+			}
+			if m.mode != IPModeIPv4 {
+				ask(target.value, dnsmessage.TypeAAAA)
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	data, err := (&dnsmessage.Message{Questions: questions}).Pack()
+	if err != nil {
+		return err
+	}
+	return m.broadcast(data)
+}
+
+// broadcast 发送到全部地址族的 mDNS 组播组
+func (m *MDNS) broadcast(data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var errs []error
+	for _, gc := range m.conns {
+		if err := gc.send([][]byte{data}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// records 构造本机域名的 A/AAAA 记录，qtype 为 TypeALL 时返回全部
+func (m *MDNS) records(qtype dnsmessage.Type, ttl uint32, flush bool) []dnsmessage.Resource {
+	m.mu.Lock()
+	domain, addrs := m.domain, m.addrs
+	m.mu.Unlock()
+	if domain == "" || addrs == nil {
+		return nil
+	}
+	name, err := dnsmessage.NewName(domain)
+	if err != nil {
+		return nil
+	}
+
+	class := dnsmessage.ClassINET
+	if flush {
+		class |= mdnsCacheFlush
+	}
+	var records []dnsmessage.Resource
+	for _, addr := range addrs() {
+		ip := net.ParseIP(addr.IP)
+		if ip == nil {
+			continue
+		}
+		header := dnsmessage.ResourceHeader{Name: name, Class: class, TTL: ttl}
+		if v4 := ip.To4(); v4 != nil {
+			if qtype == dnsmessage.TypeA || qtype == dnsmessage.TypeALL {
+				records = append(records, dnsmessage.Resource{Header: header, Body: &dnsmessage.AResource{A: [4]byte(v4)}})
+			}
+		} else if qtype == dnsmessage.TypeAAAA || qtype == dnsmessage.TypeALL {
+			records = append(records, dnsmessage.Resource{Header: header, Body: &dnsmessage.AAAAResource{AAAA: [16]byte(ip.To16())}})
+		}
+	}
+	return records
+}
+
+// srvRecord 构造本机服务的 SRV 记录，name 不是本机服务时返回 false
+func (m *MDNS) srvRecord(name string, ttl uint32, flush bool) (dnsmessage.Resource, bool) {
+	service, proto, host, ok := ParseSRVName(name)
+	if !ok {
+		return dnsmessage.Resource{}, false
+	}
+	m.mu.Lock()
+	domain, offered := m.domain, m.offered
+	m.mu.Unlock()
+	if fqdn(host) != domain {
+		return dnsmessage.Resource{}, false
+	}
+	svc, ok := FindService(offered, service, proto)
+	if !ok {
+		return dnsmessage.Resource{}, false
+	}
+
+	srvName, err := dnsmessage.NewName(name)
+	if err != nil {
+		return dnsmessage.Resource{}, false
+	}
+	target, err := dnsmessage.NewName(domain)
+	if err != nil {
+		return dnsmessage.Resource{}, false
+	}
+	class := dnsmessage.ClassINET
+	if flush {
+		class |= mdnsCacheFlush
+	}
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: srvName, Class: class, TTL: ttl},
+		Body:   &dnsmessage.SRVResource{Port: uint16(svc.Port), Target: target},
+	}, true
+}
+
+// receiveLoop 接收 mDNS 数据包
+func (m *MDNS) receiveLoop(gc *groupConn) {
+	buffer := make([]byte, mdnsMaxPacket)
+	for {
+		n, src, err := gc.conn.ReadFromUDP(buffer)
+		if err != nil {
+			return
+		}
+
+		var msg dnsmessage.Message
+		if err := msg.Unpack(buffer[:n]); err != nil {
+			continue
+		}
+		if msg.Header.Response {
+			m.handleResponse(&msg)
+		} else {
+			m.handleQuery(gc, &msg, src)
+		}
+	}
+}
+
+// handleQuery 应答针对本机域名的 A/AAAA 查询
+// 源端口不是 5353 的传统单播查询（如 dig -p 5353）直接单播应答
+func (m *MDNS) handleQuery(gc *groupConn, query *dnsmessage.Message, src *net.UDPAddr) {
+	m.mu.Lock()
+	domain := m.domain
+	m.mu.Unlock()
+	if domain == "" {
+		return
+	}
+
+	legacy := src.Port != mdnsPort
+	ttl := uint32(mdnsTTL)
+	if legacy {
+		ttl = mdnsLegacyTTL
+	}
+
+	resp := dnsmessage.Message{Header: dnsmessage.Header{Response: true, Authoritative: true}}
+	for _, q := range query.Questions {
+		class := q.Class &^ mdnsCacheFlush
+		if class != dnsmessage.ClassINET && class != dnsmessage.ClassANY {
+			continue
+		}
+		if strings.EqualFold(q.Name.String(), domain) {
+			if answers := m.records(q.Type, ttl, !legacy); len(answers) > 0 {
+				resp.Questions = append(resp.Questions, q)
+				resp.Answers = append(resp.Answers, answers...)
+			}
+			continue
+		}
+		if q.Type != dnsmessage.TypeSRV && q.Type != dnsmessage.TypeALL {
+			continue
+		}
+		if answer, ok := m.srvRecord(q.Name.String(), ttl, !legacy); ok {
+			resp.Questions = append(resp.Questions, q)
+			resp.Answers = append(resp.Answers, answer)
+			// 附带本机地址，查询方无需再次查询
+			if len(resp.Additionals) == 0 {
+				resp.Additionals = m.records(dnsmessage.TypeALL, ttl, !legacy)
+			}
+		}
+	}
+	if len(resp.Answers) == 0 {
+		return
+	}
+
+	if legacy {
+		// 传统单播应答需要回显查询 ID 和问题
+		resp.ID = query.ID
+		if data, err := resp.Pack(); err == nil {
+			gc.conn.WriteToUDP(data, src)
+		}
+		return
+	}
+
+	resp.Questions = nil
+	data, err := resp.Pack()
+	if err != nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	gc.send([][]byte{data})
+}
+
+// handleResponse 缓存应答中的 PTR、SRV 和地址记录，并通知信息完整的主机
+// 只缓存浏览的服务类型下的实例、.local 下的 SRV 目标以及这些目标的地址，有效期和条目数均有上限
+func (m *MDNS) handleResponse(resp *dnsmessage.Message) {
+	now := time.Now()
+
+	m.mu.Lock()
+	if len(m.services) == 0 {
+		m.mu.Unlock()
+		return
+	}
+	touched := make(map[string]bool)
+	records := slices.Concat(resp.Answers, resp.Additionals)
+	// 地址记录最后处理，此时同一应答中的 SRV 目标已经缓存
+	slices.SortStableFunc(records, func(a, b dnsmessage.Resource) int {
+		return compareBool(isAddrRecord(a), isAddrRecord(b))
+	})
+	for _, r := range records {
+		name := strings.ToLower(r.Header.Name.String())
+		ttl := min(r.Header.TTL, mdnsMaxTTL)
+		expires := now.Add(time.Duration(ttl) * time.Second)
+
+		switch body := r.Body.(type) {
+		case *dnsmessage.PTRResource:
+			instance := strings.ToLower(body.PTR.String())
+			if !slices.Contains(m.services, name) || !strings.HasSuffix(instance, "."+name) {
+				continue
+			}
+			name = instance
+			putRecord(m.instances, name, r.Header.Name.String(), expires, ttl)
+		case *dnsmessage.SRVResource:
+			target := strings.ToLower(body.Target.String())
+			if !m.browsed(name) || !strings.HasSuffix(target, mdnsSuffix) {
+				continue
+			}
+			putRecord(m.targets, name, target, expires, ttl)
+		case *dnsmessage.AResource:
+			if !m.isTarget(name) {
+				continue
+			}
+			m.putAddr(name, net.IP(body.A[:]).String(), expires, ttl)
+		case *dnsmessage.AAAAResource:
+			if !m.isTarget(name) {
+				continue
+			}
+			m.putAddr(name, net.IP(body.AAAA[:]).String(), expires, ttl)
+		default:
+			continue
+		}
+		touched[name] = true
+	}
+	hosts := m.resolve(now, touched)
+	callback := m.onHost
+	m.mu.Unlock()
+
+	if callback != nil {
+		for _, host := range hosts {
+			callback(host)
+		}
+	}
+}
+
+// isAddrRecord 是否为 A/AAAA 记录
+func isAddrRecord(r dnsmessage.Resource) bool {
+	switch r.Body.(type) {
+	case *dnsmessage.AResource, *dnsmessage.AAAAResource:
+		return true
+	}
+	return false
+}
+
+// compareBool false 排在 true 之前
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	default:
+		return -1
+	}
+}
+
+// browsed 实例名是否属于浏览的服务类型，调用方需持有锁
+func (m *MDNS) browsed(instance string) bool {
+	for _, service := range m.services {
+		if strings.HasSuffix(instance, "."+service) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTarget 主机名是否为已缓存实例的 SRV 目标，调用方需持有锁
+func (m *MDNS) isTarget(host string) bool {
+	for _, target := range m.targets {
+		if target.value == host {
+			return true
+		}
+	}
+	return false
+}
+
+// putRecord 更新缓存记录，ttl 为 0 表示记录失效，缓存已满时淘汰最早过期的记录
+func putRecord(cache map[string]mdnsRecord, key, value string, expires time.Time, ttl uint32) {
+	if ttl == 0 {
+		delete(cache, key)
+		return
+	}
+	if _, ok := cache[key]; !ok && len(cache) >= mdnsMaxEntries {
+		oldest := ""
+		for k, r := range cache {
+			if oldest == "" || r.expires.Before(cache[oldest].expires) {
+				oldest = k
+			}
+		}
+		delete(cache, oldest)
+	}
+	cache[key] = mdnsRecord{value: strings.ToLower(value), expires: expires}
+}
+
+// putAddr 更新主机地址缓存，调用方需持有锁
+// 主机数或单个主机的地址数已满时淘汰最早过期的
+func (m *MDNS) putAddr(host, ip string, expires time.Time, ttl uint32) {
+	addrs := m.hosts[host]
+	if ttl == 0 {
+		delete(addrs, ip)
+		return
+	}
+	if addrs == nil {
+		if len(m.hosts) >= mdnsMaxEntries {
+			m.evictHost()
+		}
+		addrs = make(map[string]time.Time)
+		m.hosts[host] = addrs
+	}
+	if _, ok := addrs[ip]; !ok && len(addrs) >= mdnsMaxAddrs {
+		oldest := ""
+		for addr, t := range addrs {
+			if oldest == "" || t.Before(addrs[oldest]) {
+				oldest = addr
+			}
+		}
+		delete(addrs, oldest)
+	}
+	addrs[ip] = expires
+}
+
+// evictHost 淘汰地址最早全部过期的主机，调用方需持有锁
+func (m *MDNS) evictHost() {
+	oldest, oldestExpires := "", time.Time{}
+	for host, addrs := range m.hosts {
+		var latest time.Time
+		for _, t := range addrs {
+			if t.After(latest) {
+				latest = t
+			}
+		}
+		if oldest == "" || latest.Before(oldestExpires) {
+			oldest, oldestExpires = host, latest
+		}
+	}
+	delete(m.hosts, oldest)
+}
+
+// resolve 组合缓存中的实例、SRV 和地址记录，返回与本次更新的记录相关且信息完整的主机，调用方需持有锁
+func (m *MDNS) resolve(now time.Time, touched map[string]bool) []MDNSHost {
+	m.prune(now)
+
+	var result []MDNSHost
+	for instance, service := range m.instances {
+		target, ok := m.targets[instance]
+		if !ok || (!touched[instance] && !touched[target.value]) {
+			continue
+		}
+
+		// 有效期取实例、SRV 和地址记录中最早过期的
+		expires := service.expires
+		if target.expires.Before(expires) {
+			expires = target.expires
+		}
+		var ips []string
+		for ip, ipExpires := range m.hosts[target.value] {
+			ips = append(ips, ip)
+			if ipExpires.Before(expires) {
+				expires = ipExpires
+			}
+		}
+		if len(ips) == 0 {
+			continue
+		}
+		sort.Slice(ips, func(i, j int) bool {
+			v4i, v4j := !strings.Contains(ips[i], ":"), !strings.Contains(ips[j], ":")
+			if v4i != v4j {
+				return v4i
+			}
+			return ips[i] < ips[j]
+		})
+		result = append(result, MDNSHost{Instance: instance, Host: target.value, IPs: ips, TTL: expires.Sub(now)})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Instance < result[j].Instance })
+	return result
+}
+
+// prune 清理过期的缓存记录，调用方需持有锁
+func (m *MDNS) prune(now time.Time) {
+	for key, r := range m.instances {
+		if now.After(r.expires) {
+			delete(m.instances, key)
+		}
+	}
+	for key, r := range m.targets {
+		if now.After(r.expires) {
+			delete(m.targets, key)
+		}
+	}
+	for host, addrs := range m.hosts {
+		for ip, expires := range addrs {
+			if now.After(expires) {
+				delete(addrs, ip)
+			}
+		}
+		if len(addrs) == 0 {
+			delete(m.hosts, host)
+		}
+	}
+}
+
+// browseLoop 定期发送浏览查询
+func (m *MDNS) browseLoop() {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	m.query()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			m.mu.Lock()
+			m.prune(time.Now())
+			m.mu.Unlock()
+			m.query()
+		}
+	}
+}
+
+// fqdn 转换为以点结尾的小写域名
+func fqdn(name string) string {
+	if name == "" {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSuffix(name, ".")) + "."
+}
@@ -0,0 +1,234 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const testInstance = "nas [00:11:22:33:44:55]._workstation._tcp.local."
+
+func mustName(t *testing.T, name string) dnsmessage.Name {
+	t.Helper()
+	n, err := dnsmessage.NewName(name)
+	if err != nil {
+		t.Fatalf("NewName(%q): %v", name, err)
+	}
+	return n
+}
+
+func testPTR(t *testing.T, service, instance string, ttl uint32) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: mustName(t, service), Class: dnsmessage.ClassINET, TTL: ttl},
+		Body:   &dnsmessage.PTRResource{PTR: mustName(t, instance)},
+	}
+}
+
+func testSRV(t *testing.T, instance, target string, ttl uint32) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: mustName(t, instance), Class: dnsmessage.ClassINET, TTL: ttl},
+		Body:   &dnsmessage.SRVResource{Port: 9, Target: mustName(t, target)},
+	}
+}
+
+func testA(t *testing.T, host, ip string, ttl uint32) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: mustName(t, host), Class: dnsmessage.ClassINET, TTL: ttl},
+		Body:   &dnsmessage.AResource{A: [4]byte(net.ParseIP(ip).To4())},
+	}
+}
+
+func newTestBrowser(hosts *[]MDNSHost) *MDNS {
+	m := NewMDNS(IPModeIPv4, nil)
+	m.Browse([]string{"_workstation._tcp"}, time.Minute, func(host MDNSHost) {
+		*hosts = append(*hosts, host)
+	})
+	return m
+}
+
+func TestMDNSBrowse(t *testing.T) {
+	var hosts []MDNSHost
+	m := newTestBrowser(&hosts)
+
+	// 地址记录排在 SRV 之前也能关联到主机
+	m.handleResponse(&dnsmessage.Message{
+		Header: dnsmessage.Header{Response: true},
+		Answers: []dnsmessage.Resource{
+			testPTR(t, "_workstation._tcp.local.", testInstance, 120),
+		},
+		Additionals: []dnsmessage.Resource{
+			testA(t, "nas.local.", "192.168.1.20", 120),
+			testSRV(t, testInstance, "nas.local.", 120),
+		},
+	})
+	if len(hosts) != 1 {
+		t.Fatalf("收到 %d 个主机，期望 1 个", len(hosts))
+	}
+	host := hosts[0]
+	if host.Instance != testInstance || host.Host != "nas.local." || len(host.IPs) != 1 || host.IPs[0] != "192.168.1.20" {
+		t.Fatalf("host = %+v", host)
+	}
+}
+
+func TestMDNSBrowseFilters(t *testing.T) {
+	tests := []struct {
+		name    string
+		records []dnsmessage.Resource
+	}{
+		{"未浏览的服务类型", []dnsmessage.Resource{
+			testPTR(t, "_http._tcp.local.", "web._http._tcp.local.", 120),
+			testSRV(t, "web._http._tcp.local.", "web.local.", 120),
+			testA(t, "web.local.", "192.168.1.30", 120),
+		}},
+		{"实例不在服务类型下", []dnsmessage.Resource{
+			testPTR(t, "_workstation._tcp.local.", "evil.example.com.", 120),
+			testSRV(t, "evil.example.com.", "evil.local.", 120),
+			testA(t, "evil.local.", "192.168.1.31", 120),
+		}},
+		{"SRV 目标不在 .local 下", []dnsmessage.Resource{
+			testPTR(t, "_workstation._tcp.local.", testInstance, 120),
+			testSRV(t, testInstance, "www.example.com.", 120),
+			testA(t, "www.example.com.", "192.168.1.32", 120),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hosts []MDNSHost
+			m := newTestBrowser(&hosts)
+			m.handleResponse(&dnsmessage.Message{Header: dnsmessage.Header{Response: true}, Answers: tt.records})
+			if len(hosts) != 0 {
+				t.Fatalf("不应导入主机: %+v", hosts)
+			}
+			if len(m.targets) != 0 || len(m.hosts) != 0 {
+				t.Fatalf("缓存了无关记录: targets=%v hosts=%v", m.targets, m.hosts)
+			}
+		})
+	}
+
+	// 与浏览的实例无关的地址记录不缓存
+	var hosts []MDNSHost
+	m := newTestBrowser(&hosts)
+	m.handleResponse(&dnsmessage.Message{
+		Header:  dnsmessage.Header{Response: true},
+		Answers: []dnsmessage.Resource{testA(t, "printer.local.", "192.168.1.40", 120)},
+	})
+	if len(m.hosts) != 0 {
+		t.Fatalf("缓存了无关主机的地址: %v", m.hosts)
+	}
+}
+
+func TestMDNSBrowseTTLCapped(t *testing.T) {
+	var hosts []MDNSHost
+	m := newTestBrowser(&hosts)
+	m.handleResponse(&dnsmessage.Message{
+		Header: dnsmessage.Header{Response: true},
+		Answers: []dnsmessage.Resource{
+			testPTR(t, "_workstation._tcp.local.", testInstance, 1<<31),
+			testSRV(t, testInstance, "nas.local.", 1<<31),
+			testA(t, "nas.local.", "192.168.1.20", 1<<31),
+		},
+	})
+	if len(hosts) != 1 {
+		t.Fatalf("收到 %d 个主机，期望 1 个", len(hosts))
+	}
+	if hosts[0].TTL > mdnsMaxTTL*time.Second {
+		t.Fatalf("TTL = %v，超过上限 %ds", hosts[0].TTL, mdnsMaxTTL)
+	}
+}
+
+func TestMDNSBrowseCacheBounded(t *testing.T) {
+	var hosts []MDNSHost
+	m := newTestBrowser(&hosts)
+	for i := range mdnsMaxEntries + 50 {
+		instance := fmt.Sprintf("pc%d._workstation._tcp.local.", i)
+		target := fmt.Sprintf("pc%d.local.", i)
+		m.handleResponse(&dnsmessage.Message{
+			Header: dnsmessage.Header{Response: true},
+			Answers: []dnsmessage.Resource{
+				testPTR(t, "_workstation._tcp.local.", instance, 120),
+				testSRV(t, instance, target, 120),
+				testA(t, target, fmt.Sprintf("10.0.%d.%d", i/256, i%256), 120),
+			},
+		})
+	}
+	if len(m.instances) > mdnsMaxEntries || len(m.targets) > mdnsMaxEntries || len(m.hosts) > mdnsMaxEntries {
+		t.Fatalf("缓存超过上限: instances=%d targets=%d hosts=%d", len(m.instances), len(m.targets), len(m.hosts))
+	}
+
+	// 单个主机的地址数也有上限
+	for i := range mdnsMaxAddrs * 2 {
+		m.handleResponse(&dnsmessage.Message{
+			Header:  dnsmessage.Header{Response: true},
+			Answers: []dnsmessage.Resource{testA(t, "pc300.local.", fmt.Sprintf("10.1.0.%d", i), 120)},
+		})
+	}
+	if n := len(m.hosts["pc300.local."]); n > mdnsMaxAddrs {
+		t.Fatalf("主机地址数 %d 超过上限 %d", n, mdnsMaxAddrs)
+	}
+}
+
+func TestMDNSRespond(t *testing.T) {
+	server, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	client, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	m := NewMDNS(IPModeIPv4, nil)
+	m.SetHost("box.coobee.local", func() []Address { return []Address{{IP: "192.168.1.10"}, {IP: "fd00::10"}} })
+	m.SetServices([]Service{{Name: "http", Port: 8080}})
+	gc := &groupConn{conn: server, group: &net.UDPAddr{IP: net.ParseIP(mdnsAddr), Port: mdnsPort}}
+
+	// 源端口不是 5353 的传统查询直接单播应答
+	query := &dnsmessage.Message{
+		Header: dnsmessage.Header{ID: 42},
+		Questions: []dnsmessage.Question{
+			{Name: mustName(t, "BOX.coobee.local."), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET},
+			{Name: mustName(t, "_http._tcp.box.coobee.local."), Type: dnsmessage.TypeSRV, Class: dnsmessage.ClassINET},
+			{Name: mustName(t, "_ssh._tcp.box.coobee.local."), Type: dnsmessage.TypeSRV, Class: dnsmessage.ClassINET},
+			{Name: mustName(t, "other.coobee.local."), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET},
+		},
+	}
+	m.handleQuery(gc, query, client.LocalAddr().(*net.UDPAddr))
+
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buffer := make([]byte, mdnsMaxPacket)
+	n, err := client.Read(buffer)
+	if err != nil {
+		t.Fatalf("未收到应答: %v", err)
+	}
+	var resp dnsmessage.Message
+	if err := resp.Unpack(buffer[:n]); err != nil {
+		t.Fatal(err)
+	}
+	if resp.ID != 42 || len(resp.Questions) != 2 {
+		t.Fatalf("应答未回显查询: id=%d questions=%d", resp.ID, len(resp.Questions))
+	}
+
+	var a, srv bool
+	for _, r := range resp.Answers {
+		if r.Header.TTL != mdnsLegacyTTL {
+			t.Fatalf("传统查询的 TTL = %d，期望 %d", r.Header.TTL, mdnsLegacyTTL)
+		}
+		switch body := r.Body.(type) {
+		case *dnsmessage.AResource:
+			a = net.IP(body.A[:]).String() == "192.168.1.10"
+		case *dnsmessage.SRVResource:
+			srv = body.Port == 8080 && body.Target.String() == "box.coobee.local."
+		}
+	}
+	if !a || !srv {
+		t.Fatalf("应答缺少 A 或 SRV 记录: %+v", resp.Answers)
+	}
+	if len(resp.Additionals) != 2 {
+		t.Fatalf("SRV 应答应附带本机地址: %+v", resp.Additionals)
+	}
+}
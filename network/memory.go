@@ -0,0 +1,281 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// memoryInboxSize 内存传输层接收队列长度，队列满时丢弃消息（模拟接收缓冲区溢出）
+const memoryInboxSize = 1024
+
+// MemoryBus 内存消息总线
+// 在单个进程内模拟一个局域网，可设置丢包率、延迟和网络分区，
+// 用于在没有真实网络的情况下运行多节点场景
+type MemoryBus struct {
+	mu         sync.RWMutex
+	transports map[string]*MemoryTransport // key: IP
+	loss       float64                     // 丢包率 0~1
+	delay      time.Duration               // 基础延迟
+	jitter     time.Duration               // 随机附加延迟上限
+	partitions map[string]int              // key: IP，所在分区；不在表中的节点属于分区 0
+	rand       *rand.Rand
+}
+
+// NewMemoryBus 创建内存消息总线
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{
+		transports: make(map[string]*MemoryTransport),
+		partitions: make(map[string]int),
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// SetLoss 设置丢包率（0~1）
+func (b *MemoryBus) SetLoss(rate float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.loss = rate
+}
+
+// SetDelay 设置传输延迟，实际延迟为 delay 加上 [0, jitter) 的随机值
+func (b *MemoryBus) SetDelay(delay, jitter time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.delay = delay
+	b.jitter = jitter
+}
+
+// Partition 划分网络分区，每组 IP 为一个分区，不同分区之间无法通信
+// 未列出的节点属于同一个默认分区
+func (b *MemoryBus) Partition(groups ...[]string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.partitions = make(map[string]int)
+	for i, group := range groups {
+		for _, ip := range group {
+			b.partitions[ip] = i + 1
+		}
+	}
+}
+
+// Heal 取消所有网络分区
+func (b *MemoryBus) Heal() {
+	b.Partition()
+}
+
+// NewTransport 在总线上创建一个节点的传输层，ip 为该节点的地址
+func (b *MemoryBus) NewTransport(ip string) (*MemoryTransport, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, exists := b.transports[ip]; exists {
+		return nil, fmt.Errorf("地址已被占用: %s", ip)
+	}
+
+	t := &MemoryTransport{
+		bus:      b,
+		ip:       ip,
+		codec:    &Codec{},
+		instance: newInstanceID(),
+		inbox:    make(chan memoryPacket, memoryInboxSize),
+		stop:     make(chan struct{}),
+	}
+	t.seq.Store(uint64(time.Now().UnixNano()))
+	b.transports[ip] = t
+	return t, nil
+}
+
+// deliver 按丢包、延迟和分区设置把数据投递给目标节点
+func (b *MemoryBus) deliver(from string, to *MemoryTransport, data []byte) {
+	b.mu.Lock()
+	if b.partitions[from] != b.partitions[to.ip] || (b.loss > 0 && b.rand.Float64() < b.loss) {
+		b.mu.Unlock()
+		return
+	}
+	delay := b.delay
+	if b.jitter > 0 {
+		delay += time.Duration(b.rand.Int63n(int64(b.jitter)))
+	}
+	b.mu.Unlock()
+
+	if delay > 0 {
+		time.AfterFunc(delay, func() { to.enqueue(from, data) })
+		return
+	}
+	to.enqueue(from, data)
+}
+
+// targets 获取除发送方以外的全部节点
+func (b *MemoryBus) targets(from string) []*MemoryTransport {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	result := make([]*MemoryTransport, 0, len(b.transports))
+	for ip, t := range b.transports {
+		if ip != from {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+// lookup 按地址查找节点
+func (b *MemoryBus) lookup(ip string) *MemoryTransport {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.transports[ip]
+}
+
+// remove 从总线移除节点
+func (b *MemoryBus) remove(ip string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.transports, ip)
+}
+
+// memoryPacket 总线上传递的数据包
+type memoryPacket struct {
+	from string // 发送方地址
+	data []byte
+}
+
+// MemoryTransport 基于内存总线的传输层
+// 消息经过编解码后投递，行为与 UDP 传输一致：发送不阻塞，接收方按顺序处理
+type MemoryTransport struct {
+	bus       *MemoryBus
+	ip        string
+	codec     *Codec
+	instance  string // 本实例标识
+	seq       atomic.Uint64
+	stats     counters
+	onMessage func(*Message)
+	inbox     chan memoryPacket
+	stop      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// SetCodec 设置消息编解码器
+func (t *MemoryTransport) SetCodec(codec *Codec) {
+	t.codec = codec
+}
+
+// Subscribe 设置消息回调
+func (t *MemoryTransport) Subscribe(callback func(*Message)) {
+	t.onMessage = callback
+}
+
+// Start 开始接收消息，ctx 取消时关闭
+func (t *MemoryTransport) Start(ctx context.Context) error {
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		t.receiveLoop()
+	}()
+	context.AfterFunc(ctx, func() { t.Close() })
+	return nil
+}
+
+// Send 广播消息到总线上的所有其他节点
+func (t *MemoryTransport) Send(msg *Message) error {
+	data, err := t.encode(msg)
+	if err != nil {
+		return err
+	}
+	for _, target := range t.bus.targets(t.ip) {
+		t.bus.deliver(t.ip, target, data)
+	}
+	return nil
+}
+
+// SendTo 单播消息到指定节点，目标不存在时与 UDP 一样静默丢弃
+func (t *MemoryTransport) SendTo(msg *Message, ip string) error {
+	data, err := t.encode(msg)
+	if err != nil {
+		return err
+	}
+	if target := t.bus.lookup(ip); target != nil {
+		t.bus.deliver(t.ip, target, data)
+	}
+	return nil
+}
+
+// GetLocalIP 本机地址
+func (t *MemoryTransport) GetLocalIP() string {
+	return t.ip
+}
+
+// GetLocalIPv6 内存传输层不区分地址族，始终为空
+func (t *MemoryTransport) GetLocalIPv6() string {
+	return ""
+}
+
+// GetLocalAddresses 本机地址列表
+func (t *MemoryTransport) GetLocalAddresses() []Address {
+	return []Address{{IP: t.ip, Iface: "mem0", Prefix: 24}}
+}
+
+// Stats 收包统计
+func (t *MemoryTransport) Stats() Stats {
+	return t.stats.snapshot()
+}
+
+// Close 从总线断开并等待接收协程退出，可重复调用
+func (t *MemoryTransport) Close() error {
+	t.closeOnce.Do(func() {
+		t.bus.remove(t.ip)
+		close(t.stop)
+	})
+	t.wg.Wait()
+	return nil
+}
+
+// encode 填充时间戳、序号和实例标识后编码消息
+func (t *MemoryTransport) encode(msg *Message) ([]byte, error) {
+	select {
+	case <-t.stop:
+		return nil, errors.New("传输层已关闭")
+	default:
+	}
+	msg.Timestamp = time.Now().Unix()
+	msg.Seq = t.seq.Add(1)
+	msg.Instance = t.instance
+	return t.codec.Encode(msg)
+}
+
+// enqueue 放入接收队列，队列满时丢弃
+func (t *MemoryTransport) enqueue(from string, data []byte) {
+	select {
+	case <-t.stop:
+	case t.inbox <- memoryPacket{from: from, data: data}:
+	default:
+		t.stats.invalid.Add(1)
+	}
+}
+
+// receiveLoop 接收消息循环
+func (t *MemoryTransport) receiveLoop() {
+	for {
+		select {
+		case <-t.stop:
+			return
+		case packet := <-t.inbox:
+			t.stats.received.Add(1)
+			msg, err := t.codec.Decode(packet.data)
+			if err != nil {
+				t.stats.countDecodeError(err)
+				continue
+			}
+			msg.Source = packet.from
+			if msg.SourceMismatch() {
+				t.stats.mismatched.Add(1)
+			}
+			if t.onMessage != nil {
+				t.onMessage(msg)
+			}
+		}
+	}
+}
@@ -1,65 +1,281 @@
 package network
 
 import (
-	"encoding/json"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
 )
 
 // Action 消息动作类型
 const (
-	ActionHeartbeat = "heartbeat"
-	ActionOffline   = "offline"
+	ActionHeartbeat    = "heartbeat"
+	ActionOffline      = "offline"
+	ActionSyncRequest  = "sync-request"  // 新节点启动时请求成员快照
+	ActionSyncResponse = "sync-response" // 成员快照应答（单播给请求方）
+	ActionPing         = "ping"          // 故障检测：直接探测
+	ActionPingReq      = "ping-req"      // 故障检测：请求其他节点代为探测
+	ActionAck          = "ack"           // 故障检测：探测应答
+	ActionSuspect      = "suspect"       // 故障检测：通告节点疑似离线
+)
+
+// maxPacketSize 接收缓冲区大小（UDP 最大载荷）
+const maxPacketSize = 64 * 1024
+
+const (
+	// dedupWindow 去重记录的保留时长，同一条消息经不同路径到达的间隔远小于此值
+	dedupWindow = 10 * time.Second
+	// maxDelivered 去重记录的最大条目数，防止伪造大量 DeviceID 撑爆内存
+	maxDelivered = 4096
+)
+
+// IP 模式
+const (
+	IPModeIPv4 = "ipv4" // 仅 IPv4
+	IPModeIPv6 = "ipv6" // 仅 IPv6
+	IPModeDual = "dual" // 双栈
 )
 
 // Message 组播消息
 type Message struct {
-	Action    string `json:"action"`    // heartbeat/offline
-	Domain    string `json:"domain"`    // 域名
-	IP        string `json:"ip"`        // IP地址
-	DeviceID  string `json:"deviceId"`  // 设备ID
-	Hostname  string `json:"hostname"`  // 主机名
-	Timestamp int64  `json:"timestamp"` // 时间戳
+	Action    string            `json:"action"`             // 消息动作，见 Action* 常量
+	Domain    string            `json:"domain"`             // 域名
+	IP        string            `json:"ip"`                 // IP地址（主地址，仅 IPv6 模式下为 IPv6 地址）
+	IPv6      string            `json:"ipv6,omitempty"`     // IPv6地址
+	Addrs     []Address         `json:"addrs,omitempty"`    // 全部可用地址（含网卡和前缀），主地址在前
+	DeviceID  string            `json:"deviceId"`           // 设备ID
+	Instance  string            `json:"instance,omitempty"` // 发送方进程实例标识，每次启动随机生成
+	Hostname  string            `json:"hostname"`           // 主机名
+	Timestamp int64             `json:"timestamp"`          // 时间戳
+	Seq       uint64            `json:"seq"`                // 发送序号（单调递增，用于防重放）
+	Peers     []string          `json:"peers,omitempty"`    // 单播模式下已知的对端（ip:port）
+	Hops      int               `json:"hops,omitempty"`     // 被中继转发的次数
+	Via       []string          `json:"via,omitempty"`      // 经过的中继 ID
+	Members   []Member          `json:"members,omitempty"`  // 成员快照（sync-response）
+	Interval  int               `json:"interval,omitempty"` // 发送方当前心跳间隔（秒），接收方据此调整离线超时
+	Services  []Service         `json:"services,omitempty"` // 发送方提供的服务
+	Labels    map[string]string `json:"labels,omitempty"`   // 发送方的标签
+
+	// 故障检测
+	Incarnation uint64 `json:"incarnation,omitempty"` // 化身号：心跳中为发送方的化身号，suspect 中为目标节点的化身号
+	Target      string `json:"target,omitempty"`      // 探测或怀疑的目标节点设备ID
+	ProbeID     uint64 `json:"probeId,omitempty"`     // 探测ID
+	Origin      string `json:"origin,omitempty"`      // 间接探测的发起方地址
+
+	// 接收时填充，不参与编码
+	Source        string `json:"-"` // 实际的 UDP 源地址
+	Authenticated bool   `json:"-"` // 签名校验或解密通过（未签名的旧版本消息为 false）
+}
+
+// groupConn 单个地址族的组播连接
+type groupConn struct {
+	conn   *net.UDPConn
+	group  *net.UDPAddr
+	join   func(iface *net.Interface) error // 在指定接口上加入组播组
+	ifaces []net.Interface                  // 已加入组播组的接口
+}
+
+// send 发送到组播组，未加入组播组（单播模式）时不发送
+func (gc *groupConn) send(packets [][]byte) error {
+	if gc.group.IP.To4() != nil {
+		if len(gc.ifaces) == 0 {
+			return nil
+		}
+		return writePackets(gc.conn, packets, gc.group)
+	}
+
+	// IPv6 链路本地组播需要指定出口接口，逐个接口发送
+	var errs []error
+	for _, iface := range gc.ifaces {
+		addr := *gc.group
+		addr.Zone = iface.Name
+		if err := writePackets(gc.conn, packets, &addr); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
 }
 
 // MulticastClient 组播客户端
 type MulticastClient struct {
-	addr       string
-	port       int
-	conn       *net.UDPConn
-	packetConn *ipv4.PacketConn
-	localIP    string
-	onMessage  func(*Message) // 消息接收回调
+	addr      string // IPv4 组播地址
+	addr6     string // IPv6 组播地址
+	port      int
+	mode      string
+	policy    *InterfacePolicy
+	conns     []*groupConn
+	mu        sync.RWMutex // 保护本机地址和已加入组播组的接口，网络变化时会更新
+	localIP   string
+	localIPv6 string
+	addrs     []Address  // 本机全部可用地址
+	peers     *peerTable // 单播对端，nil 表示未启用单播模式
+	codec     *Codec
+	seq       atomic.Uint64 // 发送序号
+	stats     counters
+	frags     *reassembler
+	srcLimit  *RateLimiter   // 按源地址限流，nil 表示不限流
+	preLimit  *RateLimiter   // 启用签名时解码前的宽松限流，nil 表示不限流
+	devLimit  *RateLimiter   // 按 DeviceID 限流，nil 表示不限流
+	deviceID  string         // 本机设备ID，与 instance 一起识别本机发出的消息
+	instance  string         // 本进程实例标识
+	onMessage func(*Message) // 消息接收回调
+	wg        sync.WaitGroup // 接收协程
+	closeOnce sync.Once
+	closeErr  error
+
+	// 双栈或单播模式下同一条消息可能收到多次，按序号去重
+	dedupMu   sync.Mutex
+	delivered map[string]deliveredEntry // key: deviceID
+	pruned    time.Time                 // 上次清理去重记录的时间
+}
+
+// deliveredEntry 最近投递的消息
+type deliveredEntry struct {
+	seq  uint64
+	seen time.Time
 }
 
 // NewMulticastClient 创建组播客户端
-func NewMulticastClient(addr string, port int) (*MulticastClient, error) {
-	localIP, err := getLocalIP()
+// mode 为 ipv4/ipv6/dual，addr 和 addr6 分别为 IPv4、IPv6 组播地址，
+// policy 决定加入组播组的网卡和通告的地址，为 nil 表示使用全部网卡
+func NewMulticastClient(addr, addr6 string, port int, mode string, policy *InterfacePolicy) (*MulticastClient, error) {
+	c := &MulticastClient{
+		addr:      addr,
+		addr6:     addr6,
+		port:      port,
+		mode:      mode,
+		policy:    policy,
+		codec:     &Codec{},
+		instance:  newInstanceID(),
+		delivered: make(map[string]deliveredEntry),
+	}
+	c.frags = newReassembler(&c.stats)
+
+	addrs, err := LocalAddresses(policy)
 	if err != nil {
-		return nil, fmt.Errorf("获取本机IP失败: %v", err)
+		return nil, fmt.Errorf("获取本机地址失败: %v", err)
 	}
 
-	return &MulticastClient{
-		addr:    addr,
-		port:    port,
-		localIP: localIP,
-	}, nil
+	c.localIP, c.localIPv6, err = c.selectLocal(addrs)
+	if err != nil {
+		return nil, err
+	}
+	c.addrs = primaryFirst(addrs, c.localIP, c.localIPv6)
+
+	// 以启动时刻的纳秒时间作为序号起点，保证重启后序号仍然递增
+	c.seq.Store(uint64(time.Now().UnixNano()))
+	return c, nil
+}
+
+// selectLocal 按 IP 模式从本机地址中选出主地址
+func (c *MulticastClient) selectLocal(addrs []Address) (ip, ipv6 string, err error) {
+	switch c.mode {
+	case IPModeIPv4, IPModeDual:
+		ip = c.policy.selectPrimary(addrs, false)
+		if ip == "" {
+			return "", "", fmt.Errorf("获取本机IP失败: 未找到有效的局域网IP")
+		}
+		if c.mode == IPModeDual {
+			// 双栈模式下 IPv6 地址可选
+			ipv6 = c.policy.selectPrimary(addrs, true)
+		}
+	case IPModeIPv6:
+		ipv6 = c.policy.selectPrimary(addrs, true)
+		if ipv6 == "" {
+			return "", "", fmt.Errorf("获取本机IPv6地址失败: 未找到有效的IPv6地址")
+		}
+		ip = ipv6
+	default:
+		return "", "", fmt.Errorf("未知的IP模式: %s", c.mode)
+	}
+	return ip, ipv6, nil
 }
 
-// SetMessageCallback 设置消息回调
-func (c *MulticastClient) SetMessageCallback(callback func(*Message)) {
+// Subscribe 设置消息回调
+func (c *MulticastClient) Subscribe(callback func(*Message)) {
 	c.onMessage = callback
 }
 
-// Start 启动组播监听
-func (c *MulticastClient) Start() error {
-	groupAddr := &net.UDPAddr{
+// SetCodec 设置消息编解码器（签名、加密）
+func (c *MulticastClient) SetCodec(codec *Codec) {
+	c.codec = codec
+}
+
+// SetDeviceID 设置本机设备ID，用于识别本机发出的消息
+func (c *MulticastClient) SetDeviceID(deviceID string) {
+	c.deviceID = deviceID
+}
+
+// SetRateLimit 设置接收限流，source 按源地址、device 按 DeviceID 计，nil 表示不限流
+// 超出限流的来源会被隔离一段时间，防止单个节点泛洪导致频繁改写 hosts
+func (c *MulticastClient) SetRateLimit(source, device *RateLimiter) {
+	c.srcLimit = source
+	c.preLimit = source.loosened(preAuthFactor)
+	c.devLimit = device
+}
+
+// Quarantined 当前被隔离的来源（源地址和 DeviceID）
+func (c *MulticastClient) Quarantined() []Quarantine {
+	return append(c.srcLimit.Quarantined(), c.devLimit.Quarantined()...)
+}
+
+// Stats 获取收包统计
+func (c *MulticastClient) Stats() Stats {
+	return c.stats.snapshot()
+}
+
+// Start 启动组播监听，ctx 取消时关闭连接并结束接收协程
+// 需要在关闭前发送离线通知时，应传入不会提前取消的 ctx 并在发送后调用 Close
+func (c *MulticastClient) Start(ctx context.Context) error {
+	if c.mode != IPModeIPv6 {
+		if err := c.startIPv4(); err != nil {
+			return err
+		}
+	}
+	if c.mode != IPModeIPv4 {
+		if err := c.startIPv6(); err != nil {
+			// 双栈模式下关闭已打开的 IPv4 连接
+			for _, gc := range c.conns {
+				gc.conn.Close()
+			}
+			c.conns = nil
+			return err
+		}
+	}
+
+	// 启动接收协程
+	for _, gc := range c.conns {
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			c.receiveLoop(gc)
+		}()
+	}
+	context.AfterFunc(ctx, func() { c.Close() })
+
+	return nil
+}
+
+// startIPv4 启动 IPv4 组播监听
+func (c *MulticastClient) startIPv4() error {
+	group := &net.UDPAddr{
 		IP:   net.ParseIP(c.addr),
 		Port: c.port,
 	}
+	if group.IP == nil || group.IP.To4() == nil {
+		return fmt.Errorf("无效的IPv4组播地址: %s", c.addr)
+	}
 
 	// 监听所有接口
 	conn, err := net.ListenUDP("udp4", &net.UDPAddr{
@@ -70,110 +286,352 @@ func (c *MulticastClient) Start() error {
 		return fmt.Errorf("创建UDP连接失败: %v", err)
 	}
 
-	c.conn = conn
-	c.packetConn = ipv4.NewPacketConn(conn)
+	packetConn := ipv4.NewPacketConn(conn)
+	join := func(iface *net.Interface) error {
+		return packetConn.JoinGroup(iface, group)
+	}
+	ifaces, err := joinGroup(c.policy, join, nil)
+	if err != nil && c.peers == nil {
+		conn.Close()
+		return err
+	}
+
+	c.conns = append(c.conns, &groupConn{conn: conn, group: group, join: join, ifaces: ifaces})
+	return nil
+}
+
+// startIPv6 启动 IPv6 组播监听
+func (c *MulticastClient) startIPv6() error {
+	group := &net.UDPAddr{
+		IP:   net.ParseIP(c.addr6),
+		Port: c.port,
+	}
+	if group.IP == nil || group.IP.To4() != nil {
+		return fmt.Errorf("无效的IPv6组播地址: %s", c.addr6)
+	}
+
+	conn, err := net.ListenUDP("udp6", &net.UDPAddr{
+		IP:   net.IPv6unspecified,
+		Port: c.port,
+	})
+	if err != nil {
+		return fmt.Errorf("创建UDPv6连接失败: %v", err)
+	}
+
+	packetConn := ipv6.NewPacketConn(conn)
+	join := func(iface *net.Interface) error {
+		return packetConn.JoinGroup(iface, group)
+	}
+	ifaces, err := joinGroup(c.policy, join, nil)
+	if err != nil && c.peers == nil {
+		conn.Close()
+		return err
+	}
+
+	c.conns = append(c.conns, &groupConn{conn: conn, group: group, join: join, ifaces: ifaces})
+	return nil
+}
 
-	// 加入组播组
+// joinGroup 尝试在所有可用接口上加入组播组，返回加入成功的接口
+// joined 为此前已加入的接口，不再重复加入；已停用的接口从结果中移除。
+// 单播模式下加入失败不影响启动，仅通过单播收发消息
+func joinGroup(policy *InterfacePolicy, join func(iface *net.Interface) error, joined []net.Interface) ([]net.Interface, error) {
 	ifaces, err := net.Interfaces()
 	if err != nil {
-		return fmt.Errorf("获取网络接口失败: %v", err)
+		return nil, fmt.Errorf("获取网络接口失败: %v", err)
 	}
 
-	// 尝试在所有可用接口上加入组播组
-	joined := false
+	var result []net.Interface
 	for _, iface := range ifaces {
 		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagMulticast == 0 {
 			continue
 		}
-		if err := c.packetConn.JoinGroup(&iface, groupAddr); err == nil {
-			joined = true
+		if !policy.Allow(iface.Name) {
+			continue
+		}
+		if slices.ContainsFunc(joined, func(j net.Interface) bool { return j.Index == iface.Index }) {
+			result = append(result, iface)
+			continue
+		}
+		// 接口短暂停用后恢复时内核可能仍保留成员关系
+		if err := join(&iface); err == nil || errors.Is(err, syscall.EADDRINUSE) {
+			result = append(result, iface)
 		}
 	}
 
-	if !joined {
-		return fmt.Errorf("无法加入组播组")
+	if len(result) == 0 {
+		return nil, fmt.Errorf("无法加入组播组")
 	}
+	return result, nil
+}
 
-	// 启动接收协程
-	go c.receiveLoop()
+// Refresh 重新获取本机地址，并在新启用的网卡上加入组播组
+// 返回主地址或地址列表是否变化；暂时没有可用地址时保留原地址并返回错误
+func (c *MulticastClient) Refresh() (bool, error) {
+	addrs, err := LocalAddresses(c.policy)
+	if err != nil {
+		return false, fmt.Errorf("获取本机地址失败: %v", err)
+	}
+	localIP, localIPv6, selectErr := c.selectLocal(addrs)
 
-	return nil
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, gc := range c.conns {
+		gc.ifaces, _ = joinGroup(c.policy, gc.join, gc.ifaces)
+	}
+
+	if selectErr != nil {
+		return false, selectErr
+	}
+	addrs = primaryFirst(addrs, localIP, localIPv6)
+	changed := localIP != c.localIP || localIPv6 != c.localIPv6 || !slices.Equal(addrs, c.addrs)
+	c.localIP, c.localIPv6, c.addrs = localIP, localIPv6, addrs
+	return changed, nil
 }
 
 // Send 发送消息
 func (c *MulticastClient) Send(msg *Message) error {
 	msg.Timestamp = time.Now().Unix()
+	msg.Seq = c.seq.Add(1)
+	msg.Instance = c.instance
+	if c.peers != nil && msg.Action == ActionHeartbeat && c.codec.Signed() {
+		// 心跳中转告已知对端，使只配置了种子节点的节点也能互相发现；
+		// 未签名的对端列表接收方不会采纳，不签名时不携带
+		msg.Peers = c.peers.shared()
+	}
 
-	data, err := json.Marshal(msg)
+	packets, err := c.encode(msg)
 	if err != nil {
 		return err
 	}
 
-	addr := &net.UDPAddr{
-		IP:   net.ParseIP(c.addr),
-		Port: c.port,
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var errs []error
+	for _, gc := range c.conns {
+		if err := gc.send(packets); err != nil {
+			errs = append(errs, err)
+		}
 	}
 
-	_, err = c.conn.WriteToUDP(data, addr)
-	return err
+	if c.peers != nil {
+		if err := c.sendUnicast(packets); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
 }
 
-// Close 关闭连接
-func (c *MulticastClient) Close() error {
-	if c.conn != nil {
-		return c.conn.Close()
+// SendTo 单播发送消息到指定节点（使用组播端口）
+func (c *MulticastClient) SendTo(msg *Message, ip string) error {
+	msg.Timestamp = time.Now().Unix()
+	msg.Seq = c.seq.Add(1)
+	msg.Instance = c.instance
+
+	packets, err := c.encode(msg)
+	if err != nil {
+		return err
 	}
-	return nil
+
+	addr := &net.UDPAddr{IP: net.ParseIP(ip), Port: c.port}
+	if addr.IP == nil {
+		return fmt.Errorf("无效的IP地址: %s", ip)
+	}
+	conn := c.connFor(addr.IP)
+	if conn == nil {
+		return fmt.Errorf("未启用 %s 对应的地址族", ip)
+	}
+	return writePackets(conn, packets, addr)
+}
+
+// encode 编码消息并按需分片
+func (c *MulticastClient) encode(msg *Message) ([][]byte, error) {
+	data, err := c.codec.Encode(msg)
+	if err != nil {
+		return nil, err
+	}
+	packets, err := splitFragments(data)
+	if err != nil {
+		c.stats.oversize.Add(1)
+		return nil, err
+	}
+	return packets, nil
+}
+
+// Close 关闭连接并等待接收协程退出，可重复调用
+// Close 返回后不会再触发消息回调，因此不能在消息回调中调用
+func (c *MulticastClient) Close() error {
+	c.closeOnce.Do(func() {
+		var errs []error
+		for _, gc := range c.conns {
+			if err := gc.conn.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		c.closeErr = errors.Join(errs...)
+	})
+	c.wg.Wait()
+	return c.closeErr
 }
 
-// GetLocalIP 获取本机IP
+// GetLocalIP 获取本机IP（仅 IPv6 模式下为 IPv6 地址）
 func (c *MulticastClient) GetLocalIP() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.localIP
 }
 
+// GetLocalIPv6 获取本机IPv6地址，未启用 IPv6 时为空
+func (c *MulticastClient) GetLocalIPv6() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.localIPv6
+}
+
+// GetLocalAddresses 获取本机全部可用地址（主地址在前）
+func (c *MulticastClient) GetLocalAddresses() []Address {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.addrs
+}
+
 // receiveLoop 接收消息循环
-func (c *MulticastClient) receiveLoop() {
-	buffer := make([]byte, 1024)
+func (c *MulticastClient) receiveLoop(gc *groupConn) {
+	buffer := make([]byte, maxPacketSize)
 
 	for {
-		n, _, err := c.conn.ReadFromUDP(buffer)
+		n, src, err := gc.conn.ReadFromUDP(buffer)
 		if err != nil {
 			return
 		}
 
-		var msg Message
-		if err := json.Unmarshal(buffer[:n], &msg); err != nil {
-			continue
-		}
-
-		// 忽略自己发送的消息
-		if msg.IP == c.localIP {
-			continue
-		}
-
 		// 触发回调
-		if c.onMessage != nil {
-			c.onMessage(&msg)
+		if msg := c.receive(src, buffer[:n]); msg != nil && c.onMessage != nil {
+			c.onMessage(msg)
 		}
 	}
 }
 
-// getLocalIP 获取本机局域网IP
-func getLocalIP() (string, error) {
-	addrs, err := net.InterfaceAddrs()
+// receive 处理收到的数据报，返回需要投递的消息，丢弃或分片未收齐时返回 nil
+func (c *MulticastClient) receive(src *net.UDPAddr, packet []byte) *Message {
+	c.stats.received.Add(1)
+
+	// 解码前先按源地址限流，泛洪数据不消耗重组、验签和解密开销。
+	// 接收未签名消息时直接严格限流；启用签名后解码前只做宽松的限流（不隔离），
+	// 校验通过后再严格限流，伪造源地址的数据包不能让合法节点被隔离
+	preAuth := c.codec.AcceptsUnsigned()
+	limiter := c.preLimit
+	if preAuth {
+		limiter = c.srcLimit
+	}
+	if !c.stats.countLimit(limiter.Allow(src.IP.String())) {
+		return nil
+	}
+
+	data, err := c.frags.add(src.String(), packet)
 	if err != nil {
-		return "", err
+		c.stats.countDecodeError(err)
+		return nil
+	}
+	if data == nil {
+		// 分片尚未收齐
+		return nil
 	}
 
-	for _, addr := range addrs {
-		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() {
-			if ipNet.IP.To4() != nil {
-				return ipNet.IP.String(), nil
-			}
+	msg, err := c.codec.Decode(data)
+	if err != nil {
+		// 未签名、签名错误或无法解密的消息直接丢弃并计数
+		c.stats.countDecodeError(err)
+		return nil
+	}
+	if !preAuth && !c.stats.countLimit(c.srcLimit.Allow(src.IP.String())) {
+		return nil
+	}
+
+	msg.Source = src.IP.String()
+
+	// 忽略本进程发送的消息（本机地址可能变化，不能按 IP 判断）
+	if c.isSelf(msg) {
+		return nil
+	}
+
+	// 单播模式下学习对端
+	if c.peers != nil {
+		c.learnPeers(src, msg)
+	}
+
+	// 双栈或组播+单播同时收到的重复消息
+	if c.isDuplicate(msg) {
+		return nil
+	}
+
+	// 直接收到的消息源地址应为发送方通告的地址之一，不一致时可能是伪造
+	if msg.SourceMismatch() {
+		c.stats.mismatched.Add(1)
+	}
+
+	// 按 DeviceID 限流，防止同一节点经多个地址或中继泛洪
+	if !c.stats.countLimit(c.devLimit.Allow(msg.DeviceID)) {
+		return nil
+	}
+	return msg
+}
+
+// isSelf 检查是否为本进程发送的消息
+// 同一 DeviceID 的其他实例（如克隆的虚拟机）不视为本机，由上层处理冲突
+func (c *MulticastClient) isSelf(msg *Message) bool {
+	return msg.Instance == c.instance && (c.deviceID == "" || msg.DeviceID == c.deviceID)
+}
+
+// isDuplicate 检查是否为经其他路径已投递过的同一条消息
+// 记录超过 dedupWindow 后清理；记录已满时不再记录新的 DeviceID（重放仍由上层按序号拒绝）
+func (c *MulticastClient) isDuplicate(msg *Message) bool {
+	if msg.Seq == 0 {
+		return false
+	}
+
+	c.dedupMu.Lock()
+	defer c.dedupMu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.pruned) > dedupWindow {
+		c.pruneDelivered(now)
+	}
+
+	entry, ok := c.delivered[msg.DeviceID]
+	if ok && entry.seq == msg.Seq {
+		return true
+	}
+	if !ok && len(c.delivered) >= maxDelivered {
+		c.pruneDelivered(now)
+		if len(c.delivered) >= maxDelivered {
+			return false
+		}
+	}
+	c.delivered[msg.DeviceID] = deliveredEntry{seq: msg.Seq, seen: now}
+	return false
+}
+
+// pruneDelivered 清理超过 dedupWindow 的去重记录，调用方需持有锁
+func (c *MulticastClient) pruneDelivered(now time.Time) {
+	for deviceID, entry := range c.delivered {
+		if now.Sub(entry.seen) > dedupWindow {
+			delete(c.delivered, deviceID)
 		}
 	}
+	c.pruned = now
+}
 
-	return "", fmt.Errorf("未找到有效的局域网IP")
+// newInstanceID 生成随机的进程实例标识
+func newInstanceID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		// 随机数不可用时退回到启动时间，仍能区分不同进程
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
 }
 
 // GetMACAddress 获取MAC地址作为设备ID
@@ -198,4 +656,3 @@ func GetMACAddress() (string, error) {
 
 	return "", fmt.Errorf("未找到有效的MAC地址")
 }
-
@@ -0,0 +1,148 @@
+package network
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestIsDuplicate(t *testing.T) {
+	c := &MulticastClient{delivered: make(map[string]deliveredEntry)}
+
+	if c.isDuplicate(&Message{DeviceID: "a", Seq: 1}) {
+		t.Fatal("首次收到的消息被视为重复")
+	}
+	if !c.isDuplicate(&Message{DeviceID: "a", Seq: 1}) {
+		t.Fatal("经其他路径收到的同一条消息未被去重")
+	}
+	if c.isDuplicate(&Message{DeviceID: "a", Seq: 2}) {
+		t.Fatal("新序号的消息被视为重复")
+	}
+	if c.isDuplicate(&Message{DeviceID: "a"}) || c.isDuplicate(&Message{DeviceID: "a"}) {
+		t.Fatal("不带序号的消息不去重")
+	}
+
+	// 超过 dedupWindow 的记录被清理
+	c.delivered["old"] = deliveredEntry{seq: 1, seen: time.Now().Add(-2 * dedupWindow)}
+	c.pruned = time.Time{}
+	c.isDuplicate(&Message{DeviceID: "b", Seq: 1})
+	if _, ok := c.delivered["old"]; ok {
+		t.Fatal("过期的去重记录未清理")
+	}
+}
+
+func TestIsDuplicateCap(t *testing.T) {
+	c := &MulticastClient{delivered: make(map[string]deliveredEntry)}
+
+	// 大量伪造的 DeviceID 不能让去重记录无限增长
+	for i := 0; i < 2*maxDelivered; i++ {
+		c.isDuplicate(&Message{DeviceID: "flood-" + strconv.Itoa(i), Seq: 1})
+	}
+	if len(c.delivered) > maxDelivered {
+		t.Fatalf("delivered = %d, want <= %d", len(c.delivered), maxDelivered)
+	}
+
+	// 已有的记录仍然生效，过期后腾出空间
+	if !c.isDuplicate(&Message{DeviceID: "flood-0", Seq: 1}) {
+		t.Fatal("已记录的消息未被去重")
+	}
+	for deviceID, entry := range c.delivered {
+		entry.seen = entry.seen.Add(-2 * dedupWindow)
+		c.delivered[deviceID] = entry
+	}
+	c.isDuplicate(&Message{DeviceID: "new", Seq: 1})
+	if _, ok := c.delivered["new"]; !ok || len(c.delivered) != 1 {
+		t.Fatalf("过期后未腾出空间: %d", len(c.delivered))
+	}
+}
+
+// TestStartClosesOnFailure 双栈模式下 IPv6 启动失败时关闭已打开的 IPv4 连接
+func TestStartClosesOnFailure(t *testing.T) {
+	c, err := NewMulticastClient("239.255.255.250", "invalid", 0, IPModeDual, nil)
+	if err != nil {
+		t.Skipf("没有可用的局域网地址: %v", err)
+	}
+	c.EnableUnicast(nil, time.Minute) // 单播模式下不要求加入组播组
+	if err := c.Start(context.Background()); err == nil {
+		c.Close()
+		t.Fatal("无效的 IPv6 组播地址应启动失败")
+	}
+	if len(c.conns) != 0 {
+		t.Fatalf("启动失败后仍有 %d 个连接", len(c.conns))
+	}
+}
+
+func TestSourceLimiterOrder(t *testing.T) {
+	signed, _ := NewCodec("secret", EncryptionPlain, false)
+	src := &net.UDPAddr{IP: net.ParseIP("10.0.0.2"), Port: 9527}
+	newClient := func(codec *Codec) *MulticastClient {
+		c := &MulticastClient{codec: codec, instance: "self", delivered: make(map[string]deliveredEntry)}
+		c.frags = newReassembler(&c.stats)
+		c.SetRateLimit(NewRateLimiter(0.001, 2, time.Hour), nil)
+		return c
+	}
+	var seq uint64
+	valid := func(codec *Codec) []byte {
+		seq++
+		data, err := codec.Encode(&Message{DeviceID: "a", IP: "10.0.0.2", Seq: seq})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	quarantined := func(c *MulticastClient) bool {
+		for _, q := range c.Quarantined() {
+			if q.Key == "10.0.0.2" {
+				return true
+			}
+		}
+		return false
+	}
+
+	t.Run("未签名时解码前限流", func(t *testing.T) {
+		c := newClient(&Codec{})
+		// 无法解码的数据包同样消耗令牌，耗尽后来源被隔离
+		for i := 0; i < 3; i++ {
+			c.receive(src, []byte("garbage"))
+		}
+		if !quarantined(c) {
+			t.Fatal("泛洪的来源未被隔离")
+		}
+		if c.receive(src, valid(&Codec{})) != nil {
+			t.Fatal("隔离期间的消息被投递")
+		}
+	})
+
+	t.Run("签名时伪造的数据包不能隔离合法节点", func(t *testing.T) {
+		c := newClient(signed)
+		forged, _ := (&Codec{}).Encode(&Message{DeviceID: "a", IP: "10.0.0.2", Seq: 1000})
+		for i := 0; i < 2*preAuthFactor; i++ {
+			c.receive(src, forged)
+		}
+		if quarantined(c) {
+			t.Fatal("签名校验失败的数据包导致来源被隔离")
+		}
+		// 宽松的预过滤限制了解码次数
+		stats := c.Stats()
+		if stats.Unsigned != 2*preAuthFactor || stats.RateLimited != 0 {
+			t.Fatalf("Unsigned = %d, RateLimited = %d", stats.Unsigned, stats.RateLimited)
+		}
+		if c.receive(src, forged); c.Stats().RateLimited != 1 {
+			t.Fatal("超出宽松限流的数据包未被丢弃")
+		}
+	})
+
+	t.Run("签名时校验通过后严格限流", func(t *testing.T) {
+		c := newClient(signed)
+		for i := 0; i < 2; i++ {
+			if c.receive(src, valid(signed)) == nil {
+				t.Fatalf("第 %d 条合法消息被丢弃", i+1)
+			}
+		}
+		if c.receive(src, valid(signed)) != nil || !quarantined(c) {
+			t.Fatal("超出限流的合法来源未被隔离")
+		}
+	})
+}
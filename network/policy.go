@@ -0,0 +1,92 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"path"
+)
+
+// InterfacePolicy 网卡选择策略
+// 决定在哪些网卡上加入组播组，以及通告哪些地址
+type InterfacePolicy struct {
+	Include          []string     // 仅使用匹配的网卡（通配符），为空表示全部
+	Exclude          []string     // 排除匹配的网卡（通配符，如 docker*、veth*、br-*）
+	PreferredSubnets []*net.IPNet // 优先通告的网段，按顺序优先
+}
+
+// NewInterfacePolicy 创建网卡选择策略
+func NewInterfacePolicy(include, exclude, preferredSubnets []string) (*InterfacePolicy, error) {
+	for _, pattern := range append(append([]string{}, include...), exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("无效的网卡匹配规则 %q: %v", pattern, err)
+		}
+	}
+
+	p := &InterfacePolicy{
+		Include: include,
+		Exclude: exclude,
+	}
+	for _, cidr := range preferredSubnets {
+		_, subnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("无效的网段 %q: %v", cidr, err)
+		}
+		p.PreferredSubnets = append(p.PreferredSubnets, subnet)
+	}
+	return p, nil
+}
+
+// Allow 网卡是否允许使用，nil 策略允许全部网卡
+func (p *InterfacePolicy) Allow(name string) bool {
+	if p == nil {
+		return true
+	}
+
+	for _, pattern := range p.Exclude {
+		if ok, _ := path.Match(pattern, name); ok {
+			return false
+		}
+	}
+
+	if len(p.Include) == 0 {
+		return true
+	}
+	for _, pattern := range p.Include {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// selectPrimary 选择主地址
+// 优先选择位于偏好网段中的地址（按网段顺序），否则选择第一个同地址族的地址
+func (p *InterfacePolicy) selectPrimary(addrs []Address, v6 bool) string {
+	var candidates []Address
+	for _, a := range addrs {
+		ip := net.ParseIP(a.IP)
+		if ip == nil || (ip.To4() == nil) != v6 {
+			continue
+		}
+		// IPv6 只选择全局单播或 ULA 地址
+		if v6 && !ip.IsGlobalUnicast() {
+			continue
+		}
+		candidates = append(candidates, a)
+	}
+
+	if p != nil {
+		for _, subnet := range p.PreferredSubnets {
+			for _, a := range candidates {
+				if subnet.Contains(net.ParseIP(a.IP)) {
+					return a.IP
+				}
+			}
+		}
+	}
+
+	if len(candidates) > 0 {
+		return candidates[0].IP
+	}
+	return ""
+}
@@ -0,0 +1,86 @@
+package network
+
+import "testing"
+
+func TestInterfacePolicyAllow(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		allowed map[string]bool
+	}{
+		{"默认全部允许", nil, nil,
+			map[string]bool{"eth0": true, "docker0": true}},
+		{"排除", nil, []string{"docker*", "veth*", "br-*"},
+			map[string]bool{"eth0": true, "docker0": false, "veth1a2b": false, "br-3f2e": false, "bridge0": true}},
+		{"仅包含", []string{"eth*", "wlan0"}, nil,
+			map[string]bool{"eth0": true, "eth1": true, "wlan0": true, "wlan1": false, "docker0": false}},
+		{"排除优先", []string{"eth*"}, []string{"eth1"},
+			map[string]bool{"eth0": true, "eth1": false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewInterfacePolicy(tt.include, tt.exclude, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, want := range tt.allowed {
+				if got := p.Allow(name); got != want {
+					t.Errorf("Allow(%q) = %v, want %v", name, got, want)
+				}
+			}
+		})
+	}
+
+	var nilPolicy *InterfacePolicy
+	if !nilPolicy.Allow("docker0") {
+		t.Error("nil 策略应允许全部网卡")
+	}
+}
+
+func TestNewInterfacePolicyInvalid(t *testing.T) {
+	if _, err := NewInterfacePolicy([]string{"eth["}, nil, nil); err == nil {
+		t.Error("无效的匹配规则应返回错误")
+	}
+	if _, err := NewInterfacePolicy(nil, nil, []string{"192.168.1.0"}); err == nil {
+		t.Error("无效的网段应返回错误")
+	}
+}
+
+func TestSelectPrimary(t *testing.T) {
+	addrs := []Address{
+		{IP: "172.17.0.1", Iface: "docker0", Prefix: 16},
+		{IP: "192.168.1.10", Iface: "eth0", Prefix: 24},
+		{IP: "10.0.0.10", Iface: "eth1", Prefix: 8},
+		{IP: "fe80::1", Iface: "eth0", Prefix: 64},
+		{IP: "fd00::10", Iface: "eth0", Prefix: 64},
+	}
+	tests := []struct {
+		name      string
+		preferred []string
+		v6        bool
+		want      string
+	}{
+		{"没有偏好网段时选择第一个", nil, false, "172.17.0.1"},
+		{"偏好网段", []string{"192.168.0.0/16"}, false, "192.168.1.10"},
+		{"按偏好网段顺序", []string{"10.0.0.0/8", "192.168.0.0/16"}, false, "10.0.0.10"},
+		{"偏好网段都不匹配", []string{"192.0.2.0/24"}, false, "172.17.0.1"},
+		{"IPv6 跳过链路本地地址", nil, true, "fd00::10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewInterfacePolicy(nil, nil, tt.preferred)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := p.selectPrimary(addrs, tt.v6); got != tt.want {
+				t.Fatalf("selectPrimary = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	var nilPolicy *InterfacePolicy
+	if got := nilPolicy.selectPrimary(addrs[:1], true); got != "" {
+		t.Fatalf("没有 IPv6 地址时 selectPrimary = %q", got)
+	}
+}
@@ -0,0 +1,135 @@
+package network
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// maxLimiterEntries 限流表的最大条目数，防止伪造源地址撑爆内存
+	maxLimiterEntries = 4096
+	// preAuthFactor 签名校验之前的预过滤相对于源地址限流的放宽倍数
+	preAuthFactor = 4
+)
+
+// bucket 令牌桶
+type bucket struct {
+	tokens           float64
+	last             time.Time
+	quarantinedUntil time.Time
+}
+
+// Quarantine 被隔离的来源
+type Quarantine struct {
+	Key   string    `json:"key"`   // 源地址或 DeviceID
+	Until time.Time `json:"until"` // 隔离结束时间
+}
+
+// RateLimiter 按键（源地址或 DeviceID）限流的令牌桶集合
+// 令牌耗尽的来源会被隔离一段时间，期间的数据包全部丢弃
+type RateLimiter struct {
+	mu         sync.Mutex
+	rate       float64 // 每秒补充的令牌数
+	burst      float64 // 桶容量
+	quarantine time.Duration
+	buckets    map[string]*bucket
+}
+
+// NewRateLimiter 创建限流器
+// rate 为每秒允许的数据包数，burst 为允许的突发量，quarantine 为令牌耗尽后的隔离时长
+func NewRateLimiter(rate float64, burst int, quarantine time.Duration) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:       rate,
+		burst:      float64(burst),
+		quarantine: quarantine,
+		buckets:    make(map[string]*bucket),
+	}
+}
+
+// loosened 按倍数放宽且不隔离的限流器，用于签名校验之前的预过滤，nil 限流器返回 nil
+// 预过滤只限制每个来源的解码开销，伪造源地址的泛洪停止后合法节点立即恢复
+func (l *RateLimiter) loosened(factor float64) *RateLimiter {
+	if l == nil {
+		return nil
+	}
+	return NewRateLimiter(l.rate*factor, int(l.burst*factor), 0)
+}
+
+// Allow 消耗一个令牌，返回是否放行；quarantined 表示本次触发了隔离
+func (l *RateLimiter) Allow(key string) (allowed, quarantined bool) {
+	if l == nil {
+		return true, false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxLimiterEntries {
+			l.prune(now)
+			if len(l.buckets) >= maxLimiterEntries {
+				// 短时间内出现大量新来源，视为泛洪
+				return false, false
+			}
+		}
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	if now.Before(b.quarantinedUntil) {
+		return false, false
+	}
+
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, false
+	}
+
+	// 令牌耗尽，隔离该来源；隔离结束后以满桶重新开始
+	if l.quarantine > 0 {
+		b.quarantinedUntil = now.Add(l.quarantine)
+		b.tokens = l.burst
+		return false, true
+	}
+	return false, false
+}
+
+// Quarantined 当前处于隔离中的来源
+func (l *RateLimiter) Quarantined() []Quarantine {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	var list []Quarantine
+	for key, b := range l.buckets {
+		if now.Before(b.quarantinedUntil) {
+			list = append(list, Quarantine{Key: key, Until: b.quarantinedUntil})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list
+}
+
+// prune 清理已回满且未被隔离的条目，调用方需持有锁
+func (l *RateLimiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		if now.Before(b.quarantinedUntil) {
+			continue
+		}
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
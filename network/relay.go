@@ -0,0 +1,292 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/net/ipv4"
+)
+
+// MaxHops 消息最多被中继转发的次数
+const MaxHops = 4
+
+// relaySide 中继连接的一个网段
+type relaySide struct {
+	iface   net.Interface
+	subnets []*net.IPNet
+}
+
+// contains 地址是否属于该网段
+func (s *relaySide) contains(ip net.IP) bool {
+	for _, subnet := range s.subnets {
+		if subnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Relay 组播中继
+// 运行在连接多个网段（如两个 VLAN）的主机上，把从一个网段收到的消息
+// 重新组播到其他网段；消息中记录跳数和经过的中继 ID，防止形成环路。
+// 目前只支持 IPv4 组播
+type Relay struct {
+	id         string
+	addr       string
+	port       int
+	policy     *InterfacePolicy
+	conn       *net.UDPConn
+	packetConn *ipv4.PacketConn
+	group      *net.UDPAddr
+	sides      []*relaySide
+	codec      *Codec
+	srcLimit   *RateLimiter // 按源地址限流，nil 表示不限流
+	preLimit   *RateLimiter // 启用签名时解码前的宽松限流，nil 表示不限流
+	stats      counters
+	frags      *reassembler
+	forwarded  atomic.Uint64
+	writeMu    sync.Mutex // 切换组播出口接口和发送需要串行
+	wg         sync.WaitGroup
+	closeOnce  sync.Once
+	closeErr   error
+}
+
+// NewRelay 创建组播中继
+// id 为中继标识，policy 决定参与中继的网卡，至少需要两个网段
+func NewRelay(id, addr string, port int, policy *InterfacePolicy) *Relay {
+	r := &Relay{
+		id:     id,
+		addr:   addr,
+		port:   port,
+		policy: policy,
+		codec:  &Codec{},
+	}
+	r.frags = newReassembler(&r.stats)
+	return r
+}
+
+// SetCodec 设置消息编解码器，需与集群使用相同的密钥和加密模式
+func (r *Relay) SetCodec(codec *Codec) {
+	r.codec = codec
+}
+
+// SetRateLimit 设置按源地址的接收限流，nil 表示不限流
+// 与节点相同：接收未签名消息时解码前限流，启用签名后解码前只做宽松的限流，签名校验通过后再严格限流
+func (r *Relay) SetRateLimit(source *RateLimiter) {
+	r.srcLimit = source
+	r.preLimit = source.loosened(preAuthFactor)
+}
+
+// Stats 获取收包统计
+func (r *Relay) Stats() Stats {
+	return r.stats.snapshot()
+}
+
+// Forwarded 已转发的消息数（按目标网段计）
+func (r *Relay) Forwarded() uint64 {
+	return r.forwarded.Load()
+}
+
+// Interfaces 参与中继的网卡名称
+func (r *Relay) Interfaces() []string {
+	names := make([]string, 0, len(r.sides))
+	for _, side := range r.sides {
+		names = append(names, side.iface.Name)
+	}
+	return names
+}
+
+// Start 启动中继，ctx 取消时关闭中继
+func (r *Relay) Start(ctx context.Context) error {
+	r.group = &net.UDPAddr{
+		IP:   net.ParseIP(r.addr),
+		Port: r.port,
+	}
+	if r.group.IP == nil || r.group.IP.To4() == nil {
+		return fmt.Errorf("无效的IPv4组播地址: %s", r.addr)
+	}
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{
+		IP:   net.IPv4zero,
+		Port: r.port,
+	})
+	if err != nil {
+		return fmt.Errorf("创建UDP连接失败: %v", err)
+	}
+	r.conn = conn
+	r.packetConn = ipv4.NewPacketConn(conn)
+
+	// 不接收自己转发出去的消息
+	r.packetConn.SetMulticastLoopback(false)
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		conn.Close()
+		r.conn = nil
+		return fmt.Errorf("获取网络接口失败: %v", err)
+	}
+
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagMulticast == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		if !r.policy.Allow(iface.Name) {
+			continue
+		}
+		side := &relaySide{iface: iface}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+				side.subnets = append(side.subnets, ipNet)
+			}
+		}
+		if len(side.subnets) == 0 {
+			continue
+		}
+		if err := r.packetConn.JoinGroup(&side.iface, r.group); err != nil {
+			continue
+		}
+		r.sides = append(r.sides, side)
+	}
+
+	if len(r.sides) < 2 {
+		conn.Close()
+		r.conn = nil
+		return fmt.Errorf("中继至少需要两个可用网段，当前 %d 个", len(r.sides))
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.receiveLoop()
+	}()
+	context.AfterFunc(ctx, func() { r.Close() })
+	return nil
+}
+
+// Close 关闭中继并等待接收协程退出，可重复调用
+func (r *Relay) Close() error {
+	r.closeOnce.Do(func() {
+		if r.conn != nil {
+			r.closeErr = r.conn.Close()
+		}
+	})
+	r.wg.Wait()
+	return r.closeErr
+}
+
+// receiveLoop 接收并转发消息
+func (r *Relay) receiveLoop() {
+	buffer := make([]byte, maxPacketSize)
+
+	for {
+		n, src, err := r.conn.ReadFromUDP(buffer)
+		if err != nil {
+			return
+		}
+
+		from, packets := r.prepare(src, buffer[:n])
+		if packets == nil {
+			continue
+		}
+		for _, side := range r.sides {
+			if side == from {
+				continue
+			}
+			if err := r.forward(side, packets); err == nil {
+				r.forwarded.Add(1)
+			}
+		}
+	}
+}
+
+// prepare 处理收到的数据报，返回消息来自的网段和需要转发的数据报，不需要转发时返回 nil
+func (r *Relay) prepare(src *net.UDPAddr, packet []byte) (*relaySide, [][]byte) {
+	r.stats.received.Add(1)
+
+	preAuth := r.codec.AcceptsUnsigned()
+	limiter := r.preLimit
+	if preAuth {
+		limiter = r.srcLimit
+	}
+	if !r.stats.countLimit(limiter.Allow(src.IP.String())) {
+		return nil, nil
+	}
+
+	data, err := r.frags.add(src.String(), packet)
+	if err != nil {
+		r.stats.countDecodeError(err)
+		return nil, nil
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	msg, err := r.codec.Decode(data)
+	if err != nil {
+		r.stats.countDecodeError(err)
+		return nil, nil
+	}
+	if !preAuth && !r.stats.countLimit(r.srcLimit.Allow(src.IP.String())) {
+		return nil, nil
+	}
+
+	// 防环路：已经过本中继或超过最大跳数的消息不再转发
+	if msg.Hops >= MaxHops || slices.Contains(msg.Via, r.id) {
+		return nil, nil
+	}
+
+	from := r.sideOf(src.IP)
+	if from == nil {
+		return nil, nil
+	}
+
+	msg.Hops++
+	msg.Via = append(msg.Via, r.id)
+	// 增加跳数后重新编码，长度变化可能导致分片数不同；
+	// 迁移期间接收的未签名消息仍以明文转发，中继不能代为签名，否则其他网段中要求签名的节点会接收伪造的消息
+	var encoded []byte
+	if r.codec.Signed() && !msg.Authenticated {
+		encoded, err = json.Marshal(msg)
+	} else {
+		encoded, err = r.codec.Encode(msg)
+	}
+	if err != nil {
+		return nil, nil
+	}
+	packets, err := splitFragments(encoded)
+	if err != nil {
+		r.stats.oversize.Add(1)
+		return nil, nil
+	}
+	return from, packets
+}
+
+// sideOf 根据源地址判断消息来自哪个网段
+func (r *Relay) sideOf(ip net.IP) *relaySide {
+	for _, side := range r.sides {
+		if side.contains(ip) {
+			return side
+		}
+	}
+	return nil
+}
+
+// forward 从指定网段的网卡发送组播
+func (r *Relay) forward(side *relaySide, packets [][]byte) error {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	if err := r.packetConn.SetMulticastInterface(&side.iface); err != nil {
+		return err
+	}
+	return writePackets(r.conn, packets, r.group)
+}
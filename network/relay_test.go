@@ -0,0 +1,120 @@
+package network
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"slices"
+	"testing"
+)
+
+// newTestRelay 创建连接 10.0.1.0/24 和 10.0.2.0/24 两个网段的中继，不打开连接
+func newTestRelay(t *testing.T, codec *Codec) *Relay {
+	t.Helper()
+	r := NewRelay("relay-1", "239.255.255.250", 9527, nil)
+	r.SetCodec(codec)
+	for i, cidr := range []string{"10.0.1.0/24", "10.0.2.0/24"} {
+		_, subnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.sides = append(r.sides, &relaySide{iface: net.Interface{Index: i + 1}, subnets: []*net.IPNet{subnet}})
+	}
+	return r
+}
+
+func encodeTest(t *testing.T, codec *Codec, msg *Message) []byte {
+	t.Helper()
+	data, err := codec.Encode(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+var relaySrc = &net.UDPAddr{IP: net.ParseIP("10.0.1.5"), Port: 9527}
+
+func TestRelayHopsAndLoops(t *testing.T) {
+	codec := &Codec{}
+	tests := []struct {
+		name    string
+		msg     *Message
+		src     *net.UDPAddr
+		forward bool
+	}{
+		{"首次转发", &Message{DeviceID: "a", Seq: 1}, relaySrc, true},
+		{"经过其他中继", &Message{DeviceID: "a", Seq: 1, Hops: 1, Via: []string{"relay-2"}}, relaySrc, true},
+		{"已经过本中继", &Message{DeviceID: "a", Seq: 1, Hops: 2, Via: []string{"relay-1", "relay-2"}}, relaySrc, false},
+		{"超过最大跳数", &Message{DeviceID: "a", Seq: 1, Hops: MaxHops}, relaySrc, false},
+		{"不属于任何网段", &Message{DeviceID: "a", Seq: 1}, &net.UDPAddr{IP: net.ParseIP("192.168.1.5"), Port: 9527}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRelay(t, codec)
+			from, packets := r.prepare(tt.src, encodeTest(t, codec, tt.msg))
+			if (packets != nil) != tt.forward {
+				t.Fatalf("forward = %v, want %v", packets != nil, tt.forward)
+			}
+			if !tt.forward {
+				return
+			}
+			if from != r.sides[0] {
+				t.Fatal("来源网段错误")
+			}
+			msg, err := codec.Decode(packets[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg.Hops != tt.msg.Hops+1 || !slices.Equal(msg.Via, append(tt.msg.Via, "relay-1")) {
+				t.Fatalf("Hops = %d, Via = %v", msg.Hops, msg.Via)
+			}
+		})
+	}
+}
+
+// TestRelayDoesNotSignPlaintext 迁移期间接收的未签名消息不能由中继签名后转发
+func TestRelayDoesNotSignPlaintext(t *testing.T) {
+	migrating, _ := NewCodec("secret", EncryptionPlain, true)
+	strict, _ := NewCodec("secret", EncryptionPlain, false)
+	r := newTestRelay(t, migrating)
+
+	legacy, _ := json.Marshal(&Message{DeviceID: "legacy", Seq: 1})
+	_, packets := r.prepare(relaySrc, legacy)
+	if packets == nil {
+		t.Fatal("迁移期间未转发旧版本消息")
+	}
+	if _, err := strict.Decode(packets[0]); !errors.Is(err, ErrUnsigned) {
+		t.Fatalf("要求签名的节点解码转发的明文消息: %v", err)
+	}
+	if msg, err := migrating.Decode(packets[0]); err != nil || msg.Authenticated {
+		t.Fatalf("迁移中的节点解码: %+v, %v", msg, err)
+	}
+
+	// 签名的消息重新签名后转发
+	_, packets = r.prepare(relaySrc, encodeTest(t, strict, &Message{DeviceID: "signed", Seq: 1}))
+	msg, err := strict.Decode(packets[0])
+	if err != nil || !msg.Authenticated || msg.Hops != 1 {
+		t.Fatalf("签名消息: %+v, %v", msg, err)
+	}
+}
+
+func TestRelayRateLimit(t *testing.T) {
+	codec := &Codec{}
+	r := newTestRelay(t, codec)
+	r.SetRateLimit(NewRateLimiter(0.001, 1, 0))
+
+	data := encodeTest(t, codec, &Message{DeviceID: "a", Seq: 1})
+	if _, packets := r.prepare(relaySrc, data); packets == nil {
+		t.Fatal("第一条消息被限流")
+	}
+	if _, packets := r.prepare(relaySrc, data); packets != nil {
+		t.Fatal("超出限流的消息被转发")
+	}
+	other := &net.UDPAddr{IP: net.ParseIP("10.0.1.6"), Port: 9527}
+	if _, packets := r.prepare(other, data); packets == nil {
+		t.Fatal("其他来源被限流")
+	}
+	if r.Stats().RateLimited != 1 {
+		t.Fatalf("RateLimited = %d, want 1", r.Stats().RateLimited)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package network
+
+import "syscall"
+
+// reusePort 其他平台不设置端口复用，5353 端口被系统服务独占时 mDNS 无法启动
+func reusePort(network, address string, c syscall.RawConn) error {
+	return nil
+}
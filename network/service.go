@@ -0,0 +1,124 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 服务协议
+const (
+	ProtoTCP = "tcp"
+	ProtoUDP = "udp"
+)
+
+// maxServiceName 服务名最大长度（RFC 6335）
+const maxServiceName = 15
+
+// Service 节点提供的服务，随心跳通告
+type Service struct {
+	Name  string `json:"name"`            // 服务名，如 http、ssh
+	Port  int    `json:"port"`            // 端口
+	Proto string `json:"proto,omitempty"` // 协议 tcp/udp，为空表示 tcp
+}
+
+// ParseService 解析服务声明，格式为 name:port 或 name:port/udp
+func ParseService(spec string) (Service, error) {
+	name, port, ok := strings.Cut(strings.TrimSpace(spec), ":")
+	if !ok {
+		return Service{}, fmt.Errorf("服务格式应为 name:port: %s", spec)
+	}
+
+	svc := Service{Name: strings.ToLower(name)}
+	port, proto, _ := strings.Cut(port, "/")
+	switch proto = strings.ToLower(proto); proto {
+	case "", ProtoTCP:
+	case ProtoUDP:
+		svc.Proto = ProtoUDP
+	default:
+		return Service{}, fmt.Errorf("不支持的协议 %s: %s", proto, spec)
+	}
+	svc.Port, _ = strconv.Atoi(port)
+
+	if !validServiceName(svc.Name) {
+		return Service{}, fmt.Errorf("服务名只能包含字母、数字和连字符，且不超过 %d 个字符: %s", maxServiceName, spec)
+	}
+	if svc.Port <= 0 || svc.Port > 65535 {
+		return Service{}, fmt.Errorf("无效的端口: %s", spec)
+	}
+	return svc, nil
+}
+
+// ParseServices 解析服务声明列表，返回有效的服务和全部解析错误
+func ParseServices(specs []string) ([]Service, error) {
+	var services []Service
+	var errs []error
+	for _, spec := range specs {
+		svc, err := ParseService(spec)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		services = append(services, svc)
+	}
+	return services, errors.Join(errs...)
+}
+
+// Protocol 服务协议，默认 tcp
+func (s Service) Protocol() string {
+	if s.Proto == "" {
+		return ProtoTCP
+	}
+	return s.Proto
+}
+
+// SRVName 服务在指定域名下的 SRV 记录名，如 _http._tcp.box.coobee.local
+func (s Service) SRVName(domain string) string {
+	return fmt.Sprintf("_%s._%s.%s", s.Name, s.Protocol(), domain)
+}
+
+// String 服务声明格式，如 http:8080、dns:53/udp
+func (s Service) String() string {
+	if s.Proto == "" {
+		return fmt.Sprintf("%s:%d", s.Name, s.Port)
+	}
+	return fmt.Sprintf("%s:%d/%s", s.Name, s.Port, s.Proto)
+}
+
+// ParseSRVName 拆分 SRV 记录名，如 _http._tcp.box.coobee.local 拆分为 http、tcp 和 box.coobee.local
+func ParseSRVName(name string) (service, proto, domain string, ok bool) {
+	labels := strings.SplitN(strings.TrimSuffix(name, "."), ".", 3)
+	if len(labels) != 3 || !strings.HasPrefix(labels[0], "_") || !strings.HasPrefix(labels[1], "_") {
+		return "", "", "", false
+	}
+	service = strings.ToLower(labels[0][1:])
+	proto = strings.ToLower(labels[1][1:])
+	if service == "" || (proto != ProtoTCP && proto != ProtoUDP) || labels[2] == "" {
+		return "", "", "", false
+	}
+	return service, proto, strings.ToLower(labels[2]), true
+}
+
+// FindService 按服务名和协议查找服务
+func FindService(services []Service, name, proto string) (Service, bool) {
+	for _, svc := range services {
+		if svc.Name == name && svc.Protocol() == proto {
+			return svc, true
+		}
+	}
+	return Service{}, false
+}
+
+// validServiceName 服务名只能包含字母、数字和连字符，不能以连字符开头或结尾
+func validServiceName(name string) bool {
+	if name == "" || len(name) > maxServiceName || name[0] == '-' || name[len(name)-1] == '-' {
+		return false
+	}
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+			return false
+		}
+	}
+	return true
+}
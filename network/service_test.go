@@ -0,0 +1,102 @@
+package network
+
+import "testing"
+
+func TestParseService(t *testing.T) {
+	tests := []struct {
+		spec string
+		want Service
+		ok   bool
+	}{
+		{"http:8080", Service{Name: "http", Port: 8080}, true},
+		{" SSH:22 ", Service{Name: "ssh", Port: 22}, true},
+		{"http:8080/tcp", Service{Name: "http", Port: 8080}, true},
+		{"dns:53/UDP", Service{Name: "dns", Port: 53, Proto: ProtoUDP}, true},
+		{"my-app:65535", Service{Name: "my-app", Port: 65535}, true},
+		{"http", Service{}, false},
+		{"http:", Service{}, false},
+		{"http:0", Service{}, false},
+		{"http:65536", Service{}, false},
+		{"http:abc", Service{}, false},
+		{"http:80/sctp", Service{}, false},
+		{":80", Service{}, false},
+		{"-http:80", Service{}, false},
+		{"http-:80", Service{}, false},
+		{"my_app:80", Service{}, false},
+		{"averyveryverylongname:80", Service{}, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseService(tt.spec)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseService(%q) err = %v，期望成功 = %v", tt.spec, err, tt.ok)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseService(%q) = %+v，期望 %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestParseServices(t *testing.T) {
+	services, err := ParseServices([]string{"http:8080", "bad", "dns:53/udp", "ssh:99999"})
+	if err == nil {
+		t.Fatal("无效声明未返回错误")
+	}
+	if len(services) != 2 || services[0].Name != "http" || services[1].Name != "dns" {
+		t.Fatalf("services = %+v，期望保留有效的 http 和 dns", services)
+	}
+}
+
+func TestServiceString(t *testing.T) {
+	for _, spec := range []string{"http:8080", "dns:53/udp"} {
+		svc, err := ParseService(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if svc.String() != spec {
+			t.Errorf("String() = %q，期望 %q", svc.String(), spec)
+		}
+	}
+	if name := (Service{Name: "dns", Port: 53, Proto: ProtoUDP}).SRVName("box.coobee.local"); name != "_dns._udp.box.coobee.local" {
+		t.Errorf("SRVName = %q", name)
+	}
+}
+
+func TestParseSRVName(t *testing.T) {
+	tests := []struct {
+		name                   string
+		service, proto, domain string
+		ok                     bool
+	}{
+		{"_http._tcp.box.coobee.local", "http", "tcp", "box.coobee.local", true},
+		{"_HTTP._TCP.Box.Coobee.Local.", "http", "tcp", "box.coobee.local", true},
+		{"_dns._udp.box.coobee.local", "dns", "udp", "box.coobee.local", true},
+		{"http._tcp.box.coobee.local", "", "", "", false},
+		{"_http.tcp.box.coobee.local", "", "", "", false},
+		{"_http._sctp.box.coobee.local", "", "", "", false},
+		{"__tcp.box.coobee.local", "", "", "", false},
+		{"_http._tcp", "", "", "", false},
+		{"_http._tcp.", "", "", "", false},
+		{"box.coobee.local", "", "", "", false},
+	}
+	for _, tt := range tests {
+		service, proto, domain, ok := ParseSRVName(tt.name)
+		if ok != tt.ok || service != tt.service || proto != tt.proto || domain != tt.domain {
+			t.Errorf("ParseSRVName(%q) = %q, %q, %q, %v，期望 %q, %q, %q, %v",
+				tt.name, service, proto, domain, ok, tt.service, tt.proto, tt.domain, tt.ok)
+		}
+	}
+}
+
+func TestFindService(t *testing.T) {
+	services := []Service{{Name: "dns", Port: 53}, {Name: "dns", Port: 5353, Proto: ProtoUDP}}
+	if svc, ok := FindService(services, "dns", ProtoUDP); !ok || svc.Port != 5353 {
+		t.Errorf("FindService(dns, udp) = %+v, %v", svc, ok)
+	}
+	if svc, ok := FindService(services, "dns", ProtoTCP); !ok || svc.Port != 53 {
+		t.Errorf("FindService(dns, tcp) = %+v, %v", svc, ok)
+	}
+	if _, ok := FindService(services, "http", ProtoTCP); ok {
+		t.Error("找到了不存在的服务")
+	}
+}
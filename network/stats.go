@@ -0,0 +1,96 @@
+package network
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// Stats 收包统计
+type Stats struct {
+	Received     uint64 `json:"received"`     // 接收的数据包
+	Invalid      uint64 `json:"invalid"`      // 无法解析而丢弃
+	Unsigned     uint64 `json:"unsigned"`     // 未签名而丢弃
+	BadSignature uint64 `json:"badSignature"` // 签名无效而丢弃
+	Plaintext    uint64 `json:"plaintext"`    // 加密模式下拒绝的明文消息
+	Undecrypted  uint64 `json:"undecrypted"`  // 无法解密而丢弃
+	Truncated    uint64 `json:"truncated"`    // 数据不完整（被截断）而丢弃
+	Incomplete   uint64 `json:"incomplete"`   // 分片未在超时前收齐而丢弃的消息
+	Fragments    uint64 `json:"fragments"`    // 接收的分片数
+	Reassembled  uint64 `json:"reassembled"`  // 重组完成的消息数
+	Oversize     uint64 `json:"oversize"`     // 超过最大长度而无法发送的消息
+	RateLimited  uint64 `json:"rateLimited"`  // 超出限流或处于隔离期而丢弃
+	Quarantines  uint64 `json:"quarantines"`  // 触发隔离的次数
+	Mismatched   uint64 `json:"mismatched"`   // 源地址与通告地址不一致（可能伪造）的消息
+}
+
+// Dropped 丢弃的数据包总数
+func (s Stats) Dropped() uint64 {
+	return s.Invalid + s.Unsigned + s.BadSignature + s.Plaintext + s.Undecrypted + s.Truncated + s.Incomplete + s.RateLimited
+}
+
+// counters 并发安全的计数器
+type counters struct {
+	received     atomic.Uint64
+	invalid      atomic.Uint64
+	unsigned     atomic.Uint64
+	badSignature atomic.Uint64
+	plaintext    atomic.Uint64
+	undecrypted  atomic.Uint64
+	truncated    atomic.Uint64
+	incomplete   atomic.Uint64
+	fragments    atomic.Uint64
+	reassembled  atomic.Uint64
+	oversize     atomic.Uint64
+	rateLimited  atomic.Uint64
+	quarantines  atomic.Uint64
+	mismatched   atomic.Uint64
+}
+
+// snapshot 获取计数快照
+func (c *counters) snapshot() Stats {
+	return Stats{
+		Received:     c.received.Load(),
+		Invalid:      c.invalid.Load(),
+		Unsigned:     c.unsigned.Load(),
+		BadSignature: c.badSignature.Load(),
+		Plaintext:    c.plaintext.Load(),
+		Undecrypted:  c.undecrypted.Load(),
+		Truncated:    c.truncated.Load(),
+		Incomplete:   c.incomplete.Load(),
+		Fragments:    c.fragments.Load(),
+		Reassembled:  c.reassembled.Load(),
+		Oversize:     c.oversize.Load(),
+		RateLimited:  c.rateLimited.Load(),
+		Quarantines:  c.quarantines.Load(),
+		Mismatched:   c.mismatched.Load(),
+	}
+}
+
+// countLimit 记录限流结果，返回是否放行
+func (c *counters) countLimit(allowed, quarantined bool) bool {
+	if quarantined {
+		c.quarantines.Add(1)
+	}
+	if !allowed {
+		c.rateLimited.Add(1)
+	}
+	return allowed
+}
+
+// countDecodeError 按解码错误类型计数
+func (c *counters) countDecodeError(err error) {
+	switch {
+	case errors.Is(err, ErrUnsigned):
+		c.unsigned.Add(1)
+	case errors.Is(err, ErrBadSignature):
+		c.badSignature.Add(1)
+	case errors.Is(err, ErrPlaintext):
+		c.plaintext.Add(1)
+	case errors.Is(err, ErrUndecryptable):
+		c.undecrypted.Add(1)
+	case errors.Is(err, ErrTruncated):
+		c.truncated.Add(1)
+	default:
+		c.invalid.Add(1)
+	}
+}
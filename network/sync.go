@@ -0,0 +1,18 @@
+package network
+
+// Member 集群成员快照，用于启动时的成员同步
+type Member struct {
+	DeviceID string            `json:"deviceId"`           // 设备ID
+	Domain   string            `json:"domain"`             // 域名
+	IP       string            `json:"ip"`                 // IP地址
+	IPv6     string            `json:"ipv6,omitempty"`     // IPv6地址
+	Addrs    []Address         `json:"addrs,omitempty"`    // 全部可用地址
+	Hostname string            `json:"hostname"`           // 主机名
+	Services []Service         `json:"services,omitempty"` // 提供的服务
+	Labels   map[string]string `json:"labels,omitempty"`   // 标签
+}
+
+// PreferredAddrs 根据本机网段从成员地址列表中选择可达地址
+func (m *Member) PreferredAddrs(local []Address) (ip, ipv6 string) {
+	return preferredAddrs(m.IP, m.IPv6, m.Addrs, local)
+}
@@ -0,0 +1,31 @@
+package network
+
+import "context"
+
+// Transport 集群消息传输层
+// MulticastClient 基于 UDP 组播/单播实现，MemoryTransport 基于内存总线实现（用于测试）
+type Transport interface {
+	// Start 开始接收消息，ctx 取消时关闭传输层
+	Start(ctx context.Context) error
+	// Send 向集群广播消息
+	Send(msg *Message) error
+	// SendTo 单播消息到指定节点
+	SendTo(msg *Message, ip string) error
+	// Subscribe 设置消息处理函数，需在 Start 之前调用
+	Subscribe(handler func(*Message))
+	// GetLocalIP 本机主地址
+	GetLocalIP() string
+	// GetLocalIPv6 本机 IPv6 地址，未启用时为空
+	GetLocalIPv6() string
+	// GetLocalAddresses 本机全部可用地址（主地址在前）
+	GetLocalAddresses() []Address
+	// Stats 收包统计
+	Stats() Stats
+	// Close 关闭传输层，返回后不再触发消息处理函数
+	Close() error
+}
+
+var (
+	_ Transport = (*MulticastClient)(nil)
+	_ Transport = (*MemoryTransport)(nil)
+)
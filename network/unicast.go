@@ -0,0 +1,205 @@
+package network
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxSharedPeers 心跳中携带的对端数量上限
+	maxSharedPeers = 32
+	// maxLearnedPeers 学习到的对端数量上限
+	maxLearnedPeers = maxSharedPeers * 4
+)
+
+// peerEntry 学习到的对端
+type peerEntry struct {
+	seen   time.Time // 直接收到消息的时间，转告的对端为加入的时间
+	direct bool      // 是否直接收到过该对端的消息
+}
+
+// peerTable 单播对端表
+// 种子节点始终保留，从收到的消息中学习到的对端超时后移除。
+// 只有直接收到消息才刷新时间，其他节点转告的对端不延长有效期，也不再转告，
+// 已经下线的对端不会在节点之间来回转告而永不过期
+type peerTable struct {
+	mu      sync.Mutex
+	seeds   []string
+	learned map[string]peerEntry // key: ip:port
+	timeout time.Duration
+}
+
+// learn 记录直接收到消息的对端，对端表已满时淘汰最久没有消息的对端
+func (t *peerTable) learn(addr string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if _, exists := t.learned[addr]; !exists && len(t.learned) >= maxLearnedPeers {
+		t.evict(now)
+	}
+	t.learned[addr] = peerEntry{seen: now, direct: true}
+}
+
+// mention 记录其他节点转告的对端，已知的对端不刷新，对端表已满时忽略
+func (t *peerTable) mention(addr string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, exists := t.learned[addr]; exists || len(t.learned) >= maxLearnedPeers {
+		return
+	}
+	t.learned[addr] = peerEntry{seen: time.Now()}
+}
+
+// evict 清理过期对端，仍然已满时淘汰最久没有消息的对端，调用方需持有锁
+func (t *peerTable) evict(now time.Time) {
+	oldest := ""
+	for addr, entry := range t.learned {
+		if now.Sub(entry.seen) > t.timeout {
+			delete(t.learned, addr)
+			continue
+		}
+		if oldest == "" || entry.seen.Before(t.learned[oldest].seen) {
+			oldest = addr
+		}
+	}
+	if len(t.learned) >= maxLearnedPeers && oldest != "" {
+		delete(t.learned, oldest)
+	}
+}
+
+// targets 获取所有发送目标（种子节点 + 未过期的已知对端），同时清理过期对端
+func (t *peerTable) targets() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	seen := make(map[string]bool, len(t.seeds)+len(t.learned))
+	targets := make([]string, 0, len(t.seeds)+len(t.learned))
+	for _, seed := range t.seeds {
+		if !seen[seed] {
+			seen[seed] = true
+			targets = append(targets, seed)
+		}
+	}
+	for addr, entry := range t.learned {
+		if now.Sub(entry.seen) > t.timeout {
+			delete(t.learned, addr)
+			continue
+		}
+		if !seen[addr] {
+			seen[addr] = true
+			targets = append(targets, addr)
+		}
+	}
+	return targets
+}
+
+// shared 获取需要转告其他节点的对端列表（直接收到过消息的对端，最近活跃的优先）
+func (t *peerTable) shared() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	peers := make([]string, 0, len(t.learned))
+	for addr, entry := range t.learned {
+		// 带区域标识的链路本地地址对其他节点没有意义
+		if entry.direct && now.Sub(entry.seen) <= t.timeout && !strings.Contains(addr, "%") {
+			peers = append(peers, addr)
+		}
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		return t.learned[peers[i]].seen.After(t.learned[peers[j]].seen)
+	})
+	if len(peers) > maxSharedPeers {
+		peers = peers[:maxSharedPeers]
+	}
+	return peers
+}
+
+// EnableUnicast 启用单播模式
+// 除组播外，消息还会直接发送给种子节点和已知对端，心跳中携带已知对端列表，
+// 使集群在交换机或无线网络丢弃组播时仍能互相发现；
+// seeds 为 host:port 列表，peerTimeout 为已知对端的过期时间
+func (c *MulticastClient) EnableUnicast(seeds []string, peerTimeout time.Duration) {
+	c.peers = &peerTable{
+		seeds:   seeds,
+		learned: make(map[string]peerEntry),
+		timeout: peerTimeout,
+	}
+}
+
+// Peers 获取当前的单播发送目标，未启用单播模式时为空
+func (c *MulticastClient) Peers() []string {
+	if c.peers == nil {
+		return nil
+	}
+	return c.peers.targets()
+}
+
+// sendUnicast 向所有单播目标发送数据报
+func (c *MulticastClient) sendUnicast(packets [][]byte) error {
+	var errs []error
+	for _, target := range c.peers.targets() {
+		addr, err := net.ResolveUDPAddr("udp", target)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		conn := c.connFor(addr.IP)
+		if conn == nil {
+			continue
+		}
+		if err := writePackets(conn, packets, addr); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// learnPeers 从收到的消息中学习对端
+// 接收未签名消息时不采信其中转告的对端，否则一条伪造的消息就能让所有节点向任意地址发送心跳
+func (c *MulticastClient) learnPeers(src *net.UDPAddr, msg *Message) {
+	c.peers.learn(src.String())
+	if c.codec.AcceptsUnsigned() {
+		return
+	}
+	for _, peer := range msg.Peers {
+		if !c.isLocalPeer(peer) {
+			c.peers.mention(peer)
+		}
+	}
+}
+
+// isLocalPeer 是否为本机地址
+func (c *MulticastClient) isLocalPeer(peer string) bool {
+	host, _, err := net.SplitHostPort(peer)
+	if err != nil {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return true
+	}
+	for _, addr := range c.GetLocalAddresses() {
+		if addr.IP == host {
+			return true
+		}
+	}
+	return false
+}
+
+// connFor 选择与目标地址族匹配的连接
+func (c *MulticastClient) connFor(ip net.IP) *net.UDPConn {
+	v4 := ip.To4() != nil
+	for _, gc := range c.conns {
+		if (gc.group.IP.To4() != nil) == v4 {
+			return gc.conn
+		}
+	}
+	return nil
+}
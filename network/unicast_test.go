@@ -0,0 +1,112 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"testing"
+	"time"
+)
+
+func newTestPeers() *MulticastClient {
+	c := &MulticastClient{codec: &Codec{}}
+	c.EnableUnicast([]string{"10.0.0.1:9527"}, time.Minute)
+	return c
+}
+
+func TestPeerTableMentionDoesNotRefresh(t *testing.T) {
+	c := newTestPeers()
+	c.peers.mention("10.0.0.9:9527")
+
+	c.peers.mu.Lock()
+	stale := time.Now().Add(-2 * time.Minute)
+	c.peers.learned["10.0.0.9:9527"] = peerEntry{seen: stale}
+	c.peers.mu.Unlock()
+
+	// 其他节点反复转告下线的对端不会延长有效期
+	c.peers.mention("10.0.0.9:9527")
+	if slices.Contains(c.peers.targets(), "10.0.0.9:9527") {
+		t.Fatal("转告刷新了已过期的对端")
+	}
+}
+
+func TestPeerTableSharesDirectOnly(t *testing.T) {
+	c := newTestPeers()
+	c.peers.learn("10.0.0.2:9527")
+	c.peers.mention("10.0.0.3:9527")
+
+	shared := c.peers.shared()
+	if !slices.Equal(shared, []string{"10.0.0.2:9527"}) {
+		t.Fatalf("shared = %v", shared)
+	}
+	targets := c.peers.targets()
+	for _, want := range []string{"10.0.0.1:9527", "10.0.0.2:9527", "10.0.0.3:9527"} {
+		if !slices.Contains(targets, want) {
+			t.Errorf("targets 缺少 %s: %v", want, targets)
+		}
+	}
+}
+
+func TestPeerTableLimit(t *testing.T) {
+	c := newTestPeers()
+	for i := 0; i < maxLearnedPeers*2; i++ {
+		c.peers.mention(fmt.Sprintf("10.1.%d.%d:9527", i/250, i%250))
+	}
+	if n := len(c.peers.learned); n != maxLearnedPeers {
+		t.Fatalf("learned = %d, want %d", n, maxLearnedPeers)
+	}
+
+	// 直接收到消息的对端淘汰最旧的记录后加入
+	c.peers.learn("10.0.0.2:9527")
+	if n := len(c.peers.learned); n != maxLearnedPeers {
+		t.Fatalf("learned = %d, want %d", n, maxLearnedPeers)
+	}
+	if _, ok := c.peers.learned["10.0.0.2:9527"]; !ok {
+		t.Fatal("直接收到消息的对端未加入")
+	}
+}
+
+func TestLearnPeersRequiresSignature(t *testing.T) {
+	src := &net.UDPAddr{IP: net.ParseIP("10.0.0.2"), Port: 9527}
+	msg := &Message{Peers: []string{"10.0.0.9:9527"}}
+
+	c := newTestPeers()
+	c.learnPeers(src, msg)
+	if _, ok := c.peers.learned["10.0.0.9:9527"]; ok {
+		t.Fatal("未签名的消息中转告的对端被采信")
+	}
+	if _, ok := c.peers.learned["10.0.0.2:9527"]; !ok {
+		t.Fatal("未记录消息的发送方")
+	}
+
+	c = newTestPeers()
+	c.codec, _ = NewCodec("secret", EncryptionPlain, false)
+	c.learnPeers(src, msg)
+	if _, ok := c.peers.learned["10.0.0.9:9527"]; !ok {
+		t.Fatal("签名消息中转告的对端未记录")
+	}
+}
+
+func TestSendSharesPeersOnlyWhenSigned(t *testing.T) {
+	c := newTestPeers()
+	c.EnableUnicast(nil, time.Minute)
+	c.peers.learn("10.0.0.2:9527")
+
+	// 未签名时接收方不会采纳转告的对端，心跳中不携带
+	msg := &Message{Action: ActionHeartbeat}
+	if err := c.Send(msg); err != nil {
+		t.Fatal(err)
+	}
+	if len(msg.Peers) != 0 {
+		t.Fatalf("未签名的心跳携带了对端: %v", msg.Peers)
+	}
+
+	c.codec, _ = NewCodec("secret", EncryptionPlain, false)
+	msg = &Message{Action: ActionHeartbeat}
+	if err := c.Send(msg); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(msg.Peers, []string{"10.0.0.2:9527"}) {
+		t.Fatalf("签名的心跳携带的对端 = %v", msg.Peers)
+	}
+}
@@ -0,0 +1,109 @@
+package network
+
+import (
+	"time"
+)
+
+// changeDebounce 网络变化事件的合并窗口
+// DHCP 续租、漫游等操作通常会在短时间内产生多个删除/添加地址事件
+const changeDebounce = 500 * time.Millisecond
+
+// NetworkWatcher 本机网络变化监听器
+// 网卡启停或地址变化时刷新客户端的本机地址并重新加入组播组。
+// Linux 下监听 netlink 事件，其他平台或 netlink 不可用时定期轮询
+type NetworkWatcher struct {
+	client       *MulticastClient
+	pollInterval time.Duration
+	onChange     func() // 本机地址变化回调
+	stop         chan struct{}
+}
+
+// NewNetworkWatcher 创建网络变化监听器，pollInterval 为轮询间隔（无法订阅系统事件时使用）
+func NewNetworkWatcher(client *MulticastClient, pollInterval time.Duration) *NetworkWatcher {
+	return &NetworkWatcher{
+		client:       client,
+		pollInterval: pollInterval,
+		stop:         make(chan struct{}),
+	}
+}
+
+// SetChangeCallback 设置本机地址变化回调
+func (w *NetworkWatcher) SetChangeCallback(callback func()) {
+	w.onChange = callback
+}
+
+// Start 启动监听，返回是否使用系统事件（false 表示轮询）
+func (w *NetworkWatcher) Start() bool {
+	events, err := subscribeChanges(w.stop)
+	if err != nil {
+		go w.poll()
+		return false
+	}
+	go w.watch(events)
+	return true
+}
+
+// Stop 停止监听
+func (w *NetworkWatcher) Stop() {
+	close(w.stop)
+}
+
+// watch 处理系统网络变化事件，事件源异常关闭后改为轮询
+func (w *NetworkWatcher) watch(events <-chan struct{}) {
+	for events != nil {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				events = nil
+			}
+		case <-w.stop:
+			return
+		}
+
+		// 合并短时间内的连续事件
+		timer := time.NewTimer(changeDebounce)
+	drain:
+		for events != nil {
+			select {
+			case _, ok := <-events:
+				if !ok {
+					events = nil
+				}
+			case <-timer.C:
+				break drain
+			case <-w.stop:
+				timer.Stop()
+				return
+			}
+		}
+		timer.Stop()
+		w.refresh()
+	}
+	w.poll()
+}
+
+// poll 定期轮询本机地址
+func (w *NetworkWatcher) poll() {
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.refresh()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// refresh 刷新本机地址，变化时触发回调
+func (w *NetworkWatcher) refresh() {
+	changed, err := w.client.Refresh()
+	if err != nil || !changed {
+		return
+	}
+	if w.onChange != nil {
+		w.onChange()
+	}
+}
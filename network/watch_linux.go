@@ -0,0 +1,67 @@
+//go:build linux
+
+package network
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// subscribeChanges 通过 netlink 订阅网卡和地址变化事件
+func subscribeChanges(stop <-chan struct{}) (<-chan struct{}, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_ROUTE)
+	if err != nil {
+		return nil, fmt.Errorf("创建 netlink 套接字失败: %v", err)
+	}
+
+	addr := &unix.SockaddrNetlink{
+		Family: unix.AF_NETLINK,
+		Groups: unix.RTMGRP_LINK | unix.RTMGRP_IPV4_IFADDR | unix.RTMGRP_IPV6_IFADDR,
+	}
+	if err := unix.Bind(fd, addr); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("订阅 netlink 事件失败: %v", err)
+	}
+
+	// 设置接收超时，以便定期检查是否已停止
+	timeout := unix.NsecToTimeval(int64(time.Second))
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &timeout); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("设置 netlink 超时失败: %v", err)
+	}
+
+	events := make(chan struct{}, 1)
+	go func() {
+		defer close(events)
+		defer unix.Close(fd)
+		buffer := make([]byte, 64*1024)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			n, _, err := unix.Recvfrom(fd, buffer, 0)
+			if err != nil {
+				if err == unix.EAGAIN || err == unix.EINTR {
+					continue
+				}
+				if err != unix.ENOBUFS {
+					// 套接字异常，停止订阅（ENOBUFS 表示事件过多溢出，仍需刷新）
+					return
+				}
+			} else if n == 0 {
+				continue
+			}
+
+			select {
+			case events <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return events, nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package network
+
+import "errors"
+
+// subscribeChanges 非 Linux 平台暂不支持订阅网络变化事件，使用轮询
+func subscribeChanges(stop <-chan struct{}) (<-chan struct{}, error) {
+	return nil, errors.New("当前平台不支持网络变化事件")
+}
@@ -0,0 +1,169 @@
+package node
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Prober 探测消息发送接口，由上层基于网络层实现
+type Prober interface {
+	// Ping 直接探测目标节点
+	Ping(target *Node, probeID uint64) error
+	// PingReq 请求 via 节点代为探测目标节点
+	PingReq(via, target *Node, probeID uint64) error
+	// Suspect 向集群通告目标节点疑似离线
+	Suspect(target *Node) error
+}
+
+// Detector SWIM 风格的故障检测器
+// 每个探测周期轮流选择一个节点直接探测，超时未应答则请求其他节点间接探测，
+// 仍未应答则将节点标记为疑似离线并通告集群，由节点自行反驳或超时后判定离线
+type Detector struct {
+	manager        *Manager
+	prober         Prober
+	period         time.Duration // 探测周期
+	probeTimeout   time.Duration // 直接探测超时
+	indirectProbes int           // 间接探测的节点数
+
+	mu      sync.Mutex
+	pending map[uint64]chan struct{} // key: probeID，等待中的探测
+	queue   []string                 // 本轮待探测的节点
+	nextID  atomic.Uint64
+	stop    chan struct{}
+}
+
+// NewDetector 创建故障检测器
+func NewDetector(manager *Manager, prober Prober, period time.Duration, indirectProbes int) *Detector {
+	return &Detector{
+		manager:        manager,
+		prober:         prober,
+		period:         period,
+		probeTimeout:   period / 3,
+		indirectProbes: indirectProbes,
+		pending:        make(map[uint64]chan struct{}),
+		stop:           make(chan struct{}),
+	}
+}
+
+// Start 启动探测循环
+func (d *Detector) Start() {
+	go d.loop()
+}
+
+// Stop 停止探测循环
+func (d *Detector) Stop() {
+	close(d.stop)
+}
+
+// HandleAck 处理探测应答，deviceID 为应答的目标节点
+func (d *Detector) HandleAck(probeID uint64, deviceID string) {
+	d.manager.Touch(deviceID)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if ack, ok := d.pending[probeID]; ok {
+		close(ack)
+		delete(d.pending, probeID)
+	}
+}
+
+// loop 探测循环
+func (d *Detector) loop() {
+	ticker := time.NewTicker(d.period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if target := d.next(); target != nil {
+				d.probe(target)
+			}
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// probe 探测一个节点
+func (d *Detector) probe(target *Node) {
+	id := d.nextID.Add(1)
+	ack := make(chan struct{})
+	d.mu.Lock()
+	d.pending[id] = ack
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		delete(d.pending, id)
+		d.mu.Unlock()
+	}()
+
+	// 1. 直接探测
+	if err := d.prober.Ping(target, id); err == nil {
+		select {
+		case <-ack:
+			return
+		case <-time.After(d.probeTimeout):
+		case <-d.stop:
+			return
+		}
+	}
+
+	// 2. 间接探测
+	for _, via := range d.helpers(target) {
+		d.prober.PingReq(via, target, id)
+	}
+	select {
+	case <-ack:
+		return
+	case <-time.After(d.period - d.probeTimeout):
+	case <-d.stop:
+		return
+	}
+
+	// 3. 标记疑似离线并通告
+	if d.manager.Suspect(target.DeviceID, target.Incarnation) {
+		d.prober.Suspect(target)
+	}
+}
+
+// next 选择下一个探测目标
+// 每轮将所有节点随机排序后依次探测，保证每个节点在有限时间内被探测到
+func (d *Detector) next() *Node {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for attempt := 0; attempt < 2; attempt++ {
+		for len(d.queue) > 0 {
+			deviceID := d.queue[0]
+			d.queue = d.queue[1:]
+			if n, ok := d.manager.Get(deviceID); ok && !n.IsLocal && n.IsOnline() {
+				return n
+			}
+		}
+
+		// 开始新一轮
+		nodes := d.manager.Probeable()
+		rand.Shuffle(len(nodes), func(i, j int) { nodes[i], nodes[j] = nodes[j], nodes[i] })
+		for _, n := range nodes {
+			d.queue = append(d.queue, n.DeviceID)
+		}
+	}
+	return nil
+}
+
+// helpers 随机选择协助间接探测的节点（排除目标本身和疑似离线的节点）
+func (d *Detector) helpers(target *Node) []*Node {
+	var candidates []*Node
+	for _, n := range d.manager.Probeable() {
+		if n.DeviceID != target.DeviceID && n.State == StateAlive {
+			candidates = append(candidates, n)
+		}
+	}
+	rand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+	if len(candidates) > d.indirectProbes {
+		candidates = candidates[:d.indirectProbes]
+	}
+	return candidates
+}
@@ -0,0 +1,57 @@
+package node
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// maxDomainLength 域名的最大长度
+	maxDomainLength = 253
+	// maxDomainLabelLength 域名中每一段的最大长度
+	maxDomainLabelLength = 63
+)
+
+// ValidateDomain 校验节点域名：必须是 suffix 下的 RFC 1123 主机名，suffix 为空时只校验主机名
+// 域名来自其他节点的消息，会写入 hosts 文件和 DNS 服务的配置，
+// 其他字符（如换行、引号、逗号）可能注入配置，后缀以外的域名可能劫持公网域名
+func ValidateDomain(domain, suffix string) error {
+	if len(domain) > maxDomainLength {
+		return fmt.Errorf("域名长度不能超过 %d 个字符", maxDomainLength)
+	}
+	if suffix = strings.Trim(suffix, "."); suffix != "" {
+		if name, ok := cutSuffixFold(domain, "."+suffix); !ok || name == "" {
+			return fmt.Errorf("域名不在 %s 下: %q", suffix, domain)
+		}
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if err := validateDomainLabel(label); err != nil {
+			return fmt.Errorf("无效的域名 %q: %v", domain, err)
+		}
+	}
+	return nil
+}
+
+// validateDomainLabel 每一段为 1~63 个字母、数字或 -，不能以 - 开头或结尾
+func validateDomainLabel(label string) error {
+	if label == "" || len(label) > maxDomainLabelLength {
+		return fmt.Errorf("每一段的长度必须为 1~%d 个字符", maxDomainLabelLength)
+	}
+	if label[0] == '-' || label[len(label)-1] == '-' {
+		return fmt.Errorf("不能以 - 开头或结尾")
+	}
+	for _, r := range label {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '-' {
+			return fmt.Errorf("只能包含字母、数字和 -")
+		}
+	}
+	return nil
+}
+
+// cutSuffixFold 不区分大小写地去掉后缀
+func cutSuffixFold(s, suffix string) (string, bool) {
+	if len(s) < len(suffix) || !strings.EqualFold(s[len(s)-len(suffix):], suffix) {
+		return s, false
+	}
+	return s[:len(s)-len(suffix)], true
+}
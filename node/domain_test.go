@@ -0,0 +1,52 @@
+package node
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateDomain(t *testing.T) {
+	valid := []string{
+		"pc.coobee.local",
+		"PC-01.Coobee.Local",
+		"a.b.coobee.local",
+		"pc-334402.coobee.local",
+		strings.Repeat("a", 63) + ".coobee.local",
+	}
+	for _, domain := range valid {
+		if err := ValidateDomain(domain, "coobee.local"); err != nil {
+			t.Errorf("ValidateDomain(%q): %v", domain, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"coobee.local",
+		".coobee.local",
+		"pc..coobee.local",
+		"-pc.coobee.local",
+		"pc-.coobee.local",
+		"pc_1.coobee.local",
+		"pc.coobee.local.evil.com",
+		"www.example.com",
+		"pccoobee.local",
+		"x\ndhcp-script=/tmp/p.coobee.local",
+		"x\".coobee.local",
+		"a,b.coobee.local",
+		strings.Repeat("a", 64) + ".coobee.local",
+		strings.Repeat("a.", 125) + "coobee.local",
+	}
+	for _, domain := range invalid {
+		if err := ValidateDomain(domain, "coobee.local"); err == nil {
+			t.Errorf("ValidateDomain(%q) 应返回错误", domain)
+		}
+	}
+
+	// 没有后缀时只校验主机名
+	if err := ValidateDomain("pc", ""); err != nil {
+		t.Errorf("ValidateDomain(pc): %v", err)
+	}
+	if err := ValidateDomain("pc\n", ""); err == nil {
+		t.Error("ValidateDomain(pc\\n) 应返回错误")
+	}
+}
@@ -0,0 +1,167 @@
+package node
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxLabelLength 标签键和值的最大长度
+const maxLabelLength = 63
+
+// requirement 选择器中的单个条件
+type requirement struct {
+	key   string
+	value string
+	op    string // =、!=、exists、!exists
+}
+
+// Selector 标签选择器，多个条件之间为“与”关系
+// 语法：key=value、key!=value、key（存在）、!key（不存在），用逗号分隔，如 role=build-agent,env!=prod
+type Selector []requirement
+
+// ParseSelector 解析标签选择器，空字符串匹配全部节点
+func ParseSelector(expr string) (Selector, error) {
+	var selector Selector
+	for _, part := range strings.Split(expr, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		var req requirement
+		switch {
+		case strings.Contains(part, "!="):
+			req.key, req.value, _ = strings.Cut(part, "!=")
+			req.op = "!="
+		case strings.Contains(part, "="):
+			req.key, req.value, _ = strings.Cut(part, "=")
+			req.value = strings.TrimPrefix(req.value, "=") // 兼容 key==value
+			req.op = "="
+		case strings.HasPrefix(part, "!"):
+			req.key = part[1:]
+			req.op = "!exists"
+		default:
+			req.key = part
+			req.op = "exists"
+		}
+		req.key, req.value = strings.TrimSpace(req.key), strings.TrimSpace(req.value)
+
+		if err := validateLabel(req.key, req.value); err != nil {
+			return nil, fmt.Errorf("无效的选择器 %q: %v", part, err)
+		}
+		selector = append(selector, req)
+	}
+	return selector, nil
+}
+
+// Matches 标签是否满足全部条件
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, req := range s {
+		value, exists := labels[req.key]
+		switch req.op {
+		case "=":
+			if !exists || value != req.value {
+				return false
+			}
+		case "!=":
+			if exists && value == req.value {
+				return false
+			}
+		case "exists":
+			if !exists {
+				return false
+			}
+		case "!exists":
+			if exists {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Empty 是否为空选择器（匹配全部节点）
+func (s Selector) Empty() bool {
+	return len(s) == 0
+}
+
+// String 选择器的文本形式
+func (s Selector) String() string {
+	parts := make([]string, 0, len(s))
+	for _, req := range s {
+		switch req.op {
+		case "exists":
+			parts = append(parts, req.key)
+		case "!exists":
+			parts = append(parts, "!"+req.key)
+		default:
+			parts = append(parts, req.key+req.op+req.value)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// ValidateLabels 校验标签的键和值
+func ValidateLabels(labels map[string]string) error {
+	for key, value := range labels {
+		if err := validateLabel(key, value); err != nil {
+			return fmt.Errorf("无效的标签 %s=%s: %v", key, value, err)
+		}
+	}
+	return nil
+}
+
+// FilterLabels 返回通过校验的标签和被丢弃的无效标签数，全部有效时返回原标签
+func FilterLabels(labels map[string]string) (map[string]string, int) {
+	dropped := 0
+	for key, value := range labels {
+		if validateLabel(key, value) != nil {
+			dropped++
+		}
+	}
+	if dropped == 0 {
+		return labels, 0
+	}
+
+	valid := make(map[string]string, len(labels)-dropped)
+	for key, value := range labels {
+		if validateLabel(key, value) == nil {
+			valid[key] = value
+		}
+	}
+	return valid, dropped
+}
+
+// FormatLabels 按键排序格式化标签，如 env=dev,team=backend
+func FormatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, key+"="+labels[key])
+	}
+	return strings.Join(parts, ",")
+}
+
+// validateLabel 键不能为空，键和值只能包含字母、数字和 - _ . /
+func validateLabel(key, value string) error {
+	if key == "" {
+		return fmt.Errorf("标签键不能为空")
+	}
+	for _, s := range []string{key, value} {
+		if len(s) > maxLabelLength {
+			return fmt.Errorf("长度不能超过 %d 个字符", maxLabelLength)
+		}
+		for _, r := range s {
+			if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') && !strings.ContainsRune("-_./", r) {
+				return fmt.Errorf("包含不支持的字符 %q", r)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package node
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string // 解析后的文本形式
+		ok   bool
+	}{
+		{"", "", true},
+		{" , ", "", true},
+		{"env=dev", "env=dev", true},
+		{"env==dev", "env=dev", true},
+		{" env = dev , role!=db ", "env=dev,role!=db", true},
+		{"gpu", "gpu", true},
+		{"!gpu", "!gpu", true},
+		{"team=", "team=", true},
+		{"example.com/role=build-agent", "example.com/role=build-agent", true},
+		{"=dev", "", false},
+		{"!=dev", "", false},
+		{"!", "", false},
+		{"env=d ev", "", false},
+		{"env=dev;rm", "", false},
+		{"env=" + strings.Repeat("a", maxLabelLength+1), "", false},
+	}
+	for _, tt := range tests {
+		selector, err := ParseSelector(tt.expr)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseSelector(%q) err = %v，期望成功 = %v", tt.expr, err, tt.ok)
+			continue
+		}
+		if got := selector.String(); got != tt.want {
+			t.Errorf("ParseSelector(%q) = %q，期望 %q", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestSelectorMatches(t *testing.T) {
+	labels := map[string]string{"env": "dev", "role": "build-agent", "gpu": ""}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"", true},
+		{"env=dev", true},
+		{"env=prod", false},
+		{"env!=prod", true},
+		{"env!=dev", false},
+		{"missing!=x", true},
+		{"gpu", true},
+		{"missing", false},
+		{"!missing", true},
+		{"!gpu", false},
+		{"env=dev,role=build-agent", true},
+		{"env=dev,role=db", false},
+		{"missing=", false},
+		{"gpu=", true},
+	}
+	for _, tt := range tests {
+		selector, err := ParseSelector(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseSelector(%q): %v", tt.expr, err)
+		}
+		if got := selector.Matches(labels); got != tt.want {
+			t.Errorf("%q.Matches = %v，期望 %v", tt.expr, got, tt.want)
+		}
+	}
+
+	empty, _ := ParseSelector("")
+	if !empty.Empty() || !empty.Matches(nil) {
+		t.Error("空选择器应匹配全部节点")
+	}
+}
+
+func TestFilterLabels(t *testing.T) {
+	labels := map[string]string{"env": "dev", "bad key": "x", "role": "a,b=c", "": "empty"}
+	valid, dropped := FilterLabels(labels)
+	if dropped != 3 || len(valid) != 1 || valid["env"] != "dev" {
+		t.Fatalf("FilterLabels = %v, %d，期望只保留 env=dev", valid, dropped)
+	}
+	if ValidateLabels(valid) != nil || ValidateLabels(labels) == nil {
+		t.Error("ValidateLabels 与 FilterLabels 的结果不一致")
+	}
+
+	if valid, dropped := FilterLabels(map[string]string{"env": "dev"}); dropped != 0 || len(valid) != 1 {
+		t.Fatalf("有效标签被丢弃: %v, %d", valid, dropped)
+	}
+	if valid, dropped := FilterLabels(nil); dropped != 0 || valid != nil {
+		t.Fatalf("FilterLabels(nil) = %v, %d", valid, dropped)
+	}
+}
+
+func TestFormatLabels(t *testing.T) {
+	if got := FormatLabels(map[string]string{"team": "backend", "env": "dev"}); got != "env=dev,team=backend" {
+		t.Errorf("FormatLabels = %q", got)
+	}
+	if got := FormatLabels(nil); got != "" {
+		t.Errorf("FormatLabels(nil) = %q", got)
+	}
+}
@@ -1,27 +1,94 @@
 package node
 
 import (
+	"errors"
+	"maps"
+	"net"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/618lf/lanlink/network"
+)
+
+// 消息校验错误
+var (
+	ErrStaleMessage     = errors.New("消息时间戳超出允许的时钟偏差")
+	ErrDuplicateMessage = errors.New("消息序号重复或过期")
+)
+
+// State 节点状态
+type State string
+
+const (
+	StateAlive   State = "alive"   // 在线
+	StateSuspect State = "suspect" // 疑似离线（仍视为在线，不修改 hosts）
+	StateDead    State = "dead"    // 离线
 )
 
 // Node 节点信息
 type Node struct {
-	DeviceID  string    // 设备ID（MAC地址）
-	Domain    string    // 域名
-	IP        string    // IP地址（真实IP）
-	Hostname  string    // 主机名
-	LastSeen  time.Time // 最后心跳时间
-	IsLocal   bool      // 是否是本机节点
-	IsOnline  bool      // 是否在线
+	DeviceID     string            // 设备ID（MAC地址）
+	Domain       string            // 域名
+	IP           string            // IP地址（真实IP）
+	IPv6         string            // IPv6地址（可选）
+	Addrs        []network.Address // 节点上报的全部地址
+	Hostname     string            // 主机名
+	LastSeen     time.Time         // 最后心跳时间
+	Interval     time.Duration     // 节点上报的心跳间隔
+	IsLocal      bool              // 是否是本机节点
+	State        State             // 节点状态
+	Incarnation  uint64            // 节点化身号，节点反驳疑似离线时递增
+	SuspectSince time.Time         // 进入疑似离线状态的时间
+	Services     []network.Service // 节点提供的服务
+	Labels       map[string]string // 节点标签
+	ReadOnly     bool              // 从 mDNS 导入的只读节点（非 LanLink 设备），只能通过 Import 更新
+}
+
+// IsOnline 是否在线（疑似离线也视为在线）
+func (n *Node) IsOnline() bool {
+	return n.State != StateDead
+}
+
+// HasAddress 节点是否使用该地址（IP 或 IPv6）
+// 上报的其他地址未经本机验证，对端可以任意声明，不用于按地址查找节点
+func (n *Node) HasAddress(ip net.IP) bool {
+	for _, addr := range []string{n.IP, n.IPv6} {
+		if ip.Equal(net.ParseIP(addr)) {
+			return true
+		}
+	}
+	return false
+}
+
+// snapshot 复制节点，供管理器外部读取（节点字段只在持有锁时修改）
+func (n *Node) snapshot() *Node {
+	copied := *n
+	return &copied
 }
 
 // Manager 节点管理器
 type Manager struct {
-	mu             sync.RWMutex
-	nodes          map[string]*Node // key: deviceID
-	offlineTimeout time.Duration
-	onNodeChange   func(*Node, bool) // 节点变化回调：(node, isOnline)
+	mu               sync.RWMutex
+	nodes            map[string]*Node   // key: deviceID
+	offlineTimeout   time.Duration      // 心跳超时后进入疑似离线
+	baseInterval     time.Duration      // 基础心跳间隔，用于按节点上报的间隔放大超时
+	suspicionTimeout time.Duration      // 疑似离线超时后判定离线
+	onNodeChange     func(*Node, bool)  // 节点变化回调：(node, isOnline)
+	onStateChange    func(*Node, State) // 状态变化回调：(node, 原状态)
+
+	// 防重放
+	lastSeq     map[string]seqRecord // key: deviceID
+	clockSkew   time.Duration        // 允许的时钟偏差，0 表示不检查时间戳
+	unsequenced bool                 // 是否接收不带序号的消息（旧版本节点）
+	pruned      time.Time            // 上次清理 lastSeq 的时间
+	rejected    uint64               // 被拒绝的消息数
+}
+
+// seqRecord 已接受的最大序号和最后一次收到消息的时间
+type seqRecord struct {
+	seq  uint64
+	seen time.Time
 }
 
 // NewManager 创建节点管理器
@@ -29,34 +96,137 @@ func NewManager(offlineTimeout time.Duration) *Manager {
 	return &Manager{
 		nodes:          make(map[string]*Node),
 		offlineTimeout: offlineTimeout,
+		lastSeq:        make(map[string]seqRecord),
 	}
 }
 
 // SetChangeCallback 设置节点变化回调
+// 仅在节点上线、离线或地址/域名变化时触发，alive 与 suspect 之间的切换不触发
 func (m *Manager) SetChangeCallback(callback func(*Node, bool)) {
 	m.onNodeChange = callback
 }
 
-// AddOrUpdate 添加或更新节点
-func (m *Manager) AddOrUpdate(deviceID, domain, ip, hostname string) bool {
+// SetStateCallback 设置状态变化回调（包括 alive/suspect/dead 之间的所有切换）
+func (m *Manager) SetStateCallback(callback func(*Node, State)) {
+	m.onStateChange = callback
+}
+
+// SetHeartbeatInterval 设置基础心跳间隔
+// 节点上报的心跳间隔大于基础间隔时，心跳超时按相同比例放大
+func (m *Manager) SetHeartbeatInterval(base time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.baseInterval = base
+}
+
+// SetSuspicionTimeout 设置疑似离线超时，超时仍无存活证据则判定离线
+func (m *Manager) SetSuspicionTimeout(timeout time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.suspicionTimeout = timeout
+}
+
+// SetClockSkew 设置允许的时钟偏差
+func (m *Manager) SetClockSkew(skew time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clockSkew = skew
+}
+
+// SetAcceptUnsequenced 设置是否接收不带序号的消息
+// 旧版本节点不携带序号，只应在接收未签名消息（未配置密钥或迁移期间）时开启
+func (m *Manager) SetAcceptUnsequenced(accept bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.unsequenced = accept
+}
+
+// Validate 校验消息的时间戳和序号，拒绝过期或重复的消息
+// seq 为 0 表示旧版本节点未携带序号，开启 SetAcceptUnsequenced 时仅校验时间戳
+func (m *Manager) Validate(deviceID string, seq uint64, timestamp int64) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	node, exists := m.nodes[deviceID]
 	now := time.Now()
+	if m.clockSkew > 0 {
+		diff := now.Sub(time.Unix(timestamp, 0))
+		if diff > m.clockSkew || diff < -m.clockSkew {
+			m.rejected++
+			return ErrStaleMessage
+		}
+		m.pruneSeq(now)
+	}
 
+	if seq == 0 {
+		if m.unsequenced {
+			return nil
+		}
+		m.rejected++
+		return ErrDuplicateMessage
+	}
+	if seq <= m.lastSeq[deviceID].seq {
+		m.rejected++
+		return ErrDuplicateMessage
+	}
+	m.lastSeq[deviceID] = seqRecord{seq: seq, seen: now}
+	return nil
+}
+
+// pruneSeq 清理长时间没有消息的序号记录，调用方需持有锁
+// 最后一条消息的时间戳最多比本机时间快 clockSkew，超过两倍 clockSkew 后
+// 序号不大于它的消息都会因时间戳过期被拒绝，记录不再需要
+func (m *Manager) pruneSeq(now time.Time) {
+	if now.Sub(m.pruned) < m.clockSkew {
+		return
+	}
+	m.pruned = now
+	for deviceID, record := range m.lastSeq {
+		if now.Sub(record.seen) > 2*m.clockSkew {
+			delete(m.lastSeq, deviceID)
+		}
+	}
+}
+
+// RejectedCount 获取被拒绝的消息数
+func (m *Manager) RejectedCount() uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.rejected
+}
+
+// AddOrUpdate 添加或更新节点（收到节点本身发出的消息，视为存活证据）
+// info 中的 DeviceID、Domain、IP、IPv6、Addrs、Hostname、Interval、Incarnation、Services、Labels 为节点上报的信息
+// IP 应为已按本机网段选择过的可达地址，Addrs 和 Services 变化本身不触发回调，
+// Labels 变化会触发回调（标签决定节点是否写入 hosts）
+func (m *Manager) AddOrUpdate(info *Node) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, exists := m.nodes[info.DeviceID]
+	now := time.Now()
+
+	if exists && node.ReadOnly {
+		// 只读节点不接受集群消息的修改
+		return false
+	}
 	if !exists {
 		// 新节点
 		node = &Node{
-			DeviceID: deviceID,
-			Domain:   domain,
-			IP:       ip,
-			Hostname: hostname,
-			LastSeen: now,
-			IsLocal:  false,
-			IsOnline: true,
+			DeviceID:    info.DeviceID,
+			Domain:      info.Domain,
+			IP:          info.IP,
+			IPv6:        info.IPv6,
+			Addrs:       info.Addrs,
+			Hostname:    info.Hostname,
+			LastSeen:    now,
+			Interval:    info.Interval,
+			IsLocal:     false,
+			State:       StateAlive,
+			Incarnation: info.Incarnation,
+			Services:    info.Services,
+			Labels:      info.Labels,
 		}
-		m.nodes[deviceID] = node
+		m.nodes[info.DeviceID] = node
 
 		// 触发回调
 		if m.onNodeChange != nil {
@@ -66,24 +236,38 @@ func (m *Manager) AddOrUpdate(deviceID, domain, ip, hostname string) bool {
 	}
 
 	// 检查是否从离线恢复上线
-	wasOffline := !node.IsOnline
+	wasOffline := !node.IsOnline()
 
 	// 更新现有节点
 	changed := false
-	if node.IP != ip {
-		node.IP = ip
+	if node.IP != info.IP {
+		node.IP = info.IP
 		changed = true
 	}
-	if node.Domain != domain {
-		node.Domain = domain
+	if node.IPv6 != info.IPv6 {
+		node.IPv6 = info.IPv6
 		changed = true
 	}
-	if node.Hostname != hostname {
-		node.Hostname = hostname
+	if node.Domain != info.Domain {
+		node.Domain = info.Domain
 		changed = true
 	}
+	if node.Hostname != info.Hostname {
+		node.Hostname = info.Hostname
+		changed = true
+	}
+	if !maps.Equal(node.Labels, info.Labels) {
+		node.Labels = info.Labels
+		changed = true
+	}
+	node.Addrs = info.Addrs
+	node.Services = info.Services
+	node.Interval = info.Interval
 	node.LastSeen = now
-	node.IsOnline = true
+	if info.Incarnation > node.Incarnation {
+		node.Incarnation = info.Incarnation
+	}
+	m.setState(node, StateAlive)
 
 	// 如果IP或域名变化，或从离线恢复上线，触发回调
 	if (changed || wasOffline) && m.onNodeChange != nil {
@@ -93,17 +277,120 @@ func (m *Manager) AddOrUpdate(deviceID, domain, ip, hostname string) bool {
 	return changed || wasOffline
 }
 
-// MarkOffline 标记节点离线（不删除）
+// Import 导入或刷新只读节点（如通过 mDNS 发现的非 LanLink 设备）
+// info.Interval 为记录的有效期，到期未刷新即进入疑似离线；与 LanLink 节点的 DeviceID 相同时忽略
+func (m *Manager) Import(info *Node) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, exists := m.nodes[info.DeviceID]
+	if exists && !node.ReadOnly {
+		return false
+	}
+	if !exists {
+		node = &Node{
+			DeviceID: info.DeviceID,
+			Domain:   info.Domain,
+			IP:       info.IP,
+			IPv6:     info.IPv6,
+			Hostname: info.Hostname,
+			LastSeen: time.Now(),
+			Interval: info.Interval,
+			State:    StateAlive,
+			ReadOnly: true,
+		}
+		m.nodes[info.DeviceID] = node
+		if m.onNodeChange != nil {
+			m.onNodeChange(node, true)
+		}
+		return true
+	}
+
+	wasOffline := !node.IsOnline()
+	changed := node.IP != info.IP || node.IPv6 != info.IPv6 || node.Domain != info.Domain
+	node.IP, node.IPv6, node.Domain = info.IP, info.IPv6, info.Domain
+	node.Hostname = info.Hostname
+	node.Interval = info.Interval
+	node.LastSeen = time.Now()
+	m.setState(node, StateAlive)
+
+	if (changed || wasOffline) && m.onNodeChange != nil {
+		m.onNodeChange(node, true)
+	}
+	return changed || wasOffline
+}
+
+// Touch 收到节点的探测应答，刷新最后活跃时间并清除疑似离线状态
+// 已离线的节点需要通过心跳重新上线
+func (m *Manager) Touch(deviceID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, exists := m.nodes[deviceID]
+	if !exists || !node.IsOnline() || node.ReadOnly {
+		return
+	}
+	node.LastSeen = time.Now()
+	m.setState(node, StateAlive)
+}
+
+// Suspect 标记节点疑似离线（探测失败或收到其他节点的怀疑通告）
+// incarnation 小于节点当前化身号的怀疑已被节点反驳，忽略；返回状态是否变化
+func (m *Manager) Suspect(deviceID string, incarnation uint64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, exists := m.nodes[deviceID]
+	if !exists || node.IsLocal || node.ReadOnly || node.State != StateAlive || incarnation < node.Incarnation {
+		return false
+	}
+	node.Incarnation = incarnation
+	node.SuspectSince = time.Now()
+	m.setState(node, StateSuspect)
+	return true
+}
+
+// Refute 反驳针对本机的怀疑，递增本机化身号并返回新值
+func (m *Manager) Refute(incarnation uint64) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, node := range m.nodes {
+		if node.IsLocal {
+			if incarnation > node.Incarnation {
+				node.Incarnation = incarnation
+			}
+			node.Incarnation++
+			return node.Incarnation
+		}
+	}
+	return incarnation + 1
+}
+
+// LocalIncarnation 获取本机化身号
+func (m *Manager) LocalIncarnation() uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, node := range m.nodes {
+		if node.IsLocal {
+			return node.Incarnation
+		}
+	}
+	return 0
+}
+
+// MarkOffline 标记节点离线（不删除），只读节点只会因记录过期而离线
 func (m *Manager) MarkOffline(deviceID string) *Node {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	node, exists := m.nodes[deviceID]
-	if !exists || !node.IsOnline {
+	if !exists || !node.IsOnline() || node.ReadOnly {
 		return nil
 	}
 
-	node.IsOnline = false
+	m.setState(node, StateDead)
 
 	// 触发回调
 	if m.onNodeChange != nil {
@@ -124,35 +411,80 @@ func (m *Manager) Remove(deviceID string) *Node {
 	}
 
 	// 如果节点还在线，先触发离线回调
-	if node.IsOnline && m.onNodeChange != nil {
-		node.IsOnline = false
+	if node.IsOnline() && m.onNodeChange != nil {
+		m.setState(node, StateDead)
 		m.onNodeChange(node, false)
 	}
 
 	delete(m.nodes, deviceID)
+	delete(m.lastSeq, deviceID)
 	return node
 }
 
-// Get 获取节点
+// Get 获取节点（返回快照，修改不影响管理器中的节点）
 func (m *Manager) Get(deviceID string) (*Node, bool) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	node, exists := m.nodes[deviceID]
-	return node, exists
+	if !exists {
+		return nil, false
+	}
+	return node.snapshot(), true
 }
 
-// GetAll 获取所有节点
+// GetAll 获取所有节点（快照）
 func (m *Manager) GetAll() []*Node {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	nodes := make([]*Node, 0, len(m.nodes))
 	for _, node := range m.nodes {
-		nodes = append(nodes, node)
+		nodes = append(nodes, node.snapshot())
 	}
 	return nodes
 }
 
+// FindByDomain 按域名查找节点（不区分大小写，返回快照）
+// 多个节点使用同一域名时优先返回在线节点
+func (m *Manager) FindByDomain(domain string) (*Node, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var found *Node
+	for _, node := range m.nodes {
+		if !strings.EqualFold(node.Domain, domain) {
+			continue
+		}
+		if found == nil || (!found.IsOnline() && node.IsOnline()) {
+			found = node
+		}
+	}
+	if found == nil {
+		return nil, false
+	}
+	return found.snapshot(), true
+}
+
+// FindByAddress 按地址查找节点（返回快照），多个节点持有同一地址时优先返回在线节点
+func (m *Manager) FindByAddress(ip net.IP) (*Node, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var found *Node
+	for _, node := range m.nodes {
+		if !node.HasAddress(ip) {
+			continue
+		}
+		if found == nil || (!found.IsOnline() && node.IsOnline()) {
+			found = node
+		}
+	}
+	if found == nil {
+		return nil, false
+	}
+	return found.snapshot(), true
+}
+
 // GetOnlineCount 获取在线节点数量
 func (m *Manager) GetOnlineCount() int {
 	m.mu.RLock()
@@ -160,7 +492,7 @@ func (m *Manager) GetOnlineCount() int {
 
 	count := 0
 	for _, node := range m.nodes {
-		if node.IsOnline {
+		if node.IsOnline() {
 			count++
 		}
 	}
@@ -168,6 +500,8 @@ func (m *Manager) GetOnlineCount() int {
 }
 
 // CheckOffline 检查离线节点（标记为离线而不是删除）
+// 心跳超时的节点先进入疑似离线状态，疑似离线超时后才判定离线，
+// 期间收到心跳或探测应答即恢复，避免网络丢包导致节点反复上下线
 func (m *Manager) CheckOffline() []*Node {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -176,19 +510,29 @@ func (m *Manager) CheckOffline() []*Node {
 	offlineNodes := make([]*Node, 0)
 
 	for _, node := range m.nodes {
-		// 跳过本机节点和已离线节点
-		if node.IsLocal || !node.IsOnline {
+		// 跳过本机节点
+		if node.IsLocal {
 			continue
 		}
 
-		// 检查是否超时
-		if now.Sub(node.LastSeen) > m.offlineTimeout {
-			node.IsOnline = false
-			offlineNodes = append(offlineNodes, node)
+		switch node.State {
+		case StateAlive:
+			// 检查心跳是否超时
+			if now.Sub(node.LastSeen) > m.timeoutOf(node) {
+				node.SuspectSince = now
+				m.setState(node, StateSuspect)
+			}
 
-			// 触发回调
-			if m.onNodeChange != nil {
-				m.onNodeChange(node, false)
+		case StateSuspect:
+			// 检查疑似离线是否超时
+			if now.Sub(node.SuspectSince) > m.suspicionTimeout {
+				m.setState(node, StateDead)
+				offlineNodes = append(offlineNodes, node)
+
+				// 触发回调
+				if m.onNodeChange != nil {
+					m.onNodeChange(node, false)
+				}
 			}
 		}
 	}
@@ -196,6 +540,33 @@ func (m *Manager) CheckOffline() []*Node {
 	return offlineNodes
 }
 
+// timeoutOf 节点的心跳超时，按节点上报的心跳间隔放大，调用方需持有锁
+// 只读节点以记录的有效期为超时
+func (m *Manager) timeoutOf(node *Node) time.Duration {
+	if node.ReadOnly && node.Interval > 0 {
+		return node.Interval
+	}
+	if m.baseInterval <= 0 || node.Interval <= m.baseInterval {
+		return m.offlineTimeout
+	}
+	// 两个 Duration 直接相乘会溢出
+	return time.Duration(float64(m.offlineTimeout) * float64(node.Interval) / float64(m.baseInterval))
+}
+
+// Probeable 获取可探测的节点（在线的非本机 LanLink 节点）
+func (m *Manager) Probeable() []*Node {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	nodes := make([]*Node, 0, len(m.nodes))
+	for _, node := range m.nodes {
+		if !node.IsLocal && !node.ReadOnly && node.IsOnline() {
+			nodes = append(nodes, node.snapshot())
+		}
+	}
+	return nodes
+}
+
 // SetLocal 设置本机节点
 func (m *Manager) SetLocal(deviceID string) {
 	m.mu.Lock()
@@ -203,6 +574,18 @@ func (m *Manager) SetLocal(deviceID string) {
 
 	if node, exists := m.nodes[deviceID]; exists {
 		node.IsLocal = true
-		node.IsOnline = true
+		node.State = StateAlive
+	}
+}
+
+// setState 切换节点状态并触发状态变化回调，调用方需持有锁
+func (m *Manager) setState(node *Node, state State) {
+	if node.State == state {
+		return
+	}
+	from := node.State
+	node.State = state
+	if m.onStateChange != nil {
+		m.onStateChange(node, from)
 	}
 }
@@ -0,0 +1,155 @@
+package node
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/618lf/lanlink/network"
+)
+
+func TestValidateSequence(t *testing.T) {
+	m := NewManager(30 * time.Second)
+	m.SetClockSkew(time.Minute)
+	now := time.Now().Unix()
+
+	if err := m.Validate("a", 2, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Validate("a", 2, now); !errors.Is(err, ErrDuplicateMessage) {
+		t.Fatalf("重复序号: %v", err)
+	}
+	if err := m.Validate("a", 1, now); !errors.Is(err, ErrDuplicateMessage) {
+		t.Fatalf("较小序号: %v", err)
+	}
+	if err := m.Validate("a", 3, now-120); !errors.Is(err, ErrStaleMessage) {
+		t.Fatalf("过期时间戳: %v", err)
+	}
+	if got := m.RejectedCount(); got != 3 {
+		t.Fatalf("RejectedCount = %d, want 3", got)
+	}
+}
+
+func TestValidateUnsequenced(t *testing.T) {
+	m := NewManager(30 * time.Second)
+	now := time.Now().Unix()
+
+	if err := m.Validate("a", 0, now); !errors.Is(err, ErrDuplicateMessage) {
+		t.Fatalf("默认应拒绝不带序号的消息: %v", err)
+	}
+	m.SetAcceptUnsequenced(true)
+	if err := m.Validate("a", 0, now); err != nil {
+		t.Fatalf("旧版本兼容模式: %v", err)
+	}
+}
+
+func TestValidatePrune(t *testing.T) {
+	m := NewManager(30 * time.Second)
+	m.SetClockSkew(time.Minute)
+	now := time.Now()
+
+	for _, id := range []string{"a", "b", "c"} {
+		if err := m.Validate(id, 1, now.Unix()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 超过两倍时钟偏差没有消息的记录被清理
+	m.mu.Lock()
+	m.lastSeq["a"] = seqRecord{seq: 1, seen: now.Add(-3 * time.Minute)}
+	m.pruned = time.Time{}
+	m.mu.Unlock()
+	if err := m.Validate("c", 2, now.Unix()); err != nil {
+		t.Fatal(err)
+	}
+
+	// 删除节点时一并删除记录
+	m.AddOrUpdate(&Node{DeviceID: "b", Domain: "b.coobee.local", IP: "10.0.0.2"})
+	m.Remove("b")
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if _, ok := m.lastSeq["a"]; ok {
+		t.Error("过期的序号记录未清理")
+	}
+	if _, ok := m.lastSeq["b"]; ok {
+		t.Error("删除节点后序号记录仍然存在")
+	}
+	if _, ok := m.lastSeq["c"]; !ok {
+		t.Error("活跃节点的序号记录被清理")
+	}
+}
+
+// TestGetReturnsSnapshot 返回的节点是快照，调用方读取时不需要持有管理器的锁
+func TestGetReturnsSnapshot(t *testing.T) {
+	m := NewManager(30 * time.Second)
+	m.AddOrUpdate(&Node{DeviceID: "a", Domain: "a.coobee.local", IP: "10.0.0.1"})
+
+	n, _ := m.Get("a")
+	n.IP = "10.0.0.9"
+	n.State = StateDead
+	for _, n := range m.GetAll() {
+		n.Domain = "changed"
+	}
+	for _, n := range m.Probeable() {
+		n.IP = "10.0.0.8"
+	}
+
+	got, _ := m.Get("a")
+	if got.IP != "10.0.0.1" || got.Domain != "a.coobee.local" || got.State != StateAlive {
+		t.Fatalf("修改快照影响了管理器中的节点: %+v", got)
+	}
+}
+
+// TestFindByAddress 只按节点使用的 IP 和 IPv6 查找，上报的其他地址不参与
+func TestFindByAddress(t *testing.T) {
+	m := NewManager(30 * time.Second)
+	m.AddOrUpdate(&Node{
+		DeviceID: "a",
+		Domain:   "a.coobee.local",
+		IP:       "10.0.0.1",
+		IPv6:     "fd00::1",
+		Addrs:    []network.Address{{IP: "10.0.0.1"}, {IP: "192.168.1.1"}},
+	})
+
+	for _, addr := range []string{"10.0.0.1", "fd00::1", "fd00:0::1"} {
+		if n, ok := m.FindByAddress(net.ParseIP(addr)); !ok || n.DeviceID != "a" {
+			t.Errorf("FindByAddress(%s) 未找到节点", addr)
+		}
+	}
+	for _, addr := range []string{"192.168.1.1", "10.0.0.2"} {
+		if _, ok := m.FindByAddress(net.ParseIP(addr)); ok {
+			t.Errorf("FindByAddress(%s) 不应找到节点", addr)
+		}
+	}
+}
+
+// TestConcurrentAccess 并发更新和读取节点（配合 -race 运行）
+func TestConcurrentAccess(t *testing.T) {
+	m := NewManager(time.Millisecond)
+	m.SetSuspicionTimeout(time.Millisecond)
+	m.SetChangeCallback(func(*Node, bool) {})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			m.AddOrUpdate(&Node{DeviceID: "a", Domain: "a.coobee.local", IP: "10.0.0.1"})
+			m.CheckOffline()
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		for _, n := range m.GetAll() {
+			_ = n.IsOnline() && n.LastSeen.IsZero()
+		}
+		if n, ok := m.Get("a"); ok {
+			_ = n.State
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package node
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	// heartbeatJitter 心跳间隔的随机抖动比例（±20%），避免大量节点同时发送
+	heartbeatJitter = 0.2
+	// nodesPerInterval 每个基础心跳间隔内期望的心跳数，节点数超过后间隔按比例增长
+	nodesPerInterval = 20
+)
+
+// HeartbeatScheduler 心跳调度器
+// 心跳间隔随已知节点数自适应增长，使组播中的心跳总量大致恒定；
+// 每次调度附加随机抖动，避免同时启动的节点同步发送
+type HeartbeatScheduler struct {
+	manager *Manager
+	base    time.Duration // 基础间隔
+	max     time.Duration // 最大间隔
+}
+
+// NewHeartbeatScheduler 创建心跳调度器
+// max 小于等于 base 时不做自适应，只附加抖动
+func NewHeartbeatScheduler(manager *Manager, base, max time.Duration) *HeartbeatScheduler {
+	return &HeartbeatScheduler{
+		manager: manager,
+		base:    base,
+		max:     max,
+	}
+}
+
+// Interval 当前心跳间隔（不含抖动）
+func (s *HeartbeatScheduler) Interval() time.Duration {
+	interval := s.base
+	// 只按发送心跳的 LanLink 节点计数（含本机），不含只读节点
+	if count := len(s.manager.Probeable()) + 1; count > nodesPerInterval {
+		interval = s.base * time.Duration(count) / nodesPerInterval
+	}
+	if interval > s.max {
+		interval = max(s.max, s.base)
+	}
+	return interval
+}
+
+// Next 下一次心跳前的等待时间（含抖动）
+func (s *HeartbeatScheduler) Next() time.Duration {
+	interval := s.Interval()
+	jitter := (rand.Float64()*2 - 1) * heartbeatJitter
+	return interval + time.Duration(float64(interval)*jitter)
+}
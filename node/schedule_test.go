@@ -0,0 +1,81 @@
+package node
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// managerWith 创建包含本机和 peers 个在线节点的管理器
+func managerWith(peers int) *Manager {
+	m := NewManager(30 * time.Second)
+	m.AddOrUpdate(&Node{DeviceID: "local", Domain: "local.coobee.local", IP: "10.0.0.1"})
+	m.SetLocal("local")
+	for i := 0; i < peers; i++ {
+		m.AddOrUpdate(&Node{DeviceID: "n" + strconv.Itoa(i), Domain: "n" + strconv.Itoa(i) + ".coobee.local", IP: "10.0.1.1"})
+	}
+	return m
+}
+
+func TestHeartbeatInterval(t *testing.T) {
+	tests := []struct {
+		name  string
+		peers int
+		base  time.Duration
+		max   time.Duration
+		want  time.Duration
+	}{
+		{"节点较少时为基础间隔", 5, 10 * time.Second, 60 * time.Second, 10 * time.Second},
+		{"20 个节点（含本机）", 19, 10 * time.Second, 60 * time.Second, 10 * time.Second},
+		{"按节点数增长", 49, 10 * time.Second, 60 * time.Second, 25 * time.Second},
+		{"不超过上限", 199, 10 * time.Second, 60 * time.Second, 60 * time.Second},
+		{"上限小于基础间隔时不自适应", 199, 10 * time.Second, 5 * time.Second, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewHeartbeatScheduler(managerWith(tt.peers), tt.base, tt.max)
+			if got := s.Interval(); got != tt.want {
+				t.Fatalf("Interval = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeartbeatJitter(t *testing.T) {
+	s := NewHeartbeatScheduler(managerWith(0), 10*time.Second, 60*time.Second)
+	low, high := 8*time.Second, 12*time.Second
+	for i := 0; i < 1000; i++ {
+		if next := s.Next(); next < low || next > high {
+			t.Fatalf("Next = %v, want [%v, %v]", next, low, high)
+		}
+	}
+}
+
+// TestOfflineTimeoutScaling 心跳间隔增长的节点，心跳超时按比例放大
+func TestOfflineTimeoutScaling(t *testing.T) {
+	m := NewManager(30 * time.Second)
+	m.SetHeartbeatInterval(10 * time.Second)
+
+	tests := []struct {
+		node *Node
+		want time.Duration
+	}{
+		{&Node{}, 30 * time.Second},
+		{&Node{Interval: 10 * time.Second}, 30 * time.Second},
+		{&Node{Interval: 5 * time.Second}, 30 * time.Second},
+		{&Node{Interval: 25 * time.Second}, 75 * time.Second},
+		{&Node{Interval: 60 * time.Second}, 180 * time.Second},
+		{&Node{Interval: 2 * time.Minute, ReadOnly: true}, 2 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := m.timeoutOf(tt.node); got != tt.want {
+			t.Errorf("timeoutOf(interval=%v, readOnly=%v) = %v, want %v", tt.node.Interval, tt.node.ReadOnly, got, tt.want)
+		}
+	}
+
+	// 未设置基础间隔时不放大
+	m = NewManager(30 * time.Second)
+	if got := m.timeoutOf(&Node{Interval: time.Minute}); got != 30*time.Second {
+		t.Fatalf("timeoutOf = %v, want 30s", got)
+	}
+}
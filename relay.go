@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/618lf/lanlink/config"
+	"github.com/618lf/lanlink/logger"
+	"github.com/618lf/lanlink/network"
+)
+
+// runRelay 以中继模式运行
+// 在连接多个网段的主机上把心跳在网段之间转发，本机不作为节点加入集群
+func runRelay() {
+	fmt.Println("LanLink - 组播中继")
+	fmt.Println()
+
+	// 1. 加载配置
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		fmt.Printf("加载配置失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	// 2. 初始化日志
+	if err := logger.Init(cfg.LogLevel, logFile); err != nil {
+		fmt.Printf("初始化日志失败: %v\n", err)
+		os.Exit(1)
+	}
+	defer logger.Close()
+
+	logger.Info("=== LanLink 中继启动 ===")
+
+	// 3. 中继标识
+	deviceID, err := network.GetMACAddress()
+	if err != nil {
+		logger.Error("获取MAC地址失败: %v", err)
+		os.Exit(1)
+	}
+	relayID := "relay-" + deviceID
+
+	// 4. 创建中继
+	policy, err := network.NewInterfacePolicy(cfg.Interfaces, cfg.ExcludeInterfaces, cfg.PreferredSubnets)
+	if err != nil {
+		logger.Error("网卡配置无效: %v", err)
+		os.Exit(1)
+	}
+	relay := network.NewRelay(relayID, cfg.MulticastAddr, cfg.MulticastPort, policy)
+
+	// 中继需要解码并重新编码消息，必须与集群使用相同的密钥
+	codec, err := network.NewCodec(cfg.ClusterSecret, cfg.Encryption, cfg.AcceptPlaintext)
+	if err != nil {
+		logger.Error("初始化消息编解码失败: %v", err)
+		os.Exit(1)
+	}
+	relay.SetCodec(codec)
+	if cfg.SourceRateLimit > 0 {
+		relay.SetRateLimit(network.NewRateLimiter(cfg.SourceRateLimit, cfg.SourceBurst, time.Duration(cfg.QuarantineSec)*time.Second))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := relay.Start(ctx); err != nil {
+		logger.Error("启动中继失败: %v", err)
+		os.Exit(1)
+	}
+	defer relay.Close()
+
+	logger.Info("中继已启动: %s:%d, ID=%s, 网卡: %s", cfg.MulticastAddr, cfg.MulticastPort,
+		relayID, strings.Join(relay.Interfaces(), ", "))
+	fmt.Printf("中继网卡: %s\n", strings.Join(relay.Interfaces(), ", "))
+	fmt.Println("LanLink 中继运行中，按 Ctrl+C 退出...")
+
+	statsTicker := time.NewTicker(30 * time.Second)
+	defer statsTicker.Stop()
+
+	for {
+		select {
+		case <-statsTicker.C:
+			stats := relay.Stats()
+			logger.Info("中继统计: 接收 %d, 转发 %d, 丢弃 %d", stats.Received, relay.Forwarded(), stats.Dropped())
+
+		case <-ctx.Done():
+			logger.Info("=== LanLink 中继已退出 ===")
+			return
+		}
+	}
+}